@@ -0,0 +1,188 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+)
+
+// Environment variables a tenant container finds its PR regions through.
+// Lists are comma separated and have one entry per tenant, in the order the
+// tenants were requested in.
+const (
+	ENV_TENANT_IDS            string = "FPGA_TENANT_IDS"
+	ENV_TENANT_CLASS          string = "FPGA_TENANT_CLASS"
+	ENV_TENANT_REGIONS        string = "FPGA_TENANT_REGIONS"
+	ENV_TENANT_BASE_ADDRESSES string = "FPGA_TENANT_BASE_ADDRESSES"
+	ENV_TENANT_BITSTREAMS     string = "FPGA_TENANT_BITSTREAMS"
+	ENV_PARENT_ID             string = "FPGA_PARENT_ID"
+)
+
+// The bitstreams configured for the FPGAs of a container, one per FPGA. Pods
+// that chose their own with the bitstream annotation get that one instead.
+const ENV_BITSTREAMS string = "FPGA_BITSTREAMS"
+
+// Collects the host files of a container, dropping duplicates
+type containerAccess struct {
+	mounts      []*pluginapi.Mount
+	devices     []*pluginapi.DeviceSpec
+	annotations map[string]string
+	seen        map[string]bool
+}
+
+func newContainerAccess() *containerAccess {
+	return &containerAccess{
+		seen: make(map[string]bool),
+	}
+}
+
+func (access *containerAccess) addDevice(path string) {
+	if access.seen[path] {
+		return
+	}
+	access.seen[path] = true
+	access.devices = append(access.devices, &pluginapi.DeviceSpec{
+		ContainerPath: path,
+		HostPath:      path,
+		Permissions:   "rw",
+	})
+}
+
+func (access *containerAccess) addMount(path string) {
+	if access.seen[path] {
+		return
+	}
+	access.seen[path] = true
+	access.mounts = append(access.mounts, &pluginapi.Mount{
+		ContainerPath: path,
+		HostPath:      path,
+		ReadOnly:      false,
+	})
+}
+
+// Add what a backend gives containers for a device. Environment variables
+// and annotations set for more than one device become comma separated lists,
+// with one entry per device.
+func (access *containerAccess) addSpec(spec *ContainerSpec, envs map[string]string) {
+	for _, path := range spec.DeviceNodes {
+		access.addDevice(path)
+	}
+	for _, path := range spec.Mounts {
+		access.addMount(path)
+	}
+	appendValues(envs, spec.Envs)
+	if len(spec.Annotations) > 0 {
+		if access.annotations == nil {
+			access.annotations = make(map[string]string)
+		}
+		appendValues(access.annotations, spec.Annotations)
+	}
+}
+
+// Add values to a map, appending them to those already there
+func appendValues(values map[string]string, added map[string]string) {
+	for name, value := range added {
+		if previous, ok := values[name]; ok {
+			value = previous + "," + value
+		}
+		values[name] = value
+	}
+}
+
+func (access *containerAccess) add(config AccessConfig, region int, pciAddress string) {
+	for _, path := range config.Devices {
+		access.addDevice(hostPath(path, region, pciAddress))
+	}
+	for _, path := range config.Mounts {
+		access.addMount(hostPath(path, region, pciAddress))
+	}
+}
+
+// What a container needs to use the given FPGAs, as told by their backends.
+// Must be called with the plugin mutex held, and only with existing IDs.
+func (plugin *FPGADevicePlugin) containerResponse(ids []string) *pluginapi.ContainerAllocateResponse {
+	var bitstreams []string
+	envs := map[string]string{}
+	access := newContainerAccess()
+	for _, id := range ids {
+		_, index := plugin.deviceExists(id)
+		device := plugin.devices[index]
+		if plugin.bitstream != "" {
+			bitstreams = append(bitstreams, plugin.bitstream)
+		}
+		access.addSpec(device.backend.AllocateSpec(device, WHOLE_FPGA), envs)
+	}
+	if len(bitstreams) > 0 {
+		envs[ENV_BITSTREAMS] = strings.Join(bitstreams, ",")
+	}
+	return &pluginapi.ContainerAllocateResponse{
+		Envs:        envs,
+		Mounts:      access.mounts,
+		Devices:     access.devices,
+		Annotations: access.annotations,
+	}
+}
+
+// What a container needs to use the given tenants. Must be called with the
+// parent plugin mutex held, and only with existing IDs.
+func (plugin *FPGATenantDevicePlugin) containerResponse(ids []string) *pluginapi.ContainerAllocateResponse {
+	var regions []string
+	var addresses []string
+	var parents []string
+	var bitstreams []string
+	seenParents := make(map[*FPGADevice]bool)
+	envs := map[string]string{}
+	access := newContainerAccess()
+	for _, id := range ids {
+		_, index := plugin.deviceExists(id)
+		device := plugin.devices[index]
+		regions = append(regions, strconv.Itoa(device.region))
+		if plugin.region.hasAddress() {
+			addresses = append(addresses, fmt.Sprintf("0x%x", plugin.region.address(device.region)))
+		}
+		parents = append(parents, device.parent.ID)
+		if plugin.bitstream != "" {
+			bitstreams = append(bitstreams, regionBitstream(plugin.bitstream, device.region))
+		}
+		access.addSpec(device.parent.backend.AllocateSpec(device.parent, device.backendRegion()), envs)
+		access.add(plugin.region.AccessConfig, device.region, device.parent.pciAddress)
+		if !seenParents[device.parent] {
+			seenParents[device.parent] = true
+			access.add(plugin.parentPlugin.shell, device.region, device.parent.pciAddress)
+		}
+	}
+	envs[ENV_TENANT_IDS] = strings.Join(ids, ",")
+	envs[ENV_TENANT_CLASS] = plugin.tenantName
+	envs[ENV_TENANT_REGIONS] = strings.Join(regions, ",")
+	envs[ENV_PARENT_ID] = strings.Join(parents, ",")
+	if len(addresses) > 0 {
+		envs[ENV_TENANT_BASE_ADDRESSES] = strings.Join(addresses, ",")
+	}
+	if len(bitstreams) > 0 {
+		envs[ENV_TENANT_BITSTREAMS] = strings.Join(bitstreams, ",")
+	}
+	return &pluginapi.ContainerAllocateResponse{
+		Envs:        envs,
+		Mounts:      access.mounts,
+		Devices:     access.devices,
+		Annotations: access.annotations,
+	}
+}
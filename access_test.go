@@ -0,0 +1,197 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+)
+
+func TestContainerResponse(t *testing.T) {
+	config := simConfig(2,
+		TenantConfig{
+			Name:      "tenant",
+			Count:     2,
+			Bitstream: "tenant-{region}.bin",
+			Region: RegionConfig{
+				BaseAddress: 0x1000,
+				Stride:      0x100,
+				AccessConfig: AccessConfig{
+					Devices: []string{"/dev/region-{pci}-{region}"},
+				},
+			},
+		},
+		TenantConfig{Name: "plain", Count: 1},
+	)
+	config.Boards[0].Shell = AccessConfig{
+		Devices: []string{"/dev/shell-{pci}"},
+		Mounts:  []string{"/sys/bus/pci/devices/{pci}"},
+	}
+	plugin := newSimPlugins(t, config)[0]
+	plugin.devices[0].pciAddress = "0000:01:00.0"
+	plugin.devices[1].pciAddress = "0000:02:00.0"
+	tenants := plugin.childPlugins[0]
+	plain := plugin.childPlugins[1]
+	fpga0 := plugin.devices[0]
+	fpga1 := plugin.devices[1]
+	// A board without a shell, whose tenant classes are set up differently
+	config = simConfig(1,
+		TenantConfig{
+			Name:  "small",
+			Count: 2,
+			Region: RegionConfig{
+				BaseAddress: 0x4000,
+				Stride:      0x1000,
+				AccessConfig: AccessConfig{
+					Mounts: []string{"/sys/bus/pci/devices/{pci}/region{region}"},
+				},
+			},
+		},
+		TenantConfig{
+			Name:  "large",
+			Count: 1,
+			Region: RegionConfig{
+				BaseAddress: 0x80000000,
+				AccessConfig: AccessConfig{
+					Devices: []string{"/dev/large-{pci}"},
+				},
+			},
+		},
+	)
+	unshelled := newSimPlugins(t, config)[0]
+	unshelled.devices[0].pciAddress = "0000:03:00.0"
+	fpga2 := unshelled.devices[0]
+	tests := []struct {
+		name    string
+		plugin  DeviceSet
+		ids     []string
+		envs    map[string]string
+		devices []string
+		mounts  []string
+	}{
+		{"one tenant", tenants, []string{fpga0.children[1].ID}, map[string]string{
+			ENV_TENANT_IDS:            fpga0.children[1].ID,
+			ENV_TENANT_CLASS:          "tenant",
+			ENV_TENANT_REGIONS:        "1",
+			ENV_TENANT_BASE_ADDRESSES: "0x1100",
+			ENV_TENANT_BITSTREAMS:     "tenant-1.bin",
+			ENV_PARENT_ID:             fpga0.ID,
+			ENV_SIMULATED:             "true",
+		}, []string{
+			"/dev/region-0000:01:00.0-1",
+			"/dev/shell-0000:01:00.0",
+		}, []string{
+			"/sys/bus/pci/devices/0000:01:00.0",
+		}},
+		{"one FPGA", tenants, []string{fpga0.children[0].ID, fpga0.children[1].ID}, map[string]string{
+			ENV_TENANT_IDS:            fpga0.children[0].ID + "," + fpga0.children[1].ID,
+			ENV_TENANT_CLASS:          "tenant",
+			ENV_TENANT_REGIONS:        "0,1",
+			ENV_TENANT_BASE_ADDRESSES: "0x1000,0x1100",
+			ENV_TENANT_BITSTREAMS:     "tenant-0.bin,tenant-1.bin",
+			ENV_PARENT_ID:             fpga0.ID + "," + fpga0.ID,
+			ENV_SIMULATED:             "true,true",
+		}, []string{
+			"/dev/region-0000:01:00.0-0",
+			"/dev/shell-0000:01:00.0",
+			"/dev/region-0000:01:00.0-1",
+		}, []string{
+			"/sys/bus/pci/devices/0000:01:00.0",
+		}},
+		{"two FPGAs", tenants, []string{fpga1.children[0].ID, fpga0.children[0].ID}, map[string]string{
+			ENV_TENANT_IDS:            fpga1.children[0].ID + "," + fpga0.children[0].ID,
+			ENV_TENANT_CLASS:          "tenant",
+			ENV_TENANT_REGIONS:        "0,0",
+			ENV_TENANT_BASE_ADDRESSES: "0x1000,0x1000",
+			ENV_TENANT_BITSTREAMS:     "tenant-0.bin,tenant-0.bin",
+			ENV_PARENT_ID:             fpga1.ID + "," + fpga0.ID,
+			ENV_SIMULATED:             "true,true",
+		}, []string{
+			"/dev/region-0000:02:00.0-0",
+			"/dev/shell-0000:02:00.0",
+			"/dev/region-0000:01:00.0-0",
+			"/dev/shell-0000:01:00.0",
+		}, []string{
+			"/sys/bus/pci/devices/0000:02:00.0",
+			"/sys/bus/pci/devices/0000:01:00.0",
+		}},
+		{"no region or bitstream", plain, []string{fpga1.children[2].ID}, map[string]string{
+			ENV_TENANT_IDS:     fpga1.children[2].ID,
+			ENV_TENANT_CLASS:   "plain",
+			ENV_TENANT_REGIONS: "0",
+			ENV_PARENT_ID:      fpga1.ID,
+			ENV_SIMULATED:      "true",
+		}, []string{
+			"/dev/shell-0000:02:00.0",
+		}, []string{
+			"/sys/bus/pci/devices/0000:02:00.0",
+		}},
+		{"no shell", unshelled.childPlugins[0], []string{fpga2.children[0].ID, fpga2.children[1].ID}, map[string]string{
+			ENV_TENANT_IDS:            fpga2.children[0].ID + "," + fpga2.children[1].ID,
+			ENV_TENANT_CLASS:          "small",
+			ENV_TENANT_REGIONS:        "0,1",
+			ENV_TENANT_BASE_ADDRESSES: "0x4000,0x5000",
+			ENV_PARENT_ID:             fpga2.ID + "," + fpga2.ID,
+			ENV_SIMULATED:             "true,true",
+		}, nil, []string{
+			"/sys/bus/pci/devices/0000:03:00.0/region0",
+			"/sys/bus/pci/devices/0000:03:00.0/region1",
+		}},
+		{"other class", unshelled.childPlugins[1], []string{fpga2.children[2].ID}, map[string]string{
+			ENV_TENANT_IDS:            fpga2.children[2].ID,
+			ENV_TENANT_CLASS:          "large",
+			ENV_TENANT_REGIONS:        "0",
+			ENV_TENANT_BASE_ADDRESSES: "0x80000000",
+			ENV_PARENT_ID:             fpga2.ID,
+			ENV_SIMULATED:             "true",
+		}, []string{
+			"/dev/large-0000:03:00.0",
+		}, nil},
+		{"entire FPGAs", plugin, []string{fpga0.ID, fpga1.ID}, map[string]string{
+			ENV_SIMULATED: "true,true",
+		}, nil, nil},
+	}
+	for _, test := range tests {
+		response := test.plugin.containerResponse(test.ids)
+		if !reflect.DeepEqual(response.Envs, test.envs) {
+			t.Errorf("%s: envs are %v, want %v", test.name, response.Envs, test.envs)
+		}
+		var devices []string
+		for _, device := range response.Devices {
+			if device.HostPath != device.ContainerPath || device.Permissions != "rw" {
+				t.Errorf("%s: device %v is not passed as it is", test.name, device)
+			}
+			devices = append(devices, device.HostPath)
+		}
+		if !equalStrings(devices, test.devices) {
+			t.Errorf("%s: devices are %v, want %v", test.name, devices, test.devices)
+		}
+		if !equalStrings(mountPaths(response.Mounts), test.mounts) {
+			t.Errorf("%s: mounts are %v, want %v", test.name, mountPaths(response.Mounts), test.mounts)
+		}
+	}
+}
+
+func mountPaths(mounts []*pluginapi.Mount) []string {
+	var paths []string
+	for _, mount := range mounts {
+		paths = append(paths, mount.HostPath)
+	}
+	return paths
+}
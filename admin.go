@@ -0,0 +1,381 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+	log "github.com/sirupsen/logrus"
+)
+
+// Where the admin API listens by default, next to the checkpoint
+const AdminSocket = "/var/lib/fpga-device-plugin/admin.sock"
+
+// A device tree as reported by the admin API
+type AdminPlugin struct {
+	Resource string        `json:"resource"`
+	Devices  []AdminDevice `json:"devices"`
+}
+
+type AdminDevice struct {
+	ID         string        `json:"id"`
+	Backend    string        `json:"backend"`
+	Status     string        `json:"status"`
+	Health     string        `json:"health"`
+	PCIAddress string        `json:"pciAddress,omitempty"`
+	Allocated  *time.Time    `json:"allocated,omitempty"`
+	Bitstream  string        `json:"bitstream,omitempty"`
+	Tenants    []AdminTenant `json:"tenants,omitempty"`
+}
+
+type AdminTenant struct {
+	ID        string     `json:"id"`
+	Resource  string     `json:"resource"`
+	Region    int        `json:"region"`
+	Status    string     `json:"status"`
+	Health    string     `json:"health"`
+	Allocated *time.Time `json:"allocated,omitempty"`
+	Bitstream string     `json:"bitstream,omitempty"`
+}
+
+// Sent to the main loop to look for new FPGAs, which replies with the number
+// of FPGAs it found
+type rediscoverRequest struct {
+	found chan int
+}
+
+// A local HTTP/JSON API over a unix socket, to inspect and control devices.
+// Only root may use it: the socket is only accessible by its owner, and the
+// credentials of every client are checked too.
+//
+//	GET  /devices                   the device tree of every plugin
+//	POST /devices/unhealthy?id=ID   take a device out of service
+//	POST /devices/free?id=ID        wipe a device and mark it free
+//	POST /rediscover                look for new FPGAs
+type AdminServer struct {
+	socketPath string
+	mux        *http.ServeMux
+	// Handled by the main loop, which owns the list of plugins
+	rediscoverRequests chan rediscoverRequest
+	plugins            []*FPGADevicePlugin
+	mutex              sync.RWMutex
+}
+
+func NewAdminServer(socketPath string, plugins []*FPGADevicePlugin) *AdminServer {
+	server := &AdminServer{
+		socketPath:         socketPath,
+		mux:                http.NewServeMux(),
+		rediscoverRequests: make(chan rediscoverRequest),
+		plugins:            plugins,
+	}
+	server.mux.HandleFunc("/devices", server.serveDevices)
+	server.mux.HandleFunc("/devices/unhealthy", server.serveUnhealthy)
+	server.mux.HandleFunc("/devices/free", server.serveFree)
+	server.mux.HandleFunc("/rediscover", server.serveRediscover)
+	return server
+}
+
+func (server *AdminServer) setPlugins(plugins []*FPGADevicePlugin) {
+	server.mutex.Lock()
+	server.plugins = plugins
+	server.mutex.Unlock()
+}
+
+func (server *AdminServer) getPlugins() []*FPGADevicePlugin {
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+	return server.plugins
+}
+
+func allocatedTime(status DeviceState, allocated time.Time) *time.Time {
+	if !status.inUse() {
+		return nil
+	}
+	return &allocated
+}
+
+// The bitstream loaded into an FPGA or one of its PR regions, if its backend
+// knows
+func loadedBitstream(device *FPGADevice, region Region) string {
+	reporter, ok := device.backend.(BitstreamReporter)
+	if !ok {
+		return ""
+	}
+	return reporter.LoadedBitstream(device, region)
+}
+
+// Must be called with the plugin mutex held
+func (plugin *FPGADevicePlugin) adminTree() AdminPlugin {
+	tree := AdminPlugin{
+		Resource: plugin.fullName(),
+		Devices:  []AdminDevice{},
+	}
+	for _, device := range plugin.devices {
+		adminDevice := AdminDevice{
+			ID:         device.ID,
+			Backend:    device.backend.Name(),
+			Status:     device.status.String(),
+			Health:     device.Health,
+			PCIAddress: device.pciAddress,
+			Allocated:  allocatedTime(device.status, device.allocated),
+			Bitstream:  loadedBitstream(device, WHOLE_FPGA),
+		}
+		for _, child := range device.children {
+			adminDevice.Tenants = append(adminDevice.Tenants, AdminTenant{
+				ID:        child.ID,
+				Resource:  child.resource,
+				Region:    child.region,
+				Status:    child.status.String(),
+				Health:    child.Health,
+				Allocated: allocatedTime(child.status, child.allocated),
+				Bitstream: loadedBitstream(device, child.backendRegion()),
+			})
+		}
+		tree.Devices = append(tree.Devices, adminDevice)
+	}
+	return tree
+}
+
+// Find the plugin an FPGA or tenant ID belongs to
+func findDevice(plugins []*FPGADevicePlugin, id string) (*FPGADevicePlugin, *FPGADevice, *FPGATenantDevice) {
+	for _, plugin := range plugins {
+		plugin.mutex.RLock()
+		if exists, index := plugin.deviceExists(id); exists {
+			plugin.mutex.RUnlock()
+			return plugin, plugin.devices[index], nil
+		}
+		for _, childPlugin := range plugin.childPlugins {
+			if exists, index := childPlugin.deviceExists(id); exists {
+				plugin.mutex.RUnlock()
+				return plugin, nil, childPlugin.devices[index]
+			}
+		}
+		plugin.mutex.RUnlock()
+	}
+	return nil, nil, nil
+}
+
+func (server *AdminServer) serveDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	trees := []AdminPlugin{}
+	for _, plugin := range server.getPlugins() {
+		plugin.mutex.RLock()
+		trees = append(trees, plugin.adminTree())
+		plugin.mutex.RUnlock()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trees)
+}
+
+// Find the device a request is about, answering it if there is none
+func (server *AdminServer) requestedDevice(w http.ResponseWriter, r *http.Request) (*FPGADevicePlugin, *FPGADevice, *FPGATenantDevice) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return nil, nil, nil
+	}
+	id := r.URL.Query().Get("id")
+	plugin, device, tenant := findDevice(server.getPlugins(), id)
+	if plugin == nil {
+		http.Error(w, fmt.Sprintf("unknown device '%s'", id), http.StatusNotFound)
+	}
+	return plugin, device, tenant
+}
+
+func (server *AdminServer) changeDevice(w http.ResponseWriter, r *http.Request, change func(plugin *FPGADevicePlugin, device *FPGADevice, tenant *FPGATenantDevice) error) {
+	plugin, device, tenant := server.requestedDevice(w, r)
+	if plugin == nil {
+		return
+	}
+	plugin.mutex.Lock()
+	err := change(plugin, device, tenant)
+	if err == nil {
+		plugin.saveCheckpoint()
+	}
+	plugin.mutex.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *AdminServer) serveUnhealthy(w http.ResponseWriter, r *http.Request) {
+	server.changeDevice(w, r, func(plugin *FPGADevicePlugin, device *FPGADevice, tenant *FPGATenantDevice) error {
+		var target managedDevice = device
+		if device == nil {
+			target = tenant
+		}
+		// Like HealthMonitor.disable, containers keep busy devices until
+		// they are released
+		var err error
+		switch state := target.state(); {
+		case state == RESERVED || state == USED:
+			err = target.setState(DRAINING)
+		case state == PROGRAMMING:
+			err = &TransitionError{
+				ID:     target.deviceID(),
+				From:   state,
+				To:     DRAINING,
+				Reason: "device is being programmed, try again",
+			}
+		case state == BLOCKED && device != nil:
+			device.setHealth(pluginapi.Unhealthy)
+		default:
+			err = target.setState(UNHEALTHY)
+		}
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"ID":     target.deviceID(),
+			"Status": target.state(),
+		}).Warn("Device marked unhealthy through the admin API")
+		return nil
+	})
+}
+
+func (server *AdminServer) serveFree(w http.ResponseWriter, r *http.Request) {
+	plugin, device, tenant := server.requestedDevice(w, r)
+	if plugin == nil {
+		return
+	}
+	var target managedDevice = device
+	if device == nil {
+		target = tenant
+	}
+	plugin.mutex.Lock()
+	err := target.setState(RESETTING)
+	if err == nil {
+		plugin.saveCheckpoint()
+	}
+	plugin.mutex.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	// Wiping takes a while, so don't hold the lock for it, like Deallocate
+	wipeErr := target.Reset()
+	plugin.mutex.Lock()
+	err = finishReset(target, FREE, wipeErr)
+	plugin.saveCheckpoint()
+	plugin.mutex.Unlock()
+	if wipeErr != nil {
+		http.Error(w, fmt.Sprintf("cannot wipe device: %v", wipeErr), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.WithFields(log.Fields{
+		"ID": target.deviceID(),
+	}).Warn("Device freed through the admin API")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *AdminServer) serveRediscover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	request := rediscoverRequest{
+		found: make(chan int, 1),
+	}
+	server.rediscoverRequests <- request
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Found int `json:"found"`
+	}{
+		Found: <-request.found,
+	})
+}
+
+type peerUIDKey struct{}
+
+// Remember who is on the other end of a connection
+func peerContext(ctx context.Context, conn net.Conn) context.Context {
+	uid := -1
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		if rawConn, err := unixConn.SyscallConn(); err == nil {
+			rawConn.Control(func(fd uintptr) {
+				cred, err := syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+				if err == nil {
+					uid = int(cred.Uid)
+				}
+			})
+		}
+	}
+	return context.WithValue(ctx, peerUIDKey{}, uid)
+}
+
+func (server *AdminServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if uid, _ := r.Context().Value(peerUIDKey{}).(int); uid != 0 {
+		http.Error(w, "only root may use the admin API", http.StatusForbidden)
+		return
+	}
+	server.mux.ServeHTTP(w, r)
+}
+
+func (server *AdminServer) Start() error {
+	// A stale socket from a previous run would keep us from listening
+	err := os.Remove(server.socketPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.WithFields(log.Fields{
+			"Path":  server.socketPath,
+			"Error": err,
+		}).Error("Cannot remove old admin socket.")
+		return err
+	}
+	// Only the owner may connect, from the moment the socket exists
+	oldMask := syscall.Umask(0177)
+	sock, err := net.Listen("unix", server.socketPath)
+	syscall.Umask(oldMask)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Path":  server.socketPath,
+			"Error": err,
+		}).Error("Cannot listen on admin socket.")
+		return err
+	}
+	httpServer := &http.Server{
+		Handler:     http.HandlerFunc(server.serveHTTP),
+		ConnContext: peerContext,
+	}
+	go func() {
+		err := httpServer.Serve(sock)
+		log.WithFields(log.Fields{
+			"Path":  server.socketPath,
+			"Error": err,
+		}).Error("Admin server stopped")
+	}()
+	log.WithFields(log.Fields{
+		"Path": server.socketPath,
+	}).Info("Started admin server.")
+	return nil
+}
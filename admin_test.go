@@ -0,0 +1,158 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+)
+
+// Post an admin request about a device
+func postAdmin(server *AdminServer, endpoint string, id string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, endpoint+"?id="+url.QueryEscape(id), nil)
+	server.mux.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestServeFree(t *testing.T) {
+	plugins := newSimPlugins(t, simConfig(2, TenantConfig{Name: "tenant", Count: 2}))
+	server := NewAdminServer("", plugins)
+	used := plugins[0].devices[0]
+	if err := used.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	tenant := plugins[0].devices[1].children[0]
+	if err := tenant.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id     string
+		code   int
+		device managedDevice
+		state  DeviceState
+	}{
+		{used.ID, http.StatusNoContent, used, FREE},
+		{tenant.ID, http.StatusNoContent, tenant, FREE},
+		{tenant.ID, http.StatusConflict, tenant, FREE},
+		{"unknown", http.StatusNotFound, nil, FREE},
+	}
+	for _, test := range tests {
+		recorder := postAdmin(server, "/devices/free", test.id)
+		if recorder.Code != test.code {
+			t.Errorf("freeing %s answered %d, want %d", test.id, recorder.Code, test.code)
+		}
+		if test.device != nil && test.device.state() != test.state {
+			t.Errorf("%s is %s, want %s", test.id, test.device.state(), test.state)
+		}
+	}
+}
+
+// Busy devices are drained, only free ones become unhealthy right away
+func TestServeUnhealthy(t *testing.T) {
+	plugins := newSimPlugins(t, simConfig(4, TenantConfig{Name: "tenant", Count: 2}))
+	server := NewAdminServer("", plugins)
+	devices := plugins[0].devices
+	free := devices[0]
+	used := devices[1]
+	if err := used.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	blocked := devices[2]
+	tenant := blocked.children[0]
+	if err := tenant.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	programming := devices[3]
+	for _, state := range []DeviceState{RESERVED, PROGRAMMING} {
+		if err := programming.setState(state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		id     string
+		code   int
+		device managedDevice
+		state  DeviceState
+		health string
+	}{
+		{free.ID, http.StatusNoContent, free, UNHEALTHY, pluginapi.Unhealthy},
+		{used.ID, http.StatusNoContent, used, DRAINING, pluginapi.Unhealthy},
+		{blocked.ID, http.StatusNoContent, blocked, BLOCKED, pluginapi.Unhealthy},
+		{tenant.ID, http.StatusNoContent, tenant, DRAINING, pluginapi.Unhealthy},
+		{programming.ID, http.StatusConflict, programming, PROGRAMMING, pluginapi.Healthy},
+		{"unknown", http.StatusNotFound, nil, FREE, ""},
+	}
+	for _, test := range tests {
+		recorder := postAdmin(server, "/devices/unhealthy", test.id)
+		if recorder.Code != test.code {
+			t.Errorf("marking %s unhealthy answered %d, want %d", test.id, recorder.Code, test.code)
+		}
+		if test.device == nil {
+			continue
+		}
+		if test.device.state() != test.state || test.device.apiDevice().Health != test.health {
+			t.Errorf("%s is %s and %s, want %s and %s", test.id, test.device.state(), test.device.apiDevice().Health, test.state, test.health)
+		}
+	}
+	// Drained devices are taken out of service once their container is done
+	if _, err := deallocate(plugins[0].server, used.ID); err != nil {
+		t.Fatal(err)
+	}
+	if used.status != UNHEALTHY {
+		t.Errorf("%s is %s once released, want UNHEALTHY", used.ID, used.status)
+	}
+}
+
+// Wiping takes a while, other handlers must not wait on it
+func TestServeFreeWipesWithoutLock(t *testing.T) {
+	config := simConfig(1)
+	config.Simulated[0].ResetLatency = 300 * time.Millisecond
+	plugins := newSimPlugins(t, config)
+	plugin := plugins[0]
+	device := plugin.devices[0]
+	if err := device.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	server := NewAdminServer("", plugins)
+	done := make(chan int)
+	go func() {
+		done <- postAdmin(server, "/devices/free", device.ID).Code
+	}()
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	plugin.mutex.RLock()
+	state := device.status
+	plugin.mutex.RUnlock()
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("waited %v for the lock while the device was wiped", waited)
+	}
+	if state != RESETTING {
+		t.Errorf("device is %s while it is wiped, want RESETTING", state)
+	}
+	if code := <-done; code != http.StatusNoContent {
+		t.Errorf("freeing answered %d, want %d", code, http.StatusNoContent)
+	}
+	if device.status != FREE {
+		t.Errorf("device is %s once wiped, want FREE", device.status)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"sort"
+)
+
+// How GetPreferredAllocation picks devices out of the ones kubelet offers.
+// The packed policy keeps tenants together on as few FPGAs as possible, and
+// keeps entire FPGA requests away from FPGAs that recently hosted tenants, so
+// that both kinds of requests can still be served later on. The none policy
+// leaves the choice to kubelet.
+const (
+	ALLOCATION_PACKED string = "packed"
+	ALLOCATION_NONE   string = "none"
+)
+
+func validAllocationPolicy(policy string) bool {
+	return policy == ALLOCATION_PACKED || policy == ALLOCATION_NONE
+}
+
+// Number of free tenant slots on an FPGA, over all tenant classes
+func (device *FPGADevice) freeTenants() int {
+	free := 0
+	for _, child := range device.children {
+		if child.status == FREE {
+			free++
+		}
+	}
+	return free
+}
+
+// Pick size devices out of the available ones, always including the ones
+// kubelet insists on. The rest are sorted with less, if given, and taken in
+// that order.
+func preferDevices(available []string, mustInclude []string, size int, less func(a string, b string) bool) []string {
+	var preferred []string
+	chosen := make(map[string]bool)
+	for _, id := range mustInclude {
+		if !chosen[id] {
+			chosen[id] = true
+			preferred = append(preferred, id)
+		}
+	}
+	var rest []string
+	for _, id := range available {
+		if !chosen[id] {
+			chosen[id] = true
+			rest = append(rest, id)
+		}
+	}
+	if less != nil {
+		sort.SliceStable(rest, func(i, j int) bool {
+			return less(rest[i], rest[j])
+		})
+	}
+	for _, id := range rest {
+		if len(preferred) >= size {
+			break
+		}
+		preferred = append(preferred, id)
+	}
+	return preferred
+}
+
+// Prefer FPGAs that didn't host any tenants since they were last used
+// entirely, those that did are likely to be asked for tenants again.
+func (plugin *FPGADevicePlugin) packedLess() func(a string, b string) bool {
+	return func(a string, b string) bool {
+		_, indexA := plugin.deviceExists(a)
+		_, indexB := plugin.deviceExists(b)
+		if indexA < 0 || indexB < 0 {
+			return indexB < 0 && indexA >= 0
+		}
+		return !plugin.devices[indexA].tenantHistory && plugin.devices[indexB].tenantHistory
+	}
+}
+
+// Prefer tenants on FPGAs that we already must use, then on FPGAs that are
+// already blocked by other tenants, then on FPGAs with the fewest free tenant
+// slots. Tenants of the same FPGA are kept next to each other.
+func (plugin *FPGATenantDevicePlugin) packedLess(mustInclude []string) func(a string, b string) bool {
+	boards := make(map[*FPGADevice]int)
+	for index, device := range plugin.parentPlugin.devices {
+		boards[device] = index
+	}
+	needed := make(map[*FPGADevice]bool)
+	for _, id := range mustInclude {
+		if exists, index := plugin.deviceExists(id); exists {
+			needed[plugin.devices[index].parent] = true
+		}
+	}
+	return func(a string, b string) bool {
+		_, indexA := plugin.deviceExists(a)
+		_, indexB := plugin.deviceExists(b)
+		if indexA < 0 || indexB < 0 {
+			return indexB < 0 && indexA >= 0
+		}
+		parentA := plugin.devices[indexA].parent
+		parentB := plugin.devices[indexB].parent
+		if parentA == parentB {
+			return false
+		}
+		if needed[parentA] != needed[parentB] {
+			return needed[parentA]
+		}
+		if (parentA.status == BLOCKED) != (parentB.status == BLOCKED) {
+			return parentA.status == BLOCKED
+		}
+		if parentA.freeTenants() != parentB.freeTenants() {
+			return parentA.freeTenants() < parentB.freeTenants()
+		}
+		return boards[parentA] < boards[parentB]
+	}
+}
+
+func (plugin *FPGADevicePlugin) preferredAllocation(available []string, mustInclude []string, size int) []string {
+	var less func(a string, b string) bool
+	if plugin.allocationPolicy == ALLOCATION_PACKED {
+		less = plugin.packedLess()
+	}
+	return preferDevices(available, mustInclude, size, less)
+}
+
+func (plugin *FPGATenantDevicePlugin) preferredAllocation(available []string, mustInclude []string, size int) []string {
+	var less func(a string, b string) bool
+	if plugin.parentPlugin.allocationPolicy == ALLOCATION_PACKED {
+		less = plugin.packedLess(mustInclude)
+	}
+	return preferDevices(available, mustInclude, size, less)
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestPreferDevices(t *testing.T) {
+	byName := func(a string, b string) bool {
+		return a < b
+	}
+	tests := []struct {
+		name        string
+		available   []string
+		mustInclude []string
+		size        int
+		less        func(a string, b string) bool
+		preferred   []string
+	}{
+		{"kubelet order", []string{"c", "a", "b"}, nil, 2, nil, []string{"c", "a"}},
+		{"sorted", []string{"c", "a", "b"}, nil, 2, byName, []string{"a", "b"}},
+		{"must include first", []string{"c", "a", "b"}, []string{"c"}, 2, byName, []string{"c", "a"}},
+		{"duplicates", []string{"a", "a", "b"}, []string{"b", "b"}, 3, byName, []string{"b", "a"}},
+		{"too few", []string{"a"}, nil, 2, byName, []string{"a"}},
+	}
+	for _, test := range tests {
+		preferred := preferDevices(test.available, test.mustInclude, test.size, test.less)
+		if !equalStrings(preferred, test.preferred) {
+			t.Errorf("%s: preferred %v, want %v", test.name, preferred, test.preferred)
+		}
+	}
+}
+
+// Entire FPGA requests go to FPGAs without tenant history first
+func TestPackedFPGAs(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(4, TenantConfig{Name: "tenant", Count: 2}))[0]
+	ids := make([]string, len(plugin.devices))
+	for index, device := range plugin.devices {
+		ids[index] = device.ID
+	}
+	plugin.devices[0].tenantHistory = true
+	plugin.devices[1].tenantHistory = true
+	tests := []struct {
+		name        string
+		policy      string
+		available   []string
+		mustInclude []string
+		size        int
+		preferred   []string
+	}{
+		{"no history first", ALLOCATION_PACKED, ids, nil, 2, []string{ids[2], ids[3]}},
+		{"history last", ALLOCATION_PACKED, ids, nil, 3, []string{ids[2], ids[3], ids[0]}},
+		{"must include", ALLOCATION_PACKED, ids, []string{ids[1]}, 2, []string{ids[1], ids[2]}},
+		{"unknown last", ALLOCATION_PACKED, []string{"unknown", ids[0], ids[2]}, nil, 2, []string{ids[2], ids[0]}},
+		{"none", ALLOCATION_NONE, ids, nil, 2, []string{ids[0], ids[1]}},
+	}
+	for _, test := range tests {
+		plugin.allocationPolicy = test.policy
+		preferred := plugin.preferredAllocation(test.available, test.mustInclude, test.size)
+		if !equalStrings(preferred, test.preferred) {
+			t.Errorf("%s: preferred %v, want %v", test.name, preferred, test.preferred)
+		}
+	}
+}
+
+// Tenants go to FPGAs that are needed anyway, then to blocked FPGAs, then to
+// the FPGAs with the fewest free slots, then in board order
+func TestPackedTenants(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(4, TenantConfig{Name: "tenant", Count: 3}))[0]
+	tenants := plugin.childPlugins[0]
+	board := func(fpga int) []string {
+		var ids []string
+		for _, child := range plugin.devices[fpga].children {
+			ids = append(ids, child.ID)
+		}
+		return ids
+	}
+	// FPGA 1 has one tenant in use, FPGA 2 has two, FPGAs 0 and 3 are free
+	for _, used := range []*FPGATenantDevice{
+		plugin.devices[1].children[0],
+		plugin.devices[2].children[0],
+		plugin.devices[2].children[1],
+	} {
+		if err := used.setState(USED); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// kubelet offers the free tenants in reverse order, which is kept for
+	// tenants of the same FPGA
+	var available []string
+	for _, device := range plugin.devices {
+		for _, child := range device.children {
+			if child.status == FREE {
+				available = append([]string{child.ID}, available...)
+			}
+		}
+	}
+	tests := []struct {
+		name        string
+		policy      string
+		mustInclude []string
+		size        int
+		preferred   []string
+	}{
+		{"fewest free blocked first", ALLOCATION_PACKED, nil, 1, []string{board(2)[2]}},
+		{"then other blocked", ALLOCATION_PACKED, nil, 3, []string{board(2)[2], board(1)[2], board(1)[1]}},
+		{"then board order", ALLOCATION_PACKED, nil, 4, []string{board(2)[2], board(1)[2], board(1)[1], board(0)[2]}},
+		{"needed first", ALLOCATION_PACKED, []string{board(3)[1]}, 3, []string{board(3)[1], board(3)[2], board(3)[0]}},
+		{"needed then blocked", ALLOCATION_PACKED, []string{board(0)[0]}, 4, []string{board(0)[0], board(0)[2], board(0)[1], board(2)[2]}},
+		{"none", ALLOCATION_NONE, nil, 2, available[:2]},
+	}
+	for _, test := range tests {
+		plugin.allocationPolicy = test.policy
+		preferred := tenants.preferredAllocation(available, test.mustInclude, test.size)
+		if !equalStrings(preferred, test.preferred) {
+			t.Errorf("%s: preferred %v, want %v", test.name, preferred, test.preferred)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A PR region of an FPGA, as the tenant class it belongs to and its index
+// within that class. Backends that find regions by index only, e.g. DFL
+// ports, leave the class alone.
+type Region struct {
+	Class string
+	Index int
+}
+
+// Passed as the region to backends to mean the entire FPGA rather than one
+// of its PR regions
+var WHOLE_FPGA = Region{Index: -1}
+
+func (region Region) String() string {
+	if region == WHOLE_FPGA {
+		return "entire FPGA"
+	}
+	return join_strings(region.Class, "-", strconv.Itoa(region.Index))
+}
+
+// Everything hardware specific about a kind of FPGA: how to find them, how to
+// program and wipe them, how to tell whether they are healthy and what a
+// container needs to use them. The plugins only talk to the hardware through
+// a backend, so that several backends can run side by side, each FPGA being
+// handled by the backend that found it.
+//
+// Backends are called without any plugin lock held, except for AllocateSpec,
+// so Program, Reset and the health probes should only look at what doesn't
+// change after discovery.
+type Backend interface {
+	// The name the backend is selected by, see -backends
+	Name() string
+	// Find the FPGAs of this backend that are connected right now. FPGAs
+	// that were found before are dropped by the caller, by their identity.
+	Discover() []*DiscoveredFPGA
+	// Program a bitstream into an FPGA, or into one of its PR regions, and
+	// give up at the deadline. The bitstream is a name relative to the
+	// bitstream directory.
+	Program(device *FPGADevice, region Region, bitstream string, deadline time.Time) error
+	// Wipe an FPGA, or one of its PR regions, e.g. by programming the given
+	// blank bitstream, which may be empty
+	Reset(device *FPGADevice, region Region, blankBitstream string) error
+	// The probes run on the FPGAs of this backend by the health monitor, on
+	// top of the thresholds of their board
+	Health() []HealthProbe
+	// What a container needs to use an FPGA, or one of its PR regions, on
+	// top of what the config gives it
+	AllocateSpec(device *FPGADevice, region Region) *ContainerSpec
+}
+
+// Implemented by backends that know which bitstream is loaded into their
+// FPGAs, it is shown by the admin API
+type BitstreamReporter interface {
+	// The bitstream loaded into an FPGA or one of its PR regions, empty if
+	// unknown
+	LoadedBitstream(device *FPGADevice, region Region) string
+}
+
+// Implemented by backends whose FPGAs have a fixed number of PR regions, e.g.
+// one per DFL port. Their boards are either not divided into tenants, or
+// divided into one tenant class with a tenant per PR region.
+type RegionCounter interface {
+	RegionCount(device *FPGADevice) int
+}
+
+// Implemented by backends that can't do everything a board config or pod may
+// ask for, e.g. program the bitstreams of XRT cards
+type BoardChecker interface {
+	CheckBoard(device *FPGADevice, board *BoardConfig) error
+	// Whether the bitstream a pod chose can be programmed
+	CheckBitstream(device *FPGADevice, bitstream string) error
+}
+
+// Check that the backend of an FPGA can do what the config of its board asks
+// for, nil meaning the board isn't in the config
+func checkBoard(device *FPGADevice, board *BoardConfig) error {
+	if board == nil {
+		return nil
+	}
+	if checker, ok := device.backend.(BoardChecker); ok {
+		if err := checker.CheckBoard(device, board); err != nil {
+			return err
+		}
+	}
+	return checkRegions(device, board.Tenants)
+}
+
+// Check that the backend of an FPGA can program the bitstream a pod chose
+func checkBitstream(device *FPGADevice, bitstream string) error {
+	if checker, ok := device.backend.(BoardChecker); ok {
+		return checker.CheckBitstream(device, bitstream)
+	}
+	return nil
+}
+
+// Check that a tenant layout fits the PR regions of an FPGA, for backends
+// that know how many it has
+func checkRegions(device *FPGADevice, tenants []TenantConfig) error {
+	counter, ok := device.backend.(RegionCounter)
+	if !ok || len(tenants) == 0 {
+		return nil
+	}
+	count := counter.RegionCount(device)
+	if len(tenants) != 1 {
+		return fmt.Errorf("FPGA has %d PR regions, which must make up a single tenant class, got %d classes", count, len(tenants))
+	}
+	if tenants[0].Count != count {
+		return fmt.Errorf("FPGA has %d PR regions, but tenant class '%s' has %d tenants", count, tenants[0].Name, tenants[0].Count)
+	}
+	return nil
+}
+
+// An FPGA found by a backend
+type DiscoveredFPGA struct {
+	vendorName string
+	boardName  string
+	// Identifies the FPGA among those of its board, see ids.go
+	identity string
+	// The hardware specific fields of the device, e.g. its PCI address or
+	// its files. The rest is filled in when it is added to its plugin.
+	device *FPGADevice
+}
+
+// Host files and environment a container gets for a device
+type ContainerSpec struct {
+	// Device nodes passed to the container
+	DeviceNodes []string
+	// Paths mounted into the container
+	Mounts []string
+	// Environment variables set in the container
+	Envs map[string]string
+	// Annotations passed to the container runtime
+	Annotations map[string]string
+}
+
+// What backends are created with, every backend takes what it needs
+type BackendOptions struct {
+	// Where the host sysfs is mounted, usually `/sys`
+	SysfsRoot string
+	// Where the host device nodes are, usually `/dev`
+	DevRoot string
+	// Programs FPGAs through fpga_manager
+	Manager *FPGAManager
+	// The config the plugin started with
+	Config *Config
+}
+
+// Creates a backend, registered under its name
+type BackendFactory func(options *BackendOptions) (Backend, error)
+
+var backendFactories = map[string]BackendFactory{}
+
+// Backends register themselves from init, so adding a backend doesn't
+// require touching anything else
+func registerBackend(name string, factory BackendFactory) {
+	if _, ok := backendFactories[name]; ok {
+		panic(fmt.Sprintf("backend '%s' registered twice", name))
+	}
+	backendFactories[name] = factory
+}
+
+// The names of all registered backends, sorted
+func backendNames() []string {
+	var names []string
+	for name := range backendFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Create the backends in the given comma separated list. FPGAs are looked
+// for in that order, so if two backends find the same FPGA, the first wins.
+func newBackends(names string, options *BackendOptions) ([]Backend, error) {
+	var backends []Backend
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		factory, ok := backendFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown backend '%s', known backends are %s", name, strings.Join(backendNames(), ", "))
+		}
+		backend, err := factory(options)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create backend '%s': %v", name, err)
+		}
+		backends = append(backends, backend)
+		log.WithFields(log.Fields{
+			"Backend": name,
+		}).Info("Using backend.")
+	}
+	return backends, nil
+}
+
+// Programs and wipes FPGAs through their fpga_manager, and gives containers
+// the files found at discovery time. Shared by the backends of FPGAs that
+// have an fpga_manager.
+type fpgaManagerBackend struct{}
+
+func (backend *fpgaManagerBackend) Program(device *FPGADevice, region Region, bitstream string, deadline time.Time) error {
+	if device.manager == nil || device.managerName == "" {
+		return fmt.Errorf("FPGA device '%s' has no fpga_manager to program '%s' with", device.ID, bitstream)
+	}
+	firmware, err := device.manager.resolveBitstream(bitstream)
+	if err != nil {
+		return err
+	}
+	return device.manager.programUntil(device.managerName, firmware, region != WHOLE_FPGA, deadline)
+}
+
+func (backend *fpgaManagerBackend) Reset(device *FPGADevice, region Region, blankBitstream string) error {
+	if device.manager == nil || device.managerName == "" || blankBitstream == "" {
+		log.WithFields(log.Fields{
+			"ID":     device.ID,
+			"Region": region.String(),
+		}).Debug("No way to wipe FPGA device, skipping reset")
+		return nil
+	}
+	return device.manager.Program(device.managerName, blankBitstream, region != WHOLE_FPGA)
+}
+
+func (backend *fpgaManagerBackend) AllocateSpec(device *FPGADevice, region Region) *ContainerSpec {
+	if region != WHOLE_FPGA {
+		return &ContainerSpec{}
+	}
+	return &ContainerSpec{
+		DeviceNodes: device.deviceNodes,
+		Mounts:      device.mounts,
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The checkpoint keeps track of which devices are in use, so that a restarted
+// plugin doesn't hand them out again. Only devices in use or being wiped are
+// recorded, and restored as USED. BLOCKED devices follow from them, and
+// everything else starts FREE. On disk it looks
+// like this:
+//
+//	{
+//	  "data": {"used": {"fidus.com/sidewinder-100": ["fidus.com/sidewinder-100-mpsoc-size1-1"]}},
+//	  "checksum": 1234567890
+//	}
+//
+// where the checksum is the FNV-1a hash of `data`, as serialized in the file.
+type Checkpoint struct {
+	path string
+	// Used device IDs, by the full name of the FPGA plugin they belong to.
+	// This includes the tenants of that plugin
+	used  map[string][]string
+	mutex sync.Mutex
+}
+
+type checkpointData struct {
+	Used map[string][]string `json:"used"`
+}
+
+type checkpointFile struct {
+	Data     json.RawMessage `json:"data"`
+	Checksum uint32          `json:"checksum"`
+}
+
+func NewCheckpoint(path string) *Checkpoint {
+	return &Checkpoint{
+		path: path,
+		used: map[string][]string{},
+	}
+}
+
+func checksum(data []byte) uint32 {
+	hash := fnv.New32a()
+	hash.Write(data)
+	return hash.Sum32()
+}
+
+// Read the checkpoint from disk. A missing checkpoint is not an error, it
+// just means nothing is in use.
+func (checkpoint *Checkpoint) Load() error {
+	checkpoint.mutex.Lock()
+	defer checkpoint.mutex.Unlock()
+	dat, err := ioutil.ReadFile(checkpoint.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var file checkpointFile
+	err = json.Unmarshal(dat, &file)
+	if err != nil {
+		return fmt.Errorf("cannot parse checkpoint '%s': %v", checkpoint.path, err)
+	}
+	if checksum(file.Data) != file.Checksum {
+		return fmt.Errorf("checkpoint '%s' is corrupted, checksum mismatch", checkpoint.path)
+	}
+	var data checkpointData
+	err = json.Unmarshal(file.Data, &data)
+	if err != nil {
+		return fmt.Errorf("cannot parse checkpoint '%s': %v", checkpoint.path, err)
+	}
+	if data.Used != nil {
+		checkpoint.used = data.Used
+	}
+	return nil
+}
+
+// Write the checkpoint to disk. Must be called with the checkpoint mutex held.
+func (checkpoint *Checkpoint) write() error {
+	data, err := json.Marshal(checkpointData{Used: checkpoint.used})
+	if err != nil {
+		return err
+	}
+	dat, err := json.Marshal(checkpointFile{Data: data, Checksum: checksum(data)})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(checkpoint.path, dat)
+}
+
+// Record the used devices of one plugin and its tenants. Must be called
+// with the plugin mutex held.
+func (plugin *FPGADevicePlugin) saveCheckpoint() {
+	if plugin.checkpoint == nil {
+		return
+	}
+	var used []string
+	for _, device := range plugin.devices {
+		if device.status.inUse() || device.status == RESETTING {
+			used = append(used, device.ID)
+		}
+		for _, child := range device.children {
+			if child.status.inUse() || child.status == RESETTING {
+				used = append(used, child.ID)
+			}
+		}
+	}
+	checkpoint := plugin.checkpoint
+	checkpoint.mutex.Lock()
+	defer checkpoint.mutex.Unlock()
+	if len(used) == 0 {
+		delete(checkpoint.used, plugin.fullName())
+	} else {
+		checkpoint.used[plugin.fullName()] = used
+	}
+	err := checkpoint.write()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Path":  checkpoint.path,
+			"Error": err,
+		}).Error("Failed to write checkpoint")
+	}
+}
+
+// Mark the devices recorded in the checkpoint as used again, and attach the
+// checkpoint to the plugins. Devices that are no longer there are dropped,
+// and devices that are not in the checkpoint stay FREE. This must be done
+// before the plugins are started.
+func (checkpoint *Checkpoint) Restore(plugins []*FPGADevicePlugin) {
+	checkpoint.mutex.Lock()
+	used := checkpoint.used
+	checkpoint.used = map[string][]string{}
+	checkpoint.mutex.Unlock()
+	for _, plugin := range plugins {
+		plugin.mutex.Lock()
+		plugin.checkpoint = checkpoint
+		for _, id := range used[plugin.fullName()] {
+			if !plugin.restoreUsed(id) {
+				log.WithFields(log.Fields{
+					"Resource": plugin.fullName(),
+					"ID":       id,
+				}).Warn("Device in checkpoint no longer exists, dropping it")
+			}
+		}
+		delete(used, plugin.fullName())
+		// Rewrite our part of the checkpoint without the dropped devices
+		plugin.saveCheckpoint()
+		plugin.mutex.Unlock()
+	}
+	for resource := range used {
+		log.WithFields(log.Fields{
+			"Resource": resource,
+		}).Warn("Resource in checkpoint no longer exists, dropping it")
+	}
+}
+
+// Must be called with the plugin mutex held
+func (plugin *FPGADevicePlugin) restoreUsed(id string) bool {
+	if exists, index := plugin.deviceExists(id); exists {
+		if plugin.devices[index].status == FREE {
+			logRestoreError(id, plugin.devices[index].SetUsed())
+		}
+		return true
+	}
+	for _, childPlugin := range plugin.childPlugins {
+		if exists, index := childPlugin.deviceExists(id); exists {
+			if childPlugin.devices[index].status == FREE {
+				logRestoreError(id, childPlugin.devices[index].SetUsed())
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func logRestoreError(id string, err error) {
+	if err != nil {
+		log.WithFields(log.Fields{
+			"ID":    id,
+			"Error": err,
+		}).Warn("Device in checkpoint can't be used anymore, dropping it")
+	}
+}
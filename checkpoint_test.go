@@ -0,0 +1,140 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// The devices in use are written to the checkpoint and restored by a new
+// plugin, that may have found different devices in the meantime
+func TestCheckpointRoundTrip(t *testing.T) {
+	tree := newFakeTree(t)
+	checkpointPath := tree.path("checkpoint.json")
+	config := simConfig(2, TenantConfig{Name: "tenant", Count: 2})
+	plugin := newSimPlugins(t, config)[0]
+	plugin.checkpoint = NewCheckpoint(checkpointPath)
+	plugin.mutex.Lock()
+	if err := plugin.devices[0].SetUsed(); err != nil {
+		t.Fatal(err)
+	}
+	if err := plugin.devices[1].children[1].SetUsed(); err != nil {
+		t.Fatal(err)
+	}
+	plugin.saveCheckpoint()
+	plugin.mutex.Unlock()
+	used := plugin.devices[0].ID
+	usedTenant := plugin.devices[1].children[1].ID
+
+	// Add a device the checkpoint doesn't know, and one the plugin doesn't
+	// have anymore
+	checkpoint := NewCheckpoint(checkpointPath)
+	if err := checkpoint.Load(); err != nil {
+		t.Fatal(err)
+	}
+	gone := "example.com/sim-board-gone"
+	checkpoint.used[plugin.fullName()] = append(checkpoint.used[plugin.fullName()], gone)
+	config.Simulated[0].Count = 3
+	plugin = newSimPlugins(t, config)[0]
+	device := plugin.devices[0]
+	if err := device.backend.Program(device, WHOLE_FPGA, "running.bin", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.Restore([]*FPGADevicePlugin{plugin})
+
+	want := map[string]DeviceState{
+		used:                             USED,
+		plugin.devices[0].children[0].ID: BLOCKED,
+		plugin.devices[0].children[1].ID: BLOCKED,
+		plugin.devices[1].ID:             BLOCKED,
+		plugin.devices[1].children[0].ID: FREE,
+		usedTenant:                       USED,
+		plugin.devices[2].ID:             FREE,
+		plugin.devices[2].children[0].ID: FREE,
+		plugin.devices[2].children[1].ID: FREE,
+	}
+	for _, device := range plugin.devices {
+		if device.status != want[device.ID] {
+			t.Errorf("%s restored as %s, want %s", device.ID, device.status, want[device.ID])
+		}
+		for _, child := range device.children {
+			if child.status != want[child.ID] {
+				t.Errorf("%s restored as %s, want %s", child.ID, child.status, want[child.ID])
+			}
+		}
+	}
+	// Devices restored in use are left alone
+	if loaded := device.backend.(BitstreamReporter).LoadedBitstream(device, WHOLE_FPGA); loaded != "running.bin" {
+		t.Errorf("%s has %q loaded after restoring, want running.bin", device.ID, loaded)
+	}
+	// The missing device is dropped from the checkpoint
+	checkpoint = NewCheckpoint(checkpointPath)
+	if err := checkpoint.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if saved := checkpoint.used[plugin.fullName()]; !equalStrings(saved, []string{used, usedTenant}) {
+		t.Errorf("checkpoint has %v in use after restoring, want %v", saved, []string{used, usedTenant})
+	}
+}
+
+// A checkpoint that can't be trusted is refused, and leaves every device
+// FREE
+func TestCheckpointCorrupt(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(1))[0]
+	data, err := json.Marshal(checkpointData{Used: map[string][]string{plugin.fullName(): {plugin.devices[0].ID}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := json.Marshal(checkpointFile{Data: data, Checksum: checksum(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatch, err := json.Marshal(checkpointFile{Data: data, Checksum: checksum(data) + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		content string
+		used    bool
+	}{
+		{"valid", string(valid), true},
+		{"checksum mismatch", string(mismatch), false},
+		{"truncated", string(valid[:len(valid)/2]), false},
+		{"garbage", "not a checkpoint", false},
+	}
+	for _, test := range tests {
+		tree := newFakeTree(t)
+		tree.write("checkpoint.json", test.content)
+		checkpoint := NewCheckpoint(tree.path("checkpoint.json"))
+		err := checkpoint.Load()
+		if (err == nil) != test.used {
+			t.Errorf("%s: loading returned %v", test.name, err)
+		}
+		plugin := newSimPlugins(t, simConfig(1))[0]
+		checkpoint.Restore([]*FPGADevicePlugin{plugin})
+		want := FREE
+		if test.used {
+			want = USED
+		}
+		if plugin.devices[0].status != want {
+			t.Errorf("%s: %s restored as %s, want %s", test.name, plugin.devices[0].ID, plugin.devices[0].status, want)
+		}
+	}
+}
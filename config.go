@@ -0,0 +1,301 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The configuration file describes how each board is divided into PR regions
+// (tenants). It is YAML, and since JSON is a subset of YAML, JSON files work
+// too. Example:
+//
+//	boards:
+//	  - vendor: fidus.com
+//	    board: sidewinder-100
+//	    blankBitstream: sidewinder-100-blank.bin
+//	    bitstream: sidewinder-100-accelerator.bin
+//	    tenants:
+//	      - name: tenant
+//	        count: 6
+//	        blankBitstream: sidewinder-100-tenant-{region}-blank.bin
+//	        bitstream: sidewinder-100-tenant-{region}-accelerator.bin
+//	        region:
+//	          baseAddress: 0xa0000000
+//	          stride: 0x1000000
+//	          devices: [/dev/galapagos-region{region}]
+//	    shell:
+//	      devices: [/dev/galapagos-shell]
+//	simulated:
+//	  - vendor: example.com
+//	    board: sim-board
+//	    count: 2
+//	    programLatency: 2s
+//	    resetLatency: 500ms
+//	    programFailureRate: 0.05
+//
+// Boards that are not listed are only advertised as entire FPGAs.
+// Blank bitstreams are used to wipe FPGAs and PR regions once they are
+// released, they are names relative to the firmware directory. Accelerator
+// bitstreams are programmed before containers start, they are names relative
+// to the bitstream directory. The `{region}`
+// placeholder is replaced with the index of the PR region within its class,
+// and the `{pci}` placeholder with the PCI address of the FPGA.
+// Simulated boards are only found by the sim backend, and can be divided into
+// tenants under `boards` like any other.
+type Config struct {
+	Boards    []BoardConfig          `yaml:"boards" json:"boards"`
+	Simulated []SimulatedBoardConfig `yaml:"simulated" json:"simulated"`
+}
+
+type BoardConfig struct {
+	Vendor  string         `yaml:"vendor" json:"vendor"`
+	Board   string         `yaml:"board" json:"board"`
+	Tenants []TenantConfig `yaml:"tenants" json:"tenants"`
+	// Optional, FPGAs are not wiped if empty
+	BlankBitstream string `yaml:"blankBitstream" json:"blankBitstream"`
+	// Optional, FPGAs are given to containers as they are if empty
+	Bitstream string `yaml:"bitstream" json:"bitstream"`
+	// Optional, the Galapagos shell control interface given to every tenant
+	Shell AccessConfig `yaml:"shell" json:"shell"`
+	// Optional, sensor thresholds of the health monitor
+	Health HealthConfig `yaml:"health" json:"health"`
+}
+
+// A board the sim backend pretends is connected, `count` times. Programming
+// and wiping its FPGAs take the given latencies, and fail at the given rates,
+// between 0 and 1.
+type SimulatedBoardConfig struct {
+	Vendor             string        `yaml:"vendor" json:"vendor"`
+	Board              string        `yaml:"board" json:"board"`
+	Count              int           `yaml:"count" json:"count"`
+	ProgramLatency     time.Duration `yaml:"programLatency" json:"programLatency"`
+	ResetLatency       time.Duration `yaml:"resetLatency" json:"resetLatency"`
+	ProgramFailureRate float64       `yaml:"programFailureRate" json:"programFailureRate"`
+	ResetFailureRate   float64       `yaml:"resetFailureRate" json:"resetFailureRate"`
+}
+
+// What the hwmon sensors of a healthy FPGA report. Temperatures are in
+// degrees Celsius and voltages in volts.
+type HealthConfig struct {
+	// Not checked if 0
+	MaxTemperature float64         `yaml:"maxTemperature" json:"maxTemperature"`
+	Voltages       []VoltageConfig `yaml:"voltages" json:"voltages"`
+}
+
+// The range of one voltage sensor, given by its hwmon label or name (e.g. in0)
+type VoltageConfig struct {
+	Sensor string  `yaml:"sensor" json:"sensor"`
+	Min    float64 `yaml:"min" json:"min"`
+	Max    float64 `yaml:"max" json:"max"`
+}
+
+// One class of tenants on a board, every class is advertised as a separate
+// resource named `vendor/board-name`.
+type TenantConfig struct {
+	Name  string `yaml:"name" json:"name"`
+	Count int    `yaml:"count" json:"count"`
+	// Optional, PR regions are not wiped if empty
+	BlankBitstream string `yaml:"blankBitstream" json:"blankBitstream"`
+	// Optional, PR regions are given to containers as they are if empty
+	Bitstream string `yaml:"bitstream" json:"bitstream"`
+	// Optional, how a container reaches its PR region
+	Region RegionConfig `yaml:"region" json:"region"`
+}
+
+// Host files a container is given access to. Device nodes are passed as
+// devices, other paths are mounted at the same path in the container.
+type AccessConfig struct {
+	Devices []string `yaml:"devices" json:"devices"`
+	Mounts  []string `yaml:"mounts" json:"mounts"`
+}
+
+// The register window of every PR region in a tenant class. Region `i` starts
+// at `baseAddress + i * stride`.
+type RegionConfig struct {
+	BaseAddress  uint64 `yaml:"baseAddress" json:"baseAddress"`
+	Stride       uint64 `yaml:"stride" json:"stride"`
+	AccessConfig `yaml:",inline"`
+}
+
+const regionPlaceholder = "{region}"
+const pciPlaceholder = "{pci}"
+
+// Fill the region placeholder of a bitstream name
+func regionBitstream(bitstream string, region int) string {
+	return strings.Replace(bitstream, regionPlaceholder, strconv.Itoa(region), -1)
+}
+
+// Fill the placeholders of a host path
+func hostPath(path string, region int, pciAddress string) string {
+	path = regionBitstream(path, region)
+	return strings.Replace(path, pciPlaceholder, pciAddress, -1)
+}
+
+// Whether the configured base address of a region should be given to containers
+func (region *RegionConfig) hasAddress() bool {
+	return region.BaseAddress != 0 || region.Stride != 0
+}
+
+func (region *RegionConfig) address(index int) uint64 {
+	return region.BaseAddress + uint64(index)*region.Stride
+}
+
+func (access *AccessConfig) validate() error {
+	for _, path := range append(append([]string{}, access.Devices...), access.Mounts...) {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("path '%s' is not absolute", path)
+		}
+	}
+	return nil
+}
+
+// Boards found through device trees, these don't have PCIe IDs so they are
+// not in `knownPCIeBoards` or `knownDFLBoards`.
+var knownMPSoCBoards = [][2]string{
+	{"fidus.com", "sidewinder-100"},
+}
+
+// Kubernetes resource names are `domain/name`, where the name part must be a
+// qualified name of at most 63 characters.
+var resourceNameRegexp = regexp.MustCompile("^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$")
+
+const maxResourceNameLength = 63
+
+func isKnownBoard(vendorName string, boardName string) bool {
+	for _, board := range knownMPSoCBoards {
+		if board[0] == vendorName && board[1] == boardName {
+			return true
+		}
+	}
+	for _, board := range append(append([]pcieBoard{}, knownPCIeBoards...), knownDFLBoards...) {
+		if board.vendorName == vendorName && board.boardName == boardName {
+			return true
+		}
+	}
+	return false
+}
+
+func validResourceName(name string) bool {
+	return len(name) <= maxResourceNameLength && resourceNameRegexp.MatchString(name)
+}
+
+// Read and validate the configuration file
+func loadConfig(configPath string) (*Config, error) {
+	config := &Config{}
+	if configPath == "" {
+		return config, nil
+	}
+	dat, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.UnmarshalStrict(dat, config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse config file '%s': %v", configPath, err)
+	}
+	err = config.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file '%s': %v", configPath, err)
+	}
+	return config, nil
+}
+
+func (simulated *SimulatedBoardConfig) validate() error {
+	if !validResourceName(simulated.Vendor) || !validResourceName(simulated.Board) {
+		return errors.New("vendor and board must be valid resource names")
+	}
+	if simulated.Count <= 0 {
+		return fmt.Errorf("count must be positive, got %d", simulated.Count)
+	}
+	if simulated.ProgramLatency < 0 || simulated.ResetLatency < 0 {
+		return errors.New("latencies must not be negative")
+	}
+	if simulated.ProgramFailureRate < 0 || simulated.ProgramFailureRate > 1 || simulated.ResetFailureRate < 0 || simulated.ResetFailureRate > 1 {
+		return errors.New("failure rates must be between 0 and 1")
+	}
+	return nil
+}
+
+func (config *Config) validate() error {
+	seenSimulated := map[string]bool{}
+	for _, simulated := range config.Simulated {
+		boardFullName := join_strings(simulated.Vendor, "/", simulated.Board)
+		if err := simulated.validate(); err != nil {
+			return fmt.Errorf("simulated board '%s': %v", boardFullName, err)
+		}
+		if seenSimulated[boardFullName] {
+			return fmt.Errorf("simulated board '%s' is defined more than once", boardFullName)
+		}
+		seenSimulated[boardFullName] = true
+	}
+	seenBoards := map[string]bool{}
+	for _, board := range config.Boards {
+		if !isKnownBoard(board.Vendor, board.Board) && !seenSimulated[join_strings(board.Vendor, "/", board.Board)] {
+			return fmt.Errorf("unknown board '%s/%s'", board.Vendor, board.Board)
+		}
+		boardFullName := join_strings(board.Vendor, "/", board.Board)
+		if seenBoards[boardFullName] {
+			return fmt.Errorf("board '%s' is defined more than once", boardFullName)
+		}
+		seenBoards[boardFullName] = true
+		for _, voltage := range board.Health.Voltages {
+			if voltage.Sensor == "" || voltage.Min > voltage.Max {
+				return fmt.Errorf("voltage sensor '%s' of board '%s' must have a name and a valid range", voltage.Sensor, boardFullName)
+			}
+		}
+		if err := board.Shell.validate(); err != nil {
+			return fmt.Errorf("shell of board '%s': %v", boardFullName, err)
+		}
+		seenTenants := map[string]bool{}
+		for _, tenant := range board.Tenants {
+			if tenant.Count <= 0 {
+				return fmt.Errorf("tenant '%s' of board '%s' must have a positive count, got %d", tenant.Name, boardFullName, tenant.Count)
+			}
+			if !validResourceName(tenant.Name) || !validResourceName(join_strings(board.Board, "-", tenant.Name)) {
+				return fmt.Errorf("tenant '%s' of board '%s' is not a valid resource name", tenant.Name, boardFullName)
+			}
+			if seenTenants[tenant.Name] {
+				return fmt.Errorf("tenant '%s' of board '%s' is defined more than once", tenant.Name, boardFullName)
+			}
+			seenTenants[tenant.Name] = true
+			if err := tenant.Region.validate(); err != nil {
+				return fmt.Errorf("region of tenant '%s' of board '%s': %v", tenant.Name, boardFullName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Find the configuration of a board, returns nil if the board is not configured
+func (config *Config) board(vendorName string, boardName string) *BoardConfig {
+	for index, board := range config.Boards {
+		if board.Vendor == vendorName && board.Board == boardName {
+			return &config.Boards[index]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// The example config is valid
+func TestLoadExampleConfig(t *testing.T) {
+	config, err := loadConfig("config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Boards) == 0 {
+		t.Error("example config has no boards")
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"unknown board", `
+boards:
+  - vendor: example.com
+    board: unknown
+`, "unknown board 'example.com/unknown'"},
+		{"zero count", `
+boards:
+  - vendor: xilinx.com
+    board: alveo
+    tenants:
+      - name: tenant
+        count: 0
+`, "tenant 'tenant' of board 'xilinx.com/alveo' must have a positive count, got 0"},
+		{"negative count", `
+boards:
+  - vendor: xilinx.com
+    board: alveo
+    tenants:
+      - name: tenant
+        count: -2
+`, "tenant 'tenant' of board 'xilinx.com/alveo' must have a positive count, got -2"},
+		{"invalid tenant name", `
+boards:
+  - vendor: xilinx.com
+    board: alveo
+    tenants:
+      - name: big tenant
+        count: 1
+`, "tenant 'big tenant' of board 'xilinx.com/alveo' is not a valid resource name"},
+		{"tenant name ending in a dash", `
+boards:
+  - vendor: xilinx.com
+    board: alveo
+    tenants:
+      - name: tenant-
+        count: 1
+`, "tenant 'tenant-' of board 'xilinx.com/alveo' is not a valid resource name"},
+		{"tenant resource name too long", `
+boards:
+  - vendor: xilinx.com
+    board: alveo
+    tenants:
+      - name: ` + strings.Repeat("t", 60) + `
+        count: 1
+`, "tenant '" + strings.Repeat("t", 60) + "' of board 'xilinx.com/alveo' is not a valid resource name"},
+		{"duplicate tenant class", `
+boards:
+  - vendor: xilinx.com
+    board: alveo
+    tenants:
+      - name: tenant
+        count: 1
+      - name: tenant
+        count: 2
+`, "tenant 'tenant' of board 'xilinx.com/alveo' is defined more than once"},
+		{"duplicate board", `
+boards:
+  - vendor: xilinx.com
+    board: alveo
+  - vendor: xilinx.com
+    board: alveo
+`, "board 'xilinx.com/alveo' is defined more than once"},
+		{"invalid simulated board name", `
+simulated:
+  - vendor: example.com
+    board: sim board
+    count: 1
+`, "simulated board 'example.com/sim board': vendor and board must be valid resource names"},
+		{"unknown field", `
+boards:
+  - vendor: xilinx.com
+    board: alveo
+    tenant: []
+`, "cannot parse config file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := newFakeTree(t)
+			tree.write("config.yaml", test.config)
+			_, err := loadConfig(tree.path("config.yaml"))
+			if err == nil {
+				t.Fatalf("loaded invalid config, want error %q", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %q, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Where sysfs and device nodes are on the host. The plugin may see sysfs
+// somewhere else (see -sysfs-root), but kubelet needs host paths.
+const (
+	hostSysfsRoot string = "/sys"
+	hostDevRoot   string = "/dev"
+)
+
+// sysfs classes whose devices are mounted into the containers of an FPGA
+var fpgaSysfsClasses = []string{"fpga_manager", "fpga_region"}
+
+// Drivers that create device nodes for PCIe FPGAs. They list their nodes in a
+// directory of the same name under the PCI function, e.g.
+// `/sys/bus/pci/devices/0000:65:00.1/xdma/xdma0_user`.
+var pcieDeviceNodeClasses = []string{"xdma", "uio"}
+
+// Translate a path under our sysfs root to the same path on the host
+func toHostSysfsPath(sysfsRoot string, sysfsPath string) string {
+	root, err := filepath.EvalSymlinks(sysfsRoot)
+	if err != nil {
+		root = sysfsRoot
+	}
+	relative, err := filepath.Rel(root, sysfsPath)
+	if err != nil {
+		return sysfsPath
+	}
+	return path.Join(hostSysfsRoot, relative)
+}
+
+// Find the devices of a sysfs class, as resolved paths. If parent is given,
+// only devices that sit under it in the device tree are returned.
+func findSysfsClassDevices(sysfsRoot string, class string, parent string) []string {
+	var devices []string
+	classPath := path.Join(sysfsRoot, "class", class)
+	entries, err := ioutil.ReadDir(classPath)
+	if err != nil {
+		return devices
+	}
+	for _, entry := range entries {
+		resolved, err := filepath.EvalSymlinks(path.Join(classPath, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if parent != "" && !strings.HasPrefix(resolved, parent+"/") {
+			continue
+		}
+		devices = append(devices, resolved)
+	}
+	return devices
+}
+
+// The PCI functions in the same slot as the given one, including itself.
+// Alveo cards have their user function, where the drivers attach, next to
+// the management function we discover them by.
+func pcieSlotFunctions(sysfsRoot string, pciAddress string) []string {
+	var functions []string
+	busPath := path.Join(sysfsRoot, "bus/pci/devices")
+	slot := strings.TrimSuffix(pciAddress, path.Ext(pciAddress))
+	entries, err := ioutil.ReadDir(busPath)
+	if err != nil {
+		return functions
+	}
+	for _, entry := range entries {
+		if strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())) == slot {
+			functions = append(functions, entry.Name())
+		}
+	}
+	return functions
+}
+
+// Record the host files that give a container access to an MPSoC FPGA: its
+// fpga_manager and every FPGA region, as there is only one FPGA. Also record
+// the sensors used to monitor its health.
+func (device *FPGADevice) findMPSoCFiles(sysfsRoot string) {
+	if device.managerName != "" {
+		if resolved, err := filepath.EvalSymlinks(path.Join(sysfsRoot, "class/fpga_manager", device.managerName)); err == nil {
+			device.mounts = append(device.mounts, toHostSysfsPath(sysfsRoot, resolved))
+		}
+	}
+	for _, region := range findSysfsClassDevices(sysfsRoot, "fpga_region", "") {
+		device.mounts = append(device.mounts, toHostSysfsPath(sysfsRoot, region))
+	}
+	// Likewise, every sensor of the SoC is a sensor of the FPGA
+	device.hwmon = findSysfsClassDevices(sysfsRoot, "hwmon", "")
+}
+
+// Record the host files that give a container access to a PCIe FPGA: the FPGA
+// class devices of its PCI functions and the device nodes of their drivers.
+// Also record the sensors of its PCI functions used to monitor its health,
+// and the first fpga_manager among them, which programs and wipes the card.
+func (device *FPGADevice) findPCIeFiles(sysfsRoot string) {
+	busPath := path.Join(sysfsRoot, "bus/pci/devices")
+	for _, function := range pcieSlotFunctions(sysfsRoot, device.pciAddress) {
+		functionPath, err := filepath.EvalSymlinks(path.Join(busPath, function))
+		if err != nil {
+			continue
+		}
+		for _, class := range fpgaSysfsClasses {
+			for _, classDevice := range findSysfsClassDevices(sysfsRoot, class, functionPath) {
+				device.mounts = append(device.mounts, toHostSysfsPath(sysfsRoot, classDevice))
+				if class == "fpga_manager" && device.managerName == "" {
+					device.managerName = path.Base(classDevice)
+				}
+			}
+		}
+		device.hwmon = append(device.hwmon, findSysfsClassDevices(sysfsRoot, "hwmon", functionPath)...)
+		for _, class := range pcieDeviceNodeClasses {
+			entries, err := ioutil.ReadDir(path.Join(functionPath, class))
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				device.deviceNodes = append(device.deviceNodes, path.Join(hostDevRoot, entry.Name()))
+			}
+		}
+	}
+}
+
+func (device *FPGADevice) logFiles() {
+	log.WithFields(log.Fields{
+		"ID":          device.ID,
+		"Address":     device.pciAddress,
+		"Mounts":      device.mounts,
+		"DeviceNodes": device.deviceNodes,
+		"Hwmon":       device.hwmon,
+	}).Debug("FPGA device files")
+}
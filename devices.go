@@ -17,164 +17,500 @@
 package main
 
 import (
+	"fmt"
+	"time"
+
 	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
 	log "github.com/sirupsen/logrus"
 )
 
+// The state of a device. Only the first four can be reached by whole FPGAs
+// and tenants alike in the simple case, the others are taken while an
+// operation on the device is in progress.
+type DeviceState int
+
 const (
-	FREE      int = 0
-	USED      int = 1
-	BLOCKED   int = 2
-	UNHEALTHY int = 3
+	// Can be allocated
+	FREE DeviceState = 0
+	// Allocated to a container that was started
+	USED DeviceState = 1
+	// Can't be allocated because it shares the FPGA with devices in use
+	BLOCKED DeviceState = 2
+	// Out of service until it is freed again
+	UNHEALTHY DeviceState = 3
+	// Being wiped after its container released it
+	RESETTING DeviceState = 4
+	// Being programmed with the bitstream of its container, which starts
+	// once this is done
+	PROGRAMMING DeviceState = 5
+	// Allocated to a container that wasn't started yet
+	RESERVED DeviceState = 6
+	// Allocated to a container, but out of service once it is released
+	DRAINING DeviceState = 7
 )
 
-// FIXME: This var is all hypothetical. Change the numbers later
-var tenants = map[string]map[string]int{
-	// ALVEO board can hold 6 tenants with the Galapagos shell
-	"alveo": map[string]int{
-		"tenant": 6,
-	},
-	// SideWinder 100 board can hold 6 tenants with the Galapagos Shell
-	"sidewinder-100": map[string]int{
-		"tenant": 6,
-	},
-	// Hypothetical board can hold 2 big tenants, and 4 small ones with the Galapagos Shell
-	// This is an example of non uniform PR division
-	"HYPOTHETICAL": map[string]int{
-		"big-tenant":   2,
-		"small-tenant": 2,
-	},
+func (state DeviceState) String() string {
+	switch state {
+	case FREE:
+		return "FREE"
+	case USED:
+		return "USED"
+	case BLOCKED:
+		return "BLOCKED"
+	case UNHEALTHY:
+		return "UNHEALTHY"
+	case RESETTING:
+		return "RESETTING"
+	case PROGRAMMING:
+		return "PROGRAMMING"
+	case RESERVED:
+		return "RESERVED"
+	case DRAINING:
+		return "DRAINING"
+	}
+	return fmt.Sprintf("DeviceState(%d)", int(state))
+}
+
+// Whether the device belongs to a container
+func (state DeviceState) inUse() bool {
+	return state == RESERVED || state == PROGRAMMING || state == USED || state == DRAINING
+}
+
+// Whether the device is shown to kubelet. Devices that are being wiped or
+// programmed are hidden until that is done.
+func (state DeviceState) advertised() bool {
+	return state != BLOCKED && state != RESETTING && state != PROGRAMMING
+}
+
+// The health we report to kubelet for a device in this state
+func (state DeviceState) health() string {
+	if state == UNHEALTHY || state == DRAINING {
+		return pluginapi.Unhealthy
+	}
+	return pluginapi.Healthy
+}
+
+// The state changes a device can go through on its own. BLOCKED is never
+// entered or left this way, it follows from the other devices on the same
+// FPGA, see childStates and FPGATenantDevice.parentState. Any device can be
+// marked UNHEALTHY.
+var transitions = map[DeviceState][]DeviceState{
+	FREE:        {RESERVED, USED, UNHEALTHY},
+	RESERVED:    {PROGRAMMING, RESETTING, DRAINING, UNHEALTHY},
+	PROGRAMMING: {USED, RESERVED, UNHEALTHY},
+	USED:        {PROGRAMMING, RESETTING, DRAINING, UNHEALTHY},
+	DRAINING:    {USED, RESETTING, UNHEALTHY},
+	RESETTING:   {FREE, UNHEALTHY},
+	BLOCKED:     {UNHEALTHY},
+	UNHEALTHY:   {FREE, RESETTING, UNHEALTHY},
+}
+
+// What the tenants of an FPGA become when the FPGA enters a state. The
+// tenants of a BLOCKED FPGA are left as they are, they are what blocks it,
+// and UNHEALTHY tenants stay so until the FPGA is freed.
+var childStates = map[DeviceState]DeviceState{
+	FREE:        FREE,
+	RESERVED:    BLOCKED,
+	PROGRAMMING: BLOCKED,
+	USED:        BLOCKED,
+	DRAINING:    BLOCKED,
+	RESETTING:   BLOCKED,
+	UNHEALTHY:   UNHEALTHY,
+}
+
+func validTransition(from DeviceState, to DeviceState) bool {
+	for _, state := range transitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a device can follow another one on the same FPGA into a state.
+// Entering and leaving BLOCKED only happens this way.
+func validDerivedTransition(from DeviceState, to DeviceState) bool {
+	return from == to || from == BLOCKED || to == BLOCKED || validTransition(from, to)
+}
+
+// Where a device goes once it is released and wiped. Devices that were taken
+// out of service stay out of it.
+func releasedState(state DeviceState) DeviceState {
+	if state == DRAINING || state == UNHEALTHY {
+		return UNHEALTHY
+	}
+	return FREE
+}
+
+// An illegal state change of a device, e.g. using a tenant whose FPGA is
+// used entirely. The device is left as it was.
+type TransitionError struct {
+	ID     string
+	From   DeviceState
+	To     DeviceState
+	Reason string
+}
+
+func (err *TransitionError) Error() string {
+	return fmt.Sprintf("device '%s' cannot go from %s to %s: %s", err.ID, err.From, err.To, err.Reason)
+}
+
+// Whole FPGAs and tenants, as far as the state machine is concerned
+type managedDevice interface {
+	deviceID() string
+	state() DeviceState
+	setState(state DeviceState) error
+	Reset() error
+	Program(deadline time.Time) error
+	// Program the given bitstream into the device for its container, tenants
+	// fill in the region placeholder
+	chooseBitstream(bitstream string)
+	// What kubelet is told about the device
+	apiDevice() *pluginapi.Device
+	// The FPGA the device is on, itself for entire FPGAs
+	fpga() *FPGADevice
 }
 
 type FPGADevice struct {
 	pluginapi.Device
-	// the status of an FPGA device
-	// 0 for free
-	// 1 for used
-	// 2 for blocked because of subdevice being used
-	// 3 for being unhealthy
-	status   int
+	// The ID derived from the hardware, the advertised ID differs for FPGAs
+	// known to earlier versions
+	stableID string
+	// The full name of the resource this device is advertised as
+	resource string
+	// The state of the FPGA, BLOCKED while tenants are in use
+	status   DeviceState
 	children []*FPGATenantDevice
+	// The backend that found this FPGA, and programs and wipes it
+	backend Backend
+	// PCI address of PCIe connected FPGAs, e.g. 0000:65:00.0
+	// Empty for MPSoCs
+	pciAddress string
+	// The fpga_manager used to program this FPGA, e.g. fpga0
+	// Empty if the FPGA can't be programmed through fpga_manager
+	manager     *FPGAManager
+	managerName string
+	// Host paths mounted into, and device nodes passed to, the containers
+	// this FPGA is allocated to
+	mounts      []string
+	deviceNodes []string
+	// Device tree node of MPSoC FPGAs, empty for PCIe ones
+	deviceTreePath string
+	// hwmon sensor directories of this FPGA
+	hwmon []string
+	// FME and ports of Intel FPGAs driven by the DFL driver, nil for others
+	dfl *dflFPGA
+	// Paired PCI functions and shell of Alveo cards driven by XRT, nil for
+	// others
+	xrt *xrtCard
+	// Bitstream used to wipe this FPGA, empty to skip wiping
+	blankBitstream string
+	// Notified whenever this FPGA or its tenants change, shared by
+	// all devices of the same plugin
+	notifier *deviceNotifier
+	// When this FPGA was last allocated
+	allocated time.Time
+	// Bitstream chosen for the container this FPGA was allocated to, empty
+	// to leave the FPGA as it is
+	bitstream string
+	// Whether tenants were used on this FPGA since it was last used entirely
+	tenantHistory bool
 }
 
 type FPGATenantDevice struct {
 	pluginapi.Device
-	// the status of an FPGA tenant device
-	// 0 for free
-	// 1 for used
-	// 2 for blocked because of parent being used
-	// 3 for being unhealthy
-	status int
+	// The full name of the resource this device is advertised as
+	resource string
+	// The state of the tenant, BLOCKED while its FPGA is in use
+	status DeviceState
 	parent *FPGADevice
+	// The tenant class of this PR region
+	class string
+	// The index of this PR region within its tenant class
+	region int
+	// Partial bitstream used to wipe this PR region, empty to skip wiping
+	blankBitstream string
+	// When this tenant was last allocated
+	allocated time.Time
+	// Partial bitstream chosen for the container this tenant was allocated
+	// to, empty to leave the PR region as it is
+	bitstream string
 }
 
-func (device *FPGADevice) SetFree() {
-	device.status = FREE
-	device.Health = pluginapi.Healthy
+// Every status change must go through here, to keep metrics accurate
+func (device *FPGADevice) setStatus(status DeviceState) {
+	observeStatus(device.resource, device.status, status)
+	device.status = status
+}
+
+func (device *FPGATenantDevice) setStatus(status DeviceState) {
+	observeStatus(device.resource, device.status, status)
+	device.status = status
+}
+
+func (device *FPGADevice) deviceID() string {
+	return device.ID
+}
+
+func (device *FPGATenantDevice) deviceID() string {
+	return device.ID
+}
+
+func (device *FPGADevice) fpga() *FPGADevice {
+	return device
+}
+
+func (device *FPGATenantDevice) fpga() *FPGADevice {
+	return device.parent
+}
+
+func (device *FPGADevice) state() DeviceState {
+	return device.status
+}
+
+func (device *FPGATenantDevice) state() DeviceState {
+	return device.status
+}
+
+// Move the FPGA to another state, and its tenants along with it
+func (device *FPGADevice) setState(state DeviceState) error {
+	if !validTransition(device.status, state) {
+		return &TransitionError{device.ID, device.status, state, "not a valid transition"}
+	}
+	if state.inUse() && !device.status.inUse() {
+		device.allocated = time.Now()
+		device.tenantHistory = false
+	}
+	device.setStatus(state)
+	device.Health = state.health()
 	log.WithFields(log.Fields{
 		"ID": device.ID,
-	}).Info("FPGA device is now free")
-	// Also set our children to free
-	for _, child := range device.children {
-		child.status = FREE
-		child.Health = pluginapi.Healthy
-		log.WithFields(log.Fields{
-			"ID": child.ID,
-		}).Info("FPGA tenant device is now free")
+	}).Info("FPGA device is now " + state.String())
+	if childState, ok := childStates[state]; ok {
+		for _, child := range device.children {
+			if child.status == UNHEALTHY && childState == BLOCKED {
+				continue
+			}
+			child.follow(childState)
+		}
 	}
+	device.notifier.notify()
+	return nil
 }
 
-func (device *FPGATenantDevice) SetFree() {
-	if device.parent.status == USED {
-		log.Fatal("Impossible case, shouldn't be able to change our status when our parent is being used")
-		return
+// Move the tenant to another state, and its FPGA and siblings along with it
+func (device *FPGATenantDevice) setState(state DeviceState) error {
+	if !validTransition(device.status, state) {
+		return &TransitionError{device.ID, device.status, state, "not a valid transition"}
+	}
+	// Tenants of an FPGA in use can only be taken out of service, and
+	// tenants of an unhealthy FPGA can only be wiped
+	parent := device.parent
+	if childStates[parent.status] == BLOCKED && state != UNHEALTHY {
+		return &TransitionError{device.ID, device.status, state, "its FPGA is " + parent.status.String()}
+	}
+	if parent.status == UNHEALTHY && state != UNHEALTHY && state != RESETTING {
+		return &TransitionError{device.ID, device.status, state, "its FPGA is " + parent.status.String()}
+	}
+	parentState := device.parentState(state)
+	if !validDerivedTransition(parent.status, parentState) {
+		return &TransitionError{device.ID, device.status, state, "its FPGA cannot go from " + parent.status.String() + " to " + parentState.String()}
 	}
-	device.status = FREE
-	device.Health = pluginapi.Healthy
+	if state.inUse() && !device.status.inUse() {
+		device.allocated = time.Now()
+		parent.tenantHistory = true
+	}
+	device.setStatus(state)
+	device.Health = state.health()
 	log.WithFields(log.Fields{
 		"ID": device.ID,
-	}).Info("FPGA tenant device is now free")
-	// If all other children of our parent are free
-	// set the parent free too
-	free := true
-	health := pluginapi.Healthy
-	for _, child := range device.parent.children {
-		if child == device {
-			continue
+	}).Info("FPGA tenant device is now " + state.String())
+	if parent.status != parentState {
+		parent.setStatus(parentState)
+		parent.Health = parentState.health()
+		log.WithFields(log.Fields{
+			"ID": parent.ID,
+		}).Info("FPGA device is now " + parentState.String())
+		// An FPGA taken out of service takes its free tenants along,
+		// including this one if it was just freed
+		if childState, ok := childStates[parentState]; ok {
+			for _, child := range parent.children {
+				child.follow(childState)
+			}
 		}
-		if child.status != FREE {
-			free = false
+	}
+	parent.notifier.notify()
+	return nil
+}
+
+// What the FPGA of the tenant becomes when the tenant enters a state. An FPGA
+// in use is left alone, its tenants can only be taken out of service.
+// Otherwise it is BLOCKED while any of its tenants is busy, UNHEALTHY once
+// one of them is out of service and none is busy, and FREE once all are.
+func (device *FPGATenantDevice) parentState(state DeviceState) DeviceState {
+	parent := device.parent
+	if childStates[parent.status] == BLOCKED {
+		return parent.status
+	}
+	busy, unhealthy := false, false
+	for _, child := range parent.children {
+		childState := child.status
+		if child == device {
+			childState = state
 		}
-		if child.Health != pluginapi.Healthy {
-			health = pluginapi.Unhealthy
+		switch childState {
+		case FREE:
+		case UNHEALTHY:
+			unhealthy = true
+		default:
+			busy = true
 		}
 	}
-	if free {
-		device.parent.status = FREE
-		device.parent.Health = health
-		log.WithFields(log.Fields{
-			"ID": device.parent.ID,
-		}).Info("FPGA device is now free")
+	switch {
+	case parent.status == UNHEALTHY || unhealthy && !busy:
+		return UNHEALTHY
+	case busy:
+		return BLOCKED
 	}
+	return FREE
 }
 
-func (device *FPGADevice) SetUsed() {
-	device.status = USED
-	device.Health = pluginapi.Healthy
+// Move the tenant to the state its FPGA or a sibling put it in, if it can go
+// there
+func (device *FPGATenantDevice) follow(state DeviceState) {
+	if device.status == state || !validDerivedTransition(device.status, state) {
+		return
+	}
+	device.setStatus(state)
+	device.Health = state.health()
 	log.WithFields(log.Fields{
 		"ID": device.ID,
-	}).Info("FPGA device is now used")
-	// set children to blocked
-	for _, child := range device.children {
-		child.status = BLOCKED
-		child.Health = pluginapi.Healthy
-		log.WithFields(log.Fields{
-			"ID": child.ID,
-		}).Info("FPGA tenant device is now blocked")
-	}
+	}).Info("FPGA tenant device is now " + state.String())
 }
 
-func (device *FPGATenantDevice) SetUsed() {
-	if device.parent.status == USED {
-		log.Fatal("Impossible case, shouldn't be able to change our status when our parent is being used")
-		return
+func (device *FPGADevice) SetFree() error {
+	return device.setState(FREE)
+}
+
+func (device *FPGATenantDevice) SetFree() error {
+	return device.setState(FREE)
+}
+
+func (device *FPGADevice) SetUsed() error {
+	return device.setState(USED)
+}
+
+func (device *FPGATenantDevice) SetUsed() error {
+	return device.setState(USED)
+}
+
+// Any device can be taken out of service
+func (device *FPGADevice) SetUnhealthy() {
+	device.setState(UNHEALTHY)
+}
+
+func (device *FPGATenantDevice) SetUnhealthy() {
+	device.setState(UNHEALTHY)
+}
+
+// Finish wiping a device that was moved to RESETTING, moving it to state if
+// wiping worked and to UNHEALTHY otherwise. Devices that were taken out of
+// service in the meantime stay so.
+func finishReset(device managedDevice, state DeviceState, err error) error {
+	if device.state() != RESETTING {
+		return nil
 	}
-	device.status = USED
-	device.Health = pluginapi.Healthy
-	log.WithFields(log.Fields{
-		"ID": device.ID,
-	}).Info("FPGA tenant device is now used")
-	if device.parent.status != BLOCKED {
-		device.parent.status = BLOCKED
-		device.parent.Health = pluginapi.Healthy
+	if err != nil {
 		log.WithFields(log.Fields{
-			"ID": device.parent.ID,
-		}).Info("FPGA device is now blocked")
+			"ID":    device.deviceID(),
+			"Error": err,
+		}).Error("Failed to clear device. Device is now unhealthy")
+		state = UNHEALTHY
+	}
+	// Devices that can't go where they were meant to, e.g. tenants of an
+	// FPGA that went unhealthy meanwhile, are taken out of service
+	if err := device.setState(state); err != nil {
+		device.setState(UNHEALTHY)
+		return err
 	}
+	return nil
 }
 
-func (device *FPGADevice) SetUnhealthy() {
-	device.status = UNHEALTHY
-	device.Health = pluginapi.Unhealthy
+// Report the FPGA and its tenants healthy or not, without changing their
+// status. Used for FPGAs that are in use, tenants that are unhealthy on their
+// own stay so.
+func (device *FPGADevice) setHealth(health string) {
+	changed := device.Health != health
+	device.Health = health
 	for _, child := range device.children {
-		child.status = UNHEALTHY
-		child.Health = pluginapi.Unhealthy
+		if child.status == UNHEALTHY {
+			continue
+		}
+		changed = changed || child.Health != health
+		child.Health = health
+	}
+	if changed {
+		device.notifier.notify()
 	}
 }
 
-func (device *FPGATenantDevice) SetUnhealthy() {
-	device.status = UNHEALTHY
-	device.Health = pluginapi.Unhealthy
-	device.parent.status = UNHEALTHY
-	device.parent.Health = pluginapi.Unhealthy
+// Reset the FPGA, usually by installing an empty bitstream
+func (device *FPGADevice) Reset() error {
+	start := time.Now()
+	err := device.backend.Reset(device, WHOLE_FPGA, device.blankBitstream)
+	observeReset(device.resource, start, err)
+	return err
 }
 
-func (device *FPGADevice) Reset() error {
-	// TODO: Reset the FPGA by installing an empty bitstream
+// Reset the FPGA PR area, usually by installing an empty partial bitstream
+func (device *FPGATenantDevice) Reset() error {
+	start := time.Now()
+	err := device.parent.backend.Reset(device.parent, device.backendRegion(), device.blankBitstream)
+	observeReset(device.resource, start, err)
+	return err
+}
+
+// The PR region of the tenant, as told to the backend of its FPGA
+func (device *FPGATenantDevice) backendRegion() Region {
+	return Region{Class: device.class, Index: device.region}
+}
+
+func (device *FPGADevice) apiDevice() *pluginapi.Device {
+	return &device.Device
+}
+
+func (device *FPGATenantDevice) apiDevice() *pluginapi.Device {
+	return &device.Device
+}
+
+func (device *FPGADevice) chooseBitstream(bitstream string) {
+	device.bitstream = bitstream
+}
+
+func (device *FPGATenantDevice) chooseBitstream(bitstream string) {
+	device.bitstream = regionBitstream(bitstream, device.region)
+}
+
+// Program the bitstream chosen for the container, if any
+func (device *FPGADevice) Program(deadline time.Time) error {
+	if device.bitstream == "" {
+		return nil
+	}
+	err := device.backend.Program(device, WHOLE_FPGA, device.bitstream, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot program bitstream '%s' into '%s': %v", device.bitstream, device.ID, err)
+	}
 	return nil
 }
 
-func (device *FPGATenantDevice) Reset() error {
-	// TODO: Reset the FPGA PR area by installing an empty bitstream
+// Program the partial bitstream chosen for the container, if any
+func (device *FPGATenantDevice) Program(deadline time.Time) error {
+	if device.bitstream == "" {
+		return nil
+	}
+	err := device.parent.backend.Program(device.parent, device.backendRegion(), device.bitstream, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot program bitstream '%s' into '%s': %v", device.bitstream, device.ID, err)
+	}
 	return nil
 }
@@ -0,0 +1,321 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+)
+
+var allStates = []DeviceState{FREE, USED, BLOCKED, UNHEALTHY, RESETTING, PROGRAMMING, RESERVED, DRAINING}
+
+// An FPGA with two tenants, put straight into a state along with its
+// tenants, without going through the transitions
+func fpgaIn(t *testing.T, state DeviceState) *FPGADevice {
+	device := newSimPlugins(t, simConfig(1, TenantConfig{Name: "tenant", Count: 2}))[0].devices[0]
+	device.setStatus(state)
+	for index, child := range device.children {
+		switch {
+		case state == BLOCKED && index == 0:
+			child.setStatus(USED)
+		case state == BLOCKED:
+			child.setStatus(FREE)
+		default:
+			child.setStatus(childStates[state])
+		}
+	}
+	return device
+}
+
+// The first of two tenants of an FPGA, put straight into a state along with
+// its FPGA
+func tenantIn(t *testing.T, state DeviceState) *FPGATenantDevice {
+	parent := fpgaIn(t, FREE)
+	device := parent.children[0]
+	switch state {
+	case BLOCKED:
+		parent.setStatus(USED)
+		for _, child := range parent.children {
+			child.setStatus(BLOCKED)
+		}
+	default:
+		device.setStatus(state)
+		parent.setStatus(device.parentState(state))
+		if childState, ok := childStates[parent.status]; ok {
+			for _, child := range parent.children {
+				child.follow(childState)
+			}
+		}
+	}
+	return device
+}
+
+func statesOf(device *FPGADevice) []DeviceState {
+	states := []DeviceState{device.status}
+	for _, child := range device.children {
+		states = append(states, child.status)
+	}
+	return states
+}
+
+func equalStates(a []DeviceState, b []DeviceState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// Check that a state change failed with a TransitionError and changed nothing
+func checkRejected(t *testing.T, device managedDevice, fpga *FPGADevice, from DeviceState, to DeviceState) {
+	t.Helper()
+	before := statesOf(fpga)
+	err := device.setState(to)
+	transitionErr, ok := err.(*TransitionError)
+	if !ok {
+		t.Errorf("%s from %s to %s returned %v, want a TransitionError", device.deviceID(), from, to, err)
+		return
+	}
+	if transitionErr.ID != device.deviceID() || transitionErr.From != from || transitionErr.To != to {
+		t.Errorf("%s from %s to %s returned %+v", device.deviceID(), from, to, transitionErr)
+	}
+	if after := statesOf(fpga); !equalStates(before, after) {
+		t.Errorf("rejected change of %s from %s to %s changed %v to %v", device.deviceID(), from, to, before, after)
+	}
+}
+
+func TestIllegalFPGATransitions(t *testing.T) {
+	for _, from := range allStates {
+		for _, to := range allStates {
+			if validTransition(from, to) {
+				continue
+			}
+			device := fpgaIn(t, from)
+			checkRejected(t, device, device, from, to)
+		}
+	}
+}
+
+func TestIllegalTenantTransitions(t *testing.T) {
+	for _, from := range allStates {
+		for _, to := range allStates {
+			if validTransition(from, to) {
+				continue
+			}
+			device := tenantIn(t, from)
+			checkRejected(t, device, device.parent, from, to)
+		}
+	}
+}
+
+// Tenants of an FPGA that is in use or out of service can't be used, even if
+// they could be on their own
+func TestTenantTransitionsBlockedByFPGA(t *testing.T) {
+	tests := []struct {
+		parent DeviceState
+		from   DeviceState
+		to     DeviceState
+	}{
+		{USED, UNHEALTHY, FREE},
+		{USED, UNHEALTHY, RESETTING},
+		{RESERVED, UNHEALTHY, FREE},
+		{DRAINING, UNHEALTHY, RESETTING},
+		{RESETTING, UNHEALTHY, FREE},
+		{UNHEALTHY, FREE, RESERVED},
+		{UNHEALTHY, FREE, USED},
+		{UNHEALTHY, UNHEALTHY, FREE},
+	}
+	for _, test := range tests {
+		parent := fpgaIn(t, test.parent)
+		device := parent.children[0]
+		device.setStatus(test.from)
+		checkRejected(t, device, parent, test.from, test.to)
+	}
+}
+
+// Every valid change of an FPGA, and what its two tenants become
+func TestFPGATransitions(t *testing.T) {
+	tests := []struct {
+		from DeviceState
+		to   DeviceState
+		want []DeviceState
+	}{
+		{FREE, RESERVED, []DeviceState{RESERVED, BLOCKED, BLOCKED}},
+		{FREE, USED, []DeviceState{USED, BLOCKED, BLOCKED}},
+		{FREE, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{RESERVED, PROGRAMMING, []DeviceState{PROGRAMMING, BLOCKED, BLOCKED}},
+		{RESERVED, RESETTING, []DeviceState{RESETTING, BLOCKED, BLOCKED}},
+		{RESERVED, DRAINING, []DeviceState{DRAINING, BLOCKED, BLOCKED}},
+		{RESERVED, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{PROGRAMMING, USED, []DeviceState{USED, BLOCKED, BLOCKED}},
+		{PROGRAMMING, RESERVED, []DeviceState{RESERVED, BLOCKED, BLOCKED}},
+		{PROGRAMMING, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{USED, PROGRAMMING, []DeviceState{PROGRAMMING, BLOCKED, BLOCKED}},
+		{USED, RESETTING, []DeviceState{RESETTING, BLOCKED, BLOCKED}},
+		{USED, DRAINING, []DeviceState{DRAINING, BLOCKED, BLOCKED}},
+		{USED, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{DRAINING, USED, []DeviceState{USED, BLOCKED, BLOCKED}},
+		{DRAINING, RESETTING, []DeviceState{RESETTING, BLOCKED, BLOCKED}},
+		{DRAINING, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{RESETTING, FREE, []DeviceState{FREE, FREE, FREE}},
+		{RESETTING, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{BLOCKED, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{UNHEALTHY, FREE, []DeviceState{FREE, FREE, FREE}},
+		{UNHEALTHY, RESETTING, []DeviceState{RESETTING, UNHEALTHY, UNHEALTHY}},
+		{UNHEALTHY, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+	}
+	tested := make(map[[2]DeviceState]bool)
+	for _, test := range tests {
+		tested[[2]DeviceState{test.from, test.to}] = true
+		device := fpgaIn(t, test.from)
+		if err := device.setState(test.to); err != nil {
+			t.Errorf("FPGA from %s to %s failed: %v", test.from, test.to, err)
+			continue
+		}
+		if got := statesOf(device); !equalStates(got, test.want) {
+			t.Errorf("FPGA from %s to %s left %v, want %v", test.from, test.to, got, test.want)
+		}
+		if device.Health != test.to.health() {
+			t.Errorf("%s FPGA is reported %s", test.to, device.Health)
+		}
+	}
+	for _, from := range allStates {
+		for _, to := range allStates {
+			if validTransition(from, to) && !tested[[2]DeviceState{from, to}] {
+				t.Errorf("FPGA from %s to %s isn't tested", from, to)
+			}
+		}
+	}
+}
+
+// Every valid change of a tenant, and what its FPGA and sibling become. The
+// states are those of the FPGA, the tenant and its sibling.
+func TestTenantTransitions(t *testing.T) {
+	tests := []struct {
+		before []DeviceState
+		to     DeviceState
+		want   []DeviceState
+	}{
+		{[]DeviceState{FREE, FREE, FREE}, RESERVED, []DeviceState{BLOCKED, RESERVED, FREE}},
+		{[]DeviceState{FREE, FREE, FREE}, USED, []DeviceState{BLOCKED, USED, FREE}},
+		{[]DeviceState{FREE, FREE, FREE}, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{[]DeviceState{BLOCKED, RESERVED, FREE}, PROGRAMMING, []DeviceState{BLOCKED, PROGRAMMING, FREE}},
+		{[]DeviceState{BLOCKED, RESERVED, FREE}, RESETTING, []DeviceState{BLOCKED, RESETTING, FREE}},
+		{[]DeviceState{BLOCKED, RESERVED, FREE}, DRAINING, []DeviceState{BLOCKED, DRAINING, FREE}},
+		{[]DeviceState{BLOCKED, RESERVED, FREE}, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{[]DeviceState{BLOCKED, PROGRAMMING, FREE}, USED, []DeviceState{BLOCKED, USED, FREE}},
+		{[]DeviceState{BLOCKED, PROGRAMMING, FREE}, RESERVED, []DeviceState{BLOCKED, RESERVED, FREE}},
+		{[]DeviceState{BLOCKED, PROGRAMMING, FREE}, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{[]DeviceState{BLOCKED, USED, FREE}, PROGRAMMING, []DeviceState{BLOCKED, PROGRAMMING, FREE}},
+		{[]DeviceState{BLOCKED, USED, FREE}, RESETTING, []DeviceState{BLOCKED, RESETTING, FREE}},
+		{[]DeviceState{BLOCKED, USED, FREE}, DRAINING, []DeviceState{BLOCKED, DRAINING, FREE}},
+		{[]DeviceState{BLOCKED, USED, FREE}, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{[]DeviceState{BLOCKED, DRAINING, FREE}, USED, []DeviceState{BLOCKED, USED, FREE}},
+		{[]DeviceState{BLOCKED, DRAINING, FREE}, RESETTING, []DeviceState{BLOCKED, RESETTING, FREE}},
+		{[]DeviceState{BLOCKED, DRAINING, FREE}, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{[]DeviceState{BLOCKED, RESETTING, FREE}, FREE, []DeviceState{FREE, FREE, FREE}},
+		{[]DeviceState{BLOCKED, RESETTING, FREE}, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{[]DeviceState{USED, BLOCKED, BLOCKED}, UNHEALTHY, []DeviceState{USED, UNHEALTHY, BLOCKED}},
+		{[]DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}, RESETTING, []DeviceState{UNHEALTHY, RESETTING, UNHEALTHY}},
+		{[]DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		// Tenants of an FPGA in use are taken out of service on their own
+		{[]DeviceState{RESERVED, BLOCKED, BLOCKED}, UNHEALTHY, []DeviceState{RESERVED, UNHEALTHY, BLOCKED}},
+		{[]DeviceState{DRAINING, BLOCKED, BLOCKED}, UNHEALTHY, []DeviceState{DRAINING, UNHEALTHY, BLOCKED}},
+		{[]DeviceState{RESETTING, BLOCKED, BLOCKED}, UNHEALTHY, []DeviceState{RESETTING, UNHEALTHY, BLOCKED}},
+		// A busy sibling keeps the FPGA BLOCKED, and it turns UNHEALTHY
+		// along with its free tenants once the sibling is done
+		{[]DeviceState{BLOCKED, FREE, USED}, UNHEALTHY, []DeviceState{BLOCKED, UNHEALTHY, USED}},
+		{[]DeviceState{BLOCKED, UNHEALTHY, USED}, UNHEALTHY, []DeviceState{BLOCKED, UNHEALTHY, USED}},
+		{[]DeviceState{BLOCKED, RESETTING, UNHEALTHY}, FREE, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+		{[]DeviceState{BLOCKED, RESETTING, USED}, FREE, []DeviceState{BLOCKED, FREE, USED}},
+		{[]DeviceState{BLOCKED, USED, USED}, RESETTING, []DeviceState{BLOCKED, RESETTING, USED}},
+		{[]DeviceState{BLOCKED, FREE, USED}, USED, []DeviceState{BLOCKED, USED, USED}},
+		// Tenants of an FPGA that went unhealthy while they were busy are wiped
+		// and stay out of service
+		{[]DeviceState{UNHEALTHY, RESETTING, UNHEALTHY}, UNHEALTHY, []DeviceState{UNHEALTHY, UNHEALTHY, UNHEALTHY}},
+	}
+	tested := make(map[[2]DeviceState]bool)
+	for _, test := range tests {
+		fpga := fpgaIn(t, FREE)
+		for index, state := range test.before {
+			if index == 0 {
+				fpga.setStatus(state)
+				fpga.Health = state.health()
+			} else {
+				fpga.children[index-1].setStatus(state)
+				fpga.children[index-1].Health = state.health()
+			}
+		}
+		device := fpga.children[0]
+		from := device.status
+		tested[[2]DeviceState{from, test.to}] = true
+		if err := device.setState(test.to); err != nil {
+			t.Errorf("tenant of %v to %s failed: %v", test.before, test.to, err)
+			continue
+		}
+		if got := statesOf(fpga); !equalStates(got, test.want) {
+			t.Errorf("tenant of %v to %s left %v, want %v", test.before, test.to, got, test.want)
+		}
+		if fpga.Health != fpga.status.health() {
+			t.Errorf("%s FPGA is reported %s", fpga.status, fpga.Health)
+		}
+		for _, child := range fpga.children {
+			if child.Health != child.status.health() {
+				t.Errorf("%s tenant is reported %s", child.status, child.Health)
+			}
+		}
+	}
+	for _, from := range allStates {
+		for _, to := range allStates {
+			// Tenants of an unhealthy FPGA are only freed along with it,
+			// see TestTenantTransitionsBlockedByFPGA
+			if from == UNHEALTHY && to == FREE {
+				continue
+			}
+			if validTransition(from, to) && !tested[[2]DeviceState{from, to}] {
+				t.Errorf("tenant from %s to %s isn't tested", from, to)
+			}
+		}
+	}
+}
+
+// An FPGA that was used entirely wipes its tenants along with it, including
+// those taken out of service meanwhile
+func TestFPGAFreesUnhealthyTenants(t *testing.T) {
+	device := fpgaIn(t, USED)
+	if err := device.children[0].setState(UNHEALTHY); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		to   DeviceState
+		want []DeviceState
+	}{
+		{RESETTING, []DeviceState{RESETTING, UNHEALTHY, BLOCKED}},
+		{FREE, []DeviceState{FREE, FREE, FREE}},
+	}
+	for _, step := range steps {
+		if err := device.setState(step.to); err != nil {
+			t.Fatal(err)
+		}
+		if got := statesOf(device); !equalStates(got, step.want) {
+			t.Errorf("FPGA to %s left %v, want %v", step.to, got, step.want)
+		}
+	}
+}
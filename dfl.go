@@ -0,0 +1,534 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Intel FPGA cards driven by the DFL (Device Feature List) driver, matched on
+// the PCI function their FPGA region sits under
+var knownDFLBoards = []pcieBoard{
+	{0x8086, 0x09c4, 0, 0, "intel.com", "pac-a10"},
+	{0x8086, 0x0b2b, 0, 0, "intel.com", "pac-d5005"},
+	{0x8086, 0x0b30, 0, 0, "intel.com", "pac-n3000"},
+}
+
+// The interface IDs of the FPGAs of a container, one per device
+const ENV_DFL_INTERFACE_IDS string = "FPGA_DFL_INTERFACE_IDS"
+
+// ioctls of the DFL driver, from `linux/fpga-dfl.h`
+const (
+	DFL_FPGA_PORT_RESET  uintptr = 0xb640
+	DFL_FPGA_FME_PORT_PR uintptr = 0xb680
+)
+
+// Green bitstreams, the AFU images built for DFL FPGAs, start with this GUID,
+// followed by the length of their JSON metadata and the metadata itself. The
+// driver only wants what comes after.
+var gbsGUID = []byte{0x58, 0x65, 0x6f, 0x6e, 0x46, 0x50, 0x47, 0x41, 0xb7, 0x47, 0x42, 0x53, 0x76, 0x30, 0x30, 0x31}
+
+type gbsMetadata struct {
+	AFUImage struct {
+		InterfaceUUID string `json:"interface-uuid"`
+	} `json:"afu-image"`
+}
+
+// A port of a DFL FPGA, where an AFU is loaded by partial reconfiguration.
+// Ports are the tenants of the FPGA, region i is port i.
+type dflPort struct {
+	// e.g. dfl-port.0, also the name of its device node
+	name string
+	// Its sysfs directory
+	sysfsPath string
+	// Its device node, empty if it has none
+	deviceNode string
+}
+
+// What the DFL driver exposes of an FPGA: its FME (FPGA Management Engine) and
+// its ports, found under its region, e.g.
+// `/sys/class/fpga_region/region0/{dfl-fme.0,dfl-port.0}`
+type dflFPGA struct {
+	// The sysfs directory of the region
+	regionPath string
+	// e.g. dfl-fme.0, also the name of its device node
+	fme string
+	// The sysfs directory of the FME
+	fmePath string
+	// Its device node, empty if it has none
+	fmeDeviceNode string
+	// Identifies the static part of the FPGA that AFUs are built against,
+	// as 32 hex digits
+	interfaceID string
+	ports       []*dflPort
+}
+
+// The ioctls the DFL backend needs, replaceable to test without hardware
+type dflDriver interface {
+	// Program an AFU into a port of an FPGA, through its FME
+	portPR(fmeDeviceNode string, port int, bitstream []byte) error
+	// Reset the AFU of a port
+	portReset(portDeviceNode string) error
+}
+
+type dflIoctls struct{}
+
+// Argument of DFL_FPGA_FME_PORT_PR
+type dflFmePortPR struct {
+	argsz         uint32
+	flags         uint32
+	portID        uint32
+	bufferSize    uint32
+	bufferAddress uint64
+}
+
+func dflIoctl(deviceNode string, request uintptr, arg unsafe.Pointer) error {
+	file, err := os.OpenFile(deviceNode, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request, uintptr(arg))
+	if errno != 0 {
+		return fmt.Errorf("ioctl 0x%x on '%s' failed: %v", request, deviceNode, errno)
+	}
+	return nil
+}
+
+func (driver *dflIoctls) portPR(fmeDeviceNode string, port int, bitstream []byte) error {
+	if len(bitstream) == 0 {
+		return errors.New("empty bitstream")
+	}
+	pr := dflFmePortPR{
+		portID:        uint32(port),
+		bufferSize:    uint32(len(bitstream)),
+		bufferAddress: uint64(uintptr(unsafe.Pointer(&bitstream[0]))),
+	}
+	pr.argsz = uint32(unsafe.Sizeof(pr))
+	err := dflIoctl(fmeDeviceNode, DFL_FPGA_FME_PORT_PR, unsafe.Pointer(&pr))
+	runtime.KeepAlive(bitstream)
+	return err
+}
+
+func (driver *dflIoctls) portReset(portDeviceNode string) error {
+	return dflIoctl(portDeviceNode, DFL_FPGA_PORT_RESET, nil)
+}
+
+func init() {
+	registerBackend("dfl", newDFLBackend)
+}
+
+// Finds Intel FPGAs driven by the DFL driver. The FME is advertised as the
+// entire FPGA, and its AFU ports as its tenants, so boards are divided into
+// one tenant class with one tenant per port. AFUs are programmed through the
+// FME into their port, from green bitstreams.
+type dflBackend struct {
+	// Where the host sysfs is mounted, usually `/sys`
+	sysfsRoot string
+	// Where the host device nodes are, usually `/dev`
+	devRoot string
+	// Where blank and accelerator bitstreams are looked up
+	firmwareDir  string
+	bitstreamDir string
+	driver       dflDriver
+}
+
+func newDFLBackend(options *BackendOptions) (Backend, error) {
+	if options.Manager == nil {
+		return nil, errors.New("no bitstream directories")
+	}
+	return &dflBackend{
+		sysfsRoot:    options.SysfsRoot,
+		devRoot:      options.DevRoot,
+		firmwareDir:  options.Manager.firmwareDir,
+		bitstreamDir: options.Manager.bitstreamDir,
+		driver:       &dflIoctls{},
+	}, nil
+}
+
+func (backend *dflBackend) Name() string {
+	return "dfl"
+}
+
+// Read a sysfs attribute holding an ID, see normalizeUUID
+func readDFLID(attributePath string) string {
+	dat, err := ioutil.ReadFile(attributePath)
+	if err != nil {
+		return ""
+	}
+	return normalizeUUID(string(dat))
+}
+
+// Write a UUID or other ID as lowercase hex digits without dashes or prefix,
+// the way drivers disagree on
+func normalizeUUID(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	id = strings.TrimPrefix(id, "0x")
+	return strings.Replace(id, "-", "", -1)
+}
+
+// The index in a DFL device name, e.g. 3 for dfl-port.3
+func dflIndex(name string) int {
+	index, err := strconv.Atoi(name[strings.LastIndex(name, ".")+1:])
+	if err != nil {
+		return -1
+	}
+	return index
+}
+
+// The device node of a DFL device, empty if it doesn't exist
+func (backend *dflBackend) deviceNode(name string) string {
+	if _, err := os.Stat(path.Join(backend.devRoot, name)); err != nil {
+		return ""
+	}
+	return path.Join(hostDevRoot, name)
+}
+
+// Read what the driver exposes of the FPGA under a region, nil if the region
+// is not a DFL one
+func (backend *dflBackend) readFPGA(regionPath string) *dflFPGA {
+	entries, err := ioutil.ReadDir(regionPath)
+	if err != nil {
+		return nil
+	}
+	fpga := &dflFPGA{regionPath: regionPath}
+	for _, entry := range entries {
+		switch {
+		case strings.HasPrefix(entry.Name(), "dfl-fme."):
+			fpga.fme = entry.Name()
+		case strings.HasPrefix(entry.Name(), "dfl-port."):
+			fpga.ports = append(fpga.ports, &dflPort{
+				name:       entry.Name(),
+				sysfsPath:  path.Join(regionPath, entry.Name()),
+				deviceNode: backend.deviceNode(entry.Name()),
+			})
+		}
+	}
+	if fpga.fme == "" {
+		return nil
+	}
+	// The driver numbers ports in the order of the FME port registers
+	sort.Slice(fpga.ports, func(i, j int) bool {
+		return dflIndex(fpga.ports[i].name) < dflIndex(fpga.ports[j].name)
+	})
+	fpga.fmePath = path.Join(regionPath, fpga.fme)
+	fpga.fmeDeviceNode = backend.deviceNode(fpga.fme)
+	// Newer drivers expose the interface ID as the compat_id of the region
+	// of the FME, older ones as pr/interface_id
+	compatIDs, _ := filepath.Glob(path.Join(fpga.fmePath, "dfl-fme-region.*/fpga_region/region*/compat_id"))
+	if len(compatIDs) > 0 {
+		fpga.interfaceID = readDFLID(compatIDs[0])
+	} else {
+		fpga.interfaceID = readDFLID(path.Join(fpga.fmePath, "pr/interface_id"))
+	}
+	return fpga
+}
+
+// Search the FPGA regions for DFL FPGAs of known boards
+func (backend *dflBackend) Discover() []*DiscoveredFPGA {
+	var found []*DiscoveredFPGA
+	classPath := path.Join(backend.sysfsRoot, "class/fpga_region")
+	entries, err := ioutil.ReadDir(classPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+			"Path":  classPath,
+		}).Info("No FPGA regions found.")
+		return found
+	}
+	for _, entry := range entries {
+		regionPath, err := filepath.EvalSymlinks(path.Join(classPath, entry.Name()))
+		if err != nil {
+			continue
+		}
+		fpga := backend.readFPGA(regionPath)
+		if fpga == nil {
+			continue
+		}
+		// The region sits under the PCI function of the card, e.g.
+		// .../0000:3b:00.0/fpga_region/region0
+		pciPath := filepath.Dir(filepath.Dir(regionPath))
+		board := matchPCIeBoard(pciPath, knownDFLBoards)
+		if board == nil {
+			log.WithFields(log.Fields{
+				"Region": entry.Name(),
+				"Path":   pciPath,
+			}).Info("Skipping DFL FPGA of unknown board.")
+			continue
+		}
+		device := &FPGADevice{
+			pciAddress: filepath.Base(pciPath),
+			dfl:        fpga,
+		}
+		device.mounts = []string{toHostSysfsPath(backend.sysfsRoot, regionPath)}
+		if fpga.fmeDeviceNode != "" {
+			device.deviceNodes = append(device.deviceNodes, fpga.fmeDeviceNode)
+		}
+		for _, port := range fpga.ports {
+			if port.deviceNode != "" {
+				device.deviceNodes = append(device.deviceNodes, port.deviceNode)
+			}
+		}
+		device.hwmon, _ = filepath.Glob(path.Join(fpga.fmePath, "hwmon/hwmon*"))
+		log.WithFields(log.Fields{
+			"Address":     device.pciAddress,
+			"FME":         fpga.fme,
+			"Ports":       len(fpga.ports),
+			"InterfaceID": fpga.interfaceID,
+		}).Debug("Found DFL FPGA")
+		found = append(found, &DiscoveredFPGA{
+			vendorName: board.vendorName,
+			boardName:  board.boardName,
+			identity:   pciIdentity(device.pciAddress),
+			device:     device,
+		})
+	}
+	return found
+}
+
+// The ports a region stands for. The entire FPGA is its only port, FPGAs
+// with more ports can only be programmed port by port, through their tenants.
+func (backend *dflBackend) ports(device *FPGADevice, region Region) ([]int, error) {
+	if device.dfl == nil {
+		return nil, fmt.Errorf("'%s' is not a DFL FPGA", device.ID)
+	}
+	if region == WHOLE_FPGA {
+		if len(device.dfl.ports) != 1 {
+			return nil, fmt.Errorf("'%s' has %d ports, its AFUs must be programmed through its tenants", device.ID, len(device.dfl.ports))
+		}
+		return []int{0}, nil
+	}
+	if region.Index < 0 || region.Index >= len(device.dfl.ports) {
+		return nil, fmt.Errorf("'%s' has no port %d", device.ID, region.Index)
+	}
+	return []int{region.Index}, nil
+}
+
+// Every port is a PR region
+func (backend *dflBackend) RegionCount(device *FPGADevice) int {
+	if device.dfl == nil {
+		return 0
+	}
+	return len(device.dfl.ports)
+}
+
+// Read a green bitstream, checking it was built for the FPGA, and return what
+// the driver programs. Raw bitstreams are returned as they are.
+func readGBS(bitstreamPath string, interfaceID string) ([]byte, error) {
+	dat, err := ioutil.ReadFile(bitstreamPath)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(dat, gbsGUID) {
+		return dat, nil
+	}
+	header := len(gbsGUID) + 4
+	if len(dat) < header {
+		return nil, fmt.Errorf("green bitstream '%s' is truncated", bitstreamPath)
+	}
+	length := int(binary.LittleEndian.Uint32(dat[len(gbsGUID):header]))
+	if len(dat) < header+length {
+		return nil, fmt.Errorf("green bitstream '%s' is truncated", bitstreamPath)
+	}
+	var metadata gbsMetadata
+	err = json.Unmarshal(dat[header:header+length], &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse metadata of green bitstream '%s': %v", bitstreamPath, err)
+	}
+	bitstreamInterface := normalizeUUID(metadata.AFUImage.InterfaceUUID)
+	if interfaceID != "" && bitstreamInterface != "" && bitstreamInterface != interfaceID {
+		return nil, fmt.Errorf("green bitstream '%s' is built for interface %s, the FPGA has %s", bitstreamPath, bitstreamInterface, interfaceID)
+	}
+	return dat[header+length:], nil
+}
+
+// Program a bitstream from the given directory into the given ports
+func (backend *dflBackend) programPorts(device *FPGADevice, ports []int, dir string, bitstream string) error {
+	if bitstream == "" || filepath.IsAbs(bitstream) || strings.HasPrefix(filepath.Clean(bitstream), "..") {
+		return fmt.Errorf("invalid bitstream name '%s'", bitstream)
+	}
+	if device.dfl.fmeDeviceNode == "" {
+		return fmt.Errorf("'%s' has no FME device node to program '%s' with", device.ID, bitstream)
+	}
+	dat, err := readGBS(filepath.Join(dir, bitstream), device.dfl.interfaceID)
+	if err != nil {
+		return err
+	}
+	fmeDeviceNode := path.Join(backend.devRoot, device.dfl.fme)
+	for _, port := range ports {
+		err = backend.driver.portPR(fmeDeviceNode, port, dat)
+		if err != nil {
+			return fmt.Errorf("cannot program '%s' into port %d: %v", bitstream, port, err)
+		}
+		log.WithFields(log.Fields{
+			"ID":        device.ID,
+			"Port":      port,
+			"Bitstream": bitstream,
+		}).Debug("Programmed DFL port")
+	}
+	return nil
+}
+
+func (backend *dflBackend) Program(device *FPGADevice, region Region, bitstream string, deadline time.Time) error {
+	ports, err := backend.ports(device, region)
+	if err != nil {
+		return err
+	}
+	if time.Now().After(deadline) {
+		return fmt.Errorf("no time left to program '%s'", bitstream)
+	}
+	return backend.programPorts(device, ports, backend.bitstreamDir, bitstream)
+}
+
+// Wipe ports by programming the blank bitstream into them, if any, and reset
+// their AFUs. The entire FPGA is wiped port by port.
+func (backend *dflBackend) Reset(device *FPGADevice, region Region, blankBitstream string) error {
+	if device.dfl == nil {
+		return fmt.Errorf("'%s' is not a DFL FPGA", device.ID)
+	}
+	var ports []int
+	if region == WHOLE_FPGA {
+		for index := range device.dfl.ports {
+			ports = append(ports, index)
+		}
+	} else {
+		var err error
+		ports, err = backend.ports(device, region)
+		if err != nil {
+			return err
+		}
+	}
+	if blankBitstream != "" {
+		err := backend.programPorts(device, ports, backend.firmwareDir, blankBitstream)
+		if err != nil {
+			return err
+		}
+	}
+	for _, port := range ports {
+		if device.dfl.ports[port].deviceNode == "" {
+			continue
+		}
+		err := backend.driver.portReset(path.Join(backend.devRoot, device.dfl.ports[port].name))
+		if err != nil {
+			return fmt.Errorf("cannot reset port %d: %v", port, err)
+		}
+	}
+	return nil
+}
+
+func (backend *dflBackend) Health() []HealthProbe {
+	return []HealthProbe{
+		&presenceProbe{sysfsRoot: backend.sysfsRoot},
+		&dflErrorsProbe{},
+	}
+}
+
+// The entire FPGA gets its FME, all its ports and its region in sysfs, where
+// OPAE finds them. A tenant gets its port.
+func (backend *dflBackend) AllocateSpec(device *FPGADevice, region Region) *ContainerSpec {
+	if device.dfl == nil {
+		return &ContainerSpec{}
+	}
+	spec := &ContainerSpec{
+		Envs: map[string]string{ENV_DFL_INTERFACE_IDS: device.dfl.interfaceID},
+	}
+	if region == WHOLE_FPGA {
+		spec.DeviceNodes = device.deviceNodes
+		spec.Mounts = device.mounts
+		return spec
+	}
+	if region.Index < 0 || region.Index >= len(device.dfl.ports) {
+		return spec
+	}
+	port := device.dfl.ports[region.Index]
+	if port.deviceNode != "" {
+		spec.DeviceNodes = []string{port.deviceNode}
+	}
+	spec.Mounts = []string{toHostSysfsPath(backend.sysfsRoot, port.sysfsPath)}
+	return spec
+}
+
+// The AFU loaded into the ports, as reported by the driver
+func (backend *dflBackend) LoadedBitstream(device *FPGADevice, region Region) string {
+	ports, err := backend.ports(device, region)
+	if err != nil {
+		return ""
+	}
+	var afuIDs []string
+	for _, port := range ports {
+		afuID := readDFLID(path.Join(device.dfl.ports[port].sysfsPath, "afu_id"))
+		if afuID != "" {
+			afuIDs = append(afuIDs, "afu:"+afuID)
+		}
+	}
+	return strings.Join(afuIDs, ",")
+}
+
+// Checks that neither the FME nor the ports of a DFL FPGA report errors
+type dflErrorsProbe struct{}
+
+func (probe *dflErrorsProbe) Name() string {
+	return "dfl-errors"
+}
+
+func (probe *dflErrorsProbe) Check(device *FPGADevice) error {
+	if device.dfl == nil {
+		return nil
+	}
+	errorFiles, _ := filepath.Glob(path.Join(device.dfl.fmePath, "errors/*_errors"))
+	for _, port := range device.dfl.ports {
+		errorFiles = append(errorFiles, path.Join(port.sysfsPath, "errors/errors"))
+	}
+	for _, errorFile := range errorFiles {
+		// Writing to inject_errors injects errors, it isn't one
+		if path.Base(errorFile) == "inject_errors" {
+			continue
+		}
+		dat, err := ioutil.ReadFile(errorFile)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(string(dat)), 0, 64)
+		if err != nil {
+			return fmt.Errorf("cannot parse '%s': %v", errorFile, err)
+		}
+		if value != 0 {
+			return fmt.Errorf("'%s' reports 0x%x", errorFile, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"testing"
+)
+
+// Add a PAC Arria 10 driven by the DFL driver, with its FME and the given
+// ports under its FPGA region, and their device nodes
+func addDFLFPGA(sysfs *fakeTree, dev *fakeTree, index int, address string, ports ...int) {
+	function := sysfs.addPCIFunction(address, "0x8086", "0x09c4")
+	region := path.Join(function, "fpga_region", fmt.Sprintf("region%d", index))
+	fme := fmt.Sprintf("dfl-fme.%d", index)
+	sysfs.write(path.Join(region, fme, "pr/interface_id"), "F3C99413-5081-4AAD-BCED-07EB84A6D0BB\n")
+	dev.write(fme, "")
+	for _, port := range ports {
+		name := fmt.Sprintf("dfl-port.%d", port)
+		sysfs.write(path.Join(region, name, "afu_id"), "0\n")
+		dev.write(name, "")
+	}
+	sysfs.link(path.Join("class/fpga_region", fmt.Sprintf("region%d", index)), region)
+}
+
+func newFakeDFLBackend(t *testing.T, sysfs *fakeTree, dev *fakeTree) Backend {
+	manager, _ := newFakeManager(t, "operating")
+	backend, err := newDFLBackend(&BackendOptions{SysfsRoot: sysfs.root, DevRoot: dev.root, Manager: manager})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestDFLDiscovery(t *testing.T) {
+	sysfs := newFakeTree(t)
+	dev := newFakeTree(t)
+	addDFLFPGA(sysfs, dev, 0, "0000:3b:00.0", 0)
+	addDFLFPGA(sysfs, dev, 1, "0000:af:00.0", 10, 2)
+	found := newFakeDFLBackend(t, sysfs, dev).Discover()
+	if len(found) != 2 {
+		t.Fatalf("found %d FPGAs, want 2", len(found))
+	}
+	tests := []struct {
+		identity    string
+		ports       []string
+		deviceNodes []string
+	}{
+		{"pci-0000-3b-00.0", []string{"dfl-port.0"}, []string{"/dev/dfl-fme.0", "/dev/dfl-port.0"}},
+		{"pci-0000-af-00.0", []string{"dfl-port.2", "dfl-port.10"}, []string{"/dev/dfl-fme.1", "/dev/dfl-port.2", "/dev/dfl-port.10"}},
+	}
+	for index, test := range tests {
+		fpga := found[index]
+		if fpga.vendorName != "intel.com" || fpga.boardName != "pac-a10" || fpga.identity != test.identity {
+			t.Errorf("FPGA %d is %s/%s-%s, want intel.com/pac-a10-%s", index, fpga.vendorName, fpga.boardName, fpga.identity, test.identity)
+		}
+		var ports []string
+		for _, port := range fpga.device.dfl.ports {
+			ports = append(ports, port.name)
+		}
+		if !equalStrings(ports, test.ports) {
+			t.Errorf("FPGA %d has ports %v, want %v", index, ports, test.ports)
+		}
+		if !equalStrings(fpga.device.deviceNodes, test.deviceNodes) {
+			t.Errorf("FPGA %d has device nodes %v, want %v", index, fpga.device.deviceNodes, test.deviceNodes)
+		}
+		if fpga.device.dfl.interfaceID != "f3c9941350814aadbced07eb84a6d0bb" {
+			t.Errorf("FPGA %d has interface ID %s", index, fpga.device.dfl.interfaceID)
+		}
+	}
+}
+
+// DFL FPGAs are only split into as many tenants as they have ports
+func TestDFLTenantsMatchPorts(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants []TenantConfig
+		found   []string
+		// The outcome of reloading into one tenant class of one port
+		reload string
+	}{
+		{"entire FPGAs", nil, []string{"pci-0000-3b-00.0", "pci-0000-af-00.0"}, RELOAD_REFUSED},
+		{"one port", []TenantConfig{{Name: "port", Count: 1}}, []string{"pci-0000-3b-00.0"}, RELOAD_UNCHANGED},
+		{"two ports", []TenantConfig{{Name: "port", Count: 2}}, []string{"pci-0000-af-00.0"}, RELOAD_REFUSED},
+		{"renamed class", []TenantConfig{{Name: "other", Count: 1}}, []string{"pci-0000-3b-00.0"}, RELOAD_UPDATED},
+		{"two classes", []TenantConfig{{Name: "port", Count: 1}, {Name: "other", Count: 1}}, nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sysfs := newFakeTree(t)
+			dev := newFakeTree(t)
+			addDFLFPGA(sysfs, dev, 0, "0000:3b:00.0", 0)
+			addDFLFPGA(sysfs, dev, 1, "0000:af:00.0", 0, 1)
+			config := &Config{Boards: []BoardConfig{{Vendor: "intel.com", Board: "pac-a10", Tenants: test.tenants}}}
+			plugins, _ := getAllDevices([]Backend{newFakeDFLBackend(t, sysfs, dev)}, config, nil)
+			var found []string
+			for _, plugin := range plugins {
+				for _, device := range plugin.devices {
+					found = append(found, device.stableID[len("intel.com/pac-a10-"):])
+					if len(test.tenants) == 1 && len(device.children) != test.tenants[0].Count {
+						t.Errorf("%s has %d tenants, want %d", device.ID, len(device.children), test.tenants[0].Count)
+					}
+				}
+			}
+			if !equalStrings(found, test.found) {
+				t.Errorf("found %v, want %v", found, test.found)
+			}
+			if len(plugins) == 0 {
+				return
+			}
+			// Reloads may only split the FPGAs that were found into their
+			// ports too
+			reload := &Config{Boards: []BoardConfig{{Vendor: "intel.com", Board: "pac-a10", Tenants: []TenantConfig{{Name: "port", Count: 1}}}}}
+			if status := plugins[0].reloadTenants(reload); status.Result != test.reload {
+				t.Errorf("reload into one port was %s, want %s", status.Result, test.reload)
+			}
+		})
+	}
+}
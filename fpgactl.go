@@ -0,0 +1,156 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const fpgactlUsage = `Usage: %s fpgactl [-socket path] command
+
+Commands:
+  list            List the devices of every plugin
+  unhealthy ID    Take a device out of service
+  free ID         Wipe a stuck device and mark it free
+  rediscover      Look for new FPGAs
+
+`
+
+// The host part of admin API URLs, the socket is what matters
+const adminURL = "http://fpga-device-plugin"
+
+// A client of the admin API of a running plugin
+type fpgactlClient struct {
+	client *http.Client
+}
+
+func newFpgactlClient(socketPath string) *fpgactlClient {
+	return &fpgactlClient{
+		client: &http.Client{
+			Timeout: time.Minute,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Make a call to the admin API and decode its reply into result, if given
+func (client *fpgactlClient) call(method string, path string, result interface{}) error {
+	request, err := http.NewRequest(method, adminURL+path, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("%s", strings.TrimSpace(string(body)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+func formatAllocated(allocated *time.Time) string {
+	if allocated == nil {
+		return "-"
+	}
+	return allocated.Format(time.RFC3339)
+}
+
+func formatBitstream(bitstream string) string {
+	if bitstream == "" {
+		return "-"
+	}
+	return bitstream
+}
+
+func (client *fpgactlClient) list() error {
+	var trees []AdminPlugin
+	err := client.call(http.MethodGet, "/devices", &trees)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tRESOURCE\tSTATUS\tHEALTH\tALLOCATED\tBITSTREAM")
+	for _, tree := range trees {
+		for _, device := range tree.Devices {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", device.ID, tree.Resource, device.Status, device.Health, formatAllocated(device.Allocated), formatBitstream(device.Bitstream))
+			for _, tenant := range device.Tenants {
+				fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\n", tenant.ID, tenant.Resource, tenant.Status, tenant.Health, formatAllocated(tenant.Allocated), formatBitstream(tenant.Bitstream))
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// Entry point of the fpgactl subcommand, returns the exit code
+func runFpgactl(args []string) int {
+	flags := flag.NewFlagSet("fpgactl", flag.ContinueOnError)
+	socketPath := flags.String("socket", AdminSocket, "Path of the admin socket of the plugin.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), fpgactlUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	client := newFpgactlClient(*socketPath)
+	var err error
+	switch {
+	case flags.NArg() == 1 && flags.Arg(0) == "list":
+		err = client.list()
+	case flags.NArg() == 2 && flags.Arg(0) == "unhealthy":
+		err = client.call(http.MethodPost, "/devices/unhealthy?id="+url.QueryEscape(flags.Arg(1)), nil)
+	case flags.NArg() == 2 && flags.Arg(0) == "free":
+		err = client.call(http.MethodPost, "/devices/free?id="+url.QueryEscape(flags.Arg(1)), nil)
+	case flags.NArg() == 1 && flags.Arg(0) == "rediscover":
+		var result struct {
+			Found int `json:"found"`
+		}
+		err = client.call(http.MethodPost, "/rediscover", &result)
+		if err == nil {
+			fmt.Printf("Found %d new FPGAs\n", result.Found)
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fpgactl: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,247 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Flags understood by the fpga_manager `flags` attribute
+const (
+	FPGA_MGR_FULL_RECONFIG    string = "0"
+	FPGA_MGR_PARTIAL_RECONFIG string = "1"
+)
+
+// The state fpga_manager reports after a successful programming
+const FPGA_MGR_OPERATING string = "operating"
+
+// Where bitstreams from outside the firmware directory are copied to, relative
+// to the firmware directory, so that the kernel firmware loader finds them
+const stagedBitstreamDir = "fpga-device-plugin"
+
+// Programs FPGAs through the Linux fpga_manager firmware interface, that is
+// `/sys/class/fpga_manager/fpgaN/{flags,firmware,state}`. The bitstreams are
+// loaded by the kernel firmware loader, so they are given by their name
+// relative to the firmware directory.
+type FPGAManager struct {
+	// Where sysfs is mounted, usually `/sys`
+	sysfsRoot string
+	// Where the kernel looks for firmware, usually `/lib/firmware`
+	firmwareDir string
+	// Where accelerator bitstreams are looked up, the firmware directory if empty
+	bitstreamDir string
+	// How long to wait for the FPGA to be operating after programming
+	timeout      time.Duration
+	pollInterval time.Duration
+	// Each fpga_manager can only program one bitstream at a time, different
+	// ones are programmed in parallel
+	locks map[string]*sync.Mutex
+	mutex sync.Mutex
+}
+
+func NewFPGAManager(sysfsRoot string, firmwareDir string, bitstreamDir string) *FPGAManager {
+	if bitstreamDir == "" {
+		bitstreamDir = firmwareDir
+	}
+	return &FPGAManager{
+		sysfsRoot:    sysfsRoot,
+		firmwareDir:  firmwareDir,
+		bitstreamDir: bitstreamDir,
+		timeout:      10 * time.Second,
+		pollInterval: 100 * time.Millisecond,
+		locks:        make(map[string]*sync.Mutex),
+	}
+}
+
+// Bitstreams from outside the firmware directory are copied into it, which
+// only works if the plugin may write there
+func (manager *FPGAManager) CheckStaging() error {
+	if relative, err := filepath.Rel(manager.firmwareDir, manager.bitstreamDir); err == nil && !strings.HasPrefix(relative, "..") {
+		return nil
+	}
+	stagingDir := filepath.Join(manager.firmwareDir, stagedBitstreamDir)
+	err := os.MkdirAll(stagingDir, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create '%s' to copy bitstreams from '%s' into: %v", stagingDir, manager.bitstreamDir, err)
+	}
+	probe, err := ioutil.TempFile(stagingDir, ".probe")
+	if err != nil {
+		return fmt.Errorf("cannot copy bitstreams from '%s' into '%s': %v", manager.bitstreamDir, stagingDir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// The lock of one fpga_manager
+func (manager *FPGAManager) lock(managerName string) *sync.Mutex {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	lock, ok := manager.locks[managerName]
+	if !ok {
+		lock = &sync.Mutex{}
+		manager.locks[managerName] = lock
+	}
+	return lock
+}
+
+func (manager *FPGAManager) managerPath(managerName string) string {
+	return path.Join(manager.sysfsRoot, "class/fpga_manager", managerName)
+}
+
+// Find the first fpga_manager in the system, empty if there is none
+func (manager *FPGAManager) firstManager() string {
+	entries, err := ioutil.ReadDir(path.Join(manager.sysfsRoot, "class/fpga_manager"))
+	if err != nil || len(entries) == 0 {
+		return ""
+	}
+	return entries[0].Name()
+}
+
+func (manager *FPGAManager) state(managerName string) (string, error) {
+	dat, err := ioutil.ReadFile(path.Join(manager.managerPath(managerName), "state"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(dat)), nil
+}
+
+// Program a bitstream into an FPGA, or a PR region of it if partial is set,
+// and wait until the manager reports it is operating.
+func (manager *FPGAManager) Program(managerName string, bitstream string, partial bool) error {
+	return manager.programUntil(managerName, bitstream, partial, time.Now().Add(manager.timeout))
+}
+
+// Same as Program, but gives up at the given deadline. The bitstream is a
+// name relative to the firmware directory.
+func (manager *FPGAManager) programUntil(managerName string, bitstream string, partial bool, deadline time.Time) error {
+	lock := manager.lock(managerName)
+	lock.Lock()
+	defer lock.Unlock()
+	if time.Now().After(deadline) {
+		return fmt.Errorf("no time left to program '%s'", bitstream)
+	}
+	if _, err := os.Stat(path.Join(manager.firmwareDir, bitstream)); err != nil {
+		return fmt.Errorf("bitstream '%s' not found in '%s': %v", bitstream, manager.firmwareDir, err)
+	}
+	managerPath := manager.managerPath(managerName)
+	flags := FPGA_MGR_FULL_RECONFIG
+	if partial {
+		flags = FPGA_MGR_PARTIAL_RECONFIG
+	}
+	err := ioutil.WriteFile(path.Join(managerPath, "flags"), []byte(flags), 0644)
+	if err != nil {
+		return fmt.Errorf("cannot set flags of '%s': %v", managerPath, err)
+	}
+	err = ioutil.WriteFile(path.Join(managerPath, "firmware"), []byte(bitstream), 0644)
+	if err != nil {
+		return fmt.Errorf("cannot program '%s' into '%s': %v", bitstream, managerPath, err)
+	}
+	// Writing the firmware is usually synchronous, but don't count on it
+	for {
+		state, err := manager.state(managerName)
+		if err != nil {
+			return fmt.Errorf("cannot read state of '%s': %v", managerPath, err)
+		}
+		if state == FPGA_MGR_OPERATING {
+			break
+		}
+		if strings.Contains(state, "error") {
+			return fmt.Errorf("programming '%s' into '%s' failed with state '%s'", bitstream, managerPath, state)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out programming '%s' into '%s', last state '%s'", bitstream, managerPath, state)
+		}
+		time.Sleep(manager.pollInterval)
+	}
+	log.WithFields(log.Fields{
+		"Manager":   managerName,
+		"Bitstream": bitstream,
+		"Partial":   partial,
+	}).Debug("Programmed FPGA")
+	return nil
+}
+
+// Bitstreams are named relative to the bitstream directory, and can't leave it
+func validBitstreamName(bitstream string) bool {
+	clean := filepath.Clean(bitstream)
+	return !filepath.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// Find an accelerator bitstream in the bitstream directory, and return the
+// name the kernel firmware loader knows it by. Bitstreams outside of the
+// firmware directory are copied into it first.
+func (manager *FPGAManager) resolveBitstream(bitstream string) (string, error) {
+	if bitstream == "" || !validBitstreamName(bitstream) {
+		return "", fmt.Errorf("invalid bitstream name '%s'", bitstream)
+	}
+	source := filepath.Join(manager.bitstreamDir, bitstream)
+	if _, err := os.Stat(source); err != nil {
+		return "", fmt.Errorf("bitstream '%s' not found in '%s': %v", bitstream, manager.bitstreamDir, err)
+	}
+	if relative, err := filepath.Rel(manager.firmwareDir, source); err == nil && !strings.HasPrefix(relative, "..") {
+		return relative, nil
+	}
+	staged := filepath.Join(stagedBitstreamDir, filepath.Clean(bitstream))
+	err := copyFile(source, filepath.Join(manager.firmwareDir, staged))
+	if err != nil {
+		return "", fmt.Errorf("cannot copy bitstream '%s' into '%s': %v", bitstream, manager.firmwareDir, err)
+	}
+	return staged, nil
+}
+
+// Copy a file, replacing the destination atomically
+func copyFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	err = os.MkdirAll(filepath.Dir(destination), 0755)
+	if err != nil {
+		return err
+	}
+	out, err := ioutil.TempFile(filepath.Dir(destination), filepath.Base(destination)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(out.Name(), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), destination)
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// A fake fpga_manager fpga0, in the given state, with blank.bin in the
+// firmware directory
+func newFakeManager(t *testing.T, state string) (*FPGAManager, *fakeTree) {
+	sysfs := newFakeTree(t)
+	firmware := newFakeTree(t)
+	sysfs.write("class/fpga_manager/fpga0/state", state+"\n")
+	sysfs.write("class/fpga_manager/fpga0/flags", "")
+	sysfs.write("class/fpga_manager/fpga0/firmware", "")
+	firmware.write("blank.bin", "bitstream")
+	manager := NewFPGAManager(sysfs.root, firmware.root, "")
+	manager.timeout = 50 * time.Millisecond
+	manager.pollInterval = time.Millisecond
+	return manager, sysfs
+}
+
+func TestFPGAManagerProgram(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     string
+		bitstream string
+		partial   bool
+		err       string
+		flags     string
+		firmware  string
+	}{
+		{"full", "operating", "blank.bin", false, "", "0", "blank.bin"},
+		{"partial", "operating", "blank.bin", true, "", "1", "blank.bin"},
+		{"missing bitstream", "operating", "missing.bin", false, "not found", "", ""},
+		{"error state", "write error", "blank.bin", false, "failed with state 'write error'", "0", "blank.bin"},
+		{"never operating", "write init", "blank.bin", false, "timed out", "0", "blank.bin"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager, sysfs := newFakeManager(t, test.state)
+			err := manager.Program("fpga0", test.bitstream, test.partial)
+			if test.err == "" && err != nil {
+				t.Fatalf("programming failed: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("programming returned %v, want an error containing %q", err, test.err)
+			}
+			if flags := sysfs.read("class/fpga_manager/fpga0/flags"); flags != test.flags {
+				t.Errorf("flags is %q, want %q", flags, test.flags)
+			}
+			if firmware := sysfs.read("class/fpga_manager/fpga0/firmware"); firmware != test.firmware {
+				t.Errorf("firmware is %q, want %q", firmware, test.firmware)
+			}
+		})
+	}
+}
+
+func TestFPGAManagerDeadline(t *testing.T) {
+	manager, sysfs := newFakeManager(t, "operating")
+	err := manager.programUntil("fpga0", "blank.bin", false, time.Now().Add(-time.Second))
+	if err == nil {
+		t.Fatal("programmed past the deadline")
+	}
+	if firmware := sysfs.read("class/fpga_manager/fpga0/firmware"); firmware != "" {
+		t.Errorf("firmware is %q past the deadline, want nothing written", firmware)
+	}
+}
+
+func TestFPGAManagerFirstManager(t *testing.T) {
+	manager, sysfs := newFakeManager(t, "operating")
+	sysfs.mkdir("class/fpga_manager/fpga1")
+	if name := manager.firstManager(); name != "fpga0" {
+		t.Errorf("first manager is %q, want fpga0", name)
+	}
+	empty := NewFPGAManager(newFakeTree(t).root, "/lib/firmware", "")
+	if name := empty.firstManager(); name != "" {
+		t.Errorf("first manager is %q without any, want none", name)
+	}
+}
+
+// Released FPGAs and PR regions are wiped through their fpga_manager
+func TestFPGAManagerWipe(t *testing.T) {
+	tests := []struct {
+		region         Region
+		blankBitstream string
+		flags          string
+		firmware       string
+	}{
+		{WHOLE_FPGA, "blank.bin", "0", "blank.bin"},
+		{Region{"tenant", 2}, "blank.bin", "1", "blank.bin"},
+		{WHOLE_FPGA, "", "", ""},
+	}
+	for _, test := range tests {
+		manager, sysfs := newFakeManager(t, "operating")
+		device := &FPGADevice{manager: manager, managerName: "fpga0"}
+		err := (&fpgaManagerBackend{}).Reset(device, test.region, test.blankBitstream)
+		if err != nil {
+			t.Fatalf("wiping %s failed: %v", test.region, err)
+		}
+		if flags := sysfs.read("class/fpga_manager/fpga0/flags"); flags != test.flags {
+			t.Errorf("wiping %s set flags %q, want %q", test.region, flags, test.flags)
+		}
+		if firmware := sysfs.read("class/fpga_manager/fpga0/firmware"); firmware != test.firmware {
+			t.Errorf("wiping %s wrote firmware %q, want %q", test.region, firmware, test.firmware)
+		}
+	}
+}
+
+// Different fpga_managers are programmed in parallel
+func TestFPGAManagerParallel(t *testing.T) {
+	manager, sysfs := newFakeManager(t, "operating")
+	sysfs.write("class/fpga_manager/fpga1/state", "operating\n")
+	busy := manager.lock("fpga0")
+	busy.Lock()
+	defer busy.Unlock()
+	done := make(chan error)
+	go func() {
+		done <- manager.Program("fpga1", "blank.bin", false)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("programming fpga1 failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("programming fpga1 waited for fpga0")
+	}
+}
+
+// Bitstreams outside the firmware directory need it to be writable
+func TestFPGAManagerCheckStaging(t *testing.T) {
+	firmware := newFakeTree(t)
+	firmware.write("readonly", "not a directory")
+	tests := []struct {
+		firmwareDir  string
+		bitstreamDir string
+		fails        bool
+	}{
+		{firmware.root, "", false},
+		{firmware.root, firmware.path("accelerators"), false},
+		{firmware.root, newFakeTree(t).root, false},
+		{firmware.path("readonly"), "", false},
+		{firmware.path("readonly"), newFakeTree(t).root, true},
+	}
+	for _, test := range tests {
+		manager := NewFPGAManager("/sys", test.firmwareDir, test.bitstreamDir)
+		if err := manager.CheckStaging(); (err != nil) != test.fails {
+			t.Errorf("checking firmware dir %s for bitstream dir %s returned %v", test.firmwareDir, test.bitstreamDir, err)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+	log "github.com/sirupsen/logrus"
+)
+
+// A health probe checks one aspect of an FPGA, and returns an error
+// describing the problem if the FPGA is unhealthy. Probes run without the
+// plugin lock, so they should only look at what doesn't change after
+// discovery. Every backend has its own, see Backend.Health.
+type HealthProbe interface {
+	Name() string
+	Check(device *FPGADevice) error
+}
+
+// Checks that the FPGA is still there, its PCI function for PCIe FPGAs and
+// its device tree node for MPSoCs
+type presenceProbe struct {
+	sysfsRoot string
+}
+
+func (probe *presenceProbe) Name() string {
+	return "presence"
+}
+
+func (probe *presenceProbe) Check(device *FPGADevice) error {
+	var devicePath string
+	if device.pciAddress != "" {
+		devicePath = path.Join(probe.sysfsRoot, "bus/pci/devices", device.pciAddress)
+	} else if device.deviceTreePath != "" {
+		devicePath = device.deviceTreePath
+	} else {
+		return nil
+	}
+	if _, err := os.Stat(devicePath); err != nil {
+		return fmt.Errorf("'%s' is gone: %v", devicePath, err)
+	}
+	return nil
+}
+
+// Checks that the fpga_manager of the FPGA doesn't report an error
+type managerStateProbe struct{}
+
+func (probe *managerStateProbe) Name() string {
+	return "fpga-manager"
+}
+
+func (probe *managerStateProbe) Check(device *FPGADevice) error {
+	if device.manager == nil || device.managerName == "" {
+		return nil
+	}
+	state, err := device.manager.state(device.managerName)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(state, "error") {
+		return fmt.Errorf("fpga_manager '%s' is in state '%s'", device.managerName, state)
+	}
+	return nil
+}
+
+// Checks the hwmon temperature and voltage sensors of the FPGA against the
+// thresholds of its board
+type hwmonProbe struct {
+	config HealthConfig
+}
+
+func (probe *hwmonProbe) Name() string {
+	return "hwmon"
+}
+
+// Read a hwmon attribute, hwmon reports millidegrees and millivolts
+func readHwmonValue(attributePath string) (float64, error) {
+	dat, err := ioutil.ReadFile(attributePath)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(dat)), 64)
+	if err != nil {
+		return 0, err
+	}
+	return value / 1000, nil
+}
+
+// The label of a hwmon sensor, its name (e.g. in0) if it has none
+func hwmonLabel(hwmonPath string, sensor string) string {
+	dat, err := ioutil.ReadFile(path.Join(hwmonPath, sensor+"_label"))
+	if err != nil {
+		return sensor
+	}
+	return strings.TrimSpace(string(dat))
+}
+
+func (probe *hwmonProbe) Check(device *FPGADevice) error {
+	if probe.config.MaxTemperature == 0 && len(probe.config.Voltages) == 0 {
+		return nil
+	}
+	for _, hwmonPath := range device.hwmon {
+		inputs, _ := filepath.Glob(path.Join(hwmonPath, "*_input"))
+		for _, input := range inputs {
+			sensor := strings.TrimSuffix(path.Base(input), "_input")
+			value, err := readHwmonValue(input)
+			if err != nil {
+				return fmt.Errorf("cannot read sensor '%s': %v", input, err)
+			}
+			label := hwmonLabel(hwmonPath, sensor)
+			if strings.HasPrefix(sensor, "temp") && probe.config.MaxTemperature != 0 && value > probe.config.MaxTemperature {
+				return fmt.Errorf("temperature '%s' is %.1fC, above %.1fC", label, value, probe.config.MaxTemperature)
+			}
+			if !strings.HasPrefix(sensor, "in") {
+				continue
+			}
+			for _, voltage := range probe.config.Voltages {
+				if voltage.Sensor != label && voltage.Sensor != sensor {
+					continue
+				}
+				if value < voltage.Min || value > voltage.Max {
+					return fmt.Errorf("voltage '%s' is %.3fV, outside of %.3fV to %.3fV", label, value, voltage.Min, voltage.Max)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// The probes run on an FPGA, those of its backend and the thresholds of its
+// board
+func defaultHealthProbes(plugin *FPGADevicePlugin, device *FPGADevice) []HealthProbe {
+	return append(device.backend.Health(), &hwmonProbe{config: plugin.health})
+}
+
+// Hysteresis of the health monitor, an FPGA must fail or pass this many
+// checks in a row before its health changes
+const (
+	healthFailureThreshold = 3
+	healthSuccessThreshold = 3
+)
+
+// What the health monitor knows about an FPGA
+type healthState struct {
+	healthy   bool
+	failures  int
+	successes int
+	// Whether we took the FPGA out of service, so that we are the ones to
+	// bring it back. FPGAs that failed to reset stay unhealthy.
+	disabled bool
+}
+
+// Periodically runs the health probes on all FPGAs, and marks them unhealthy
+// or healthy again after enough consecutive failures or successes
+type HealthMonitor struct {
+	plugins  []*FPGADevicePlugin
+	interval time.Duration
+	// Guards the list of plugins, which grows when FPGAs are rediscovered
+	mutex sync.RWMutex
+	// Builds the probes of an FPGA, replaceable to test without hardware
+	probes           func(plugin *FPGADevicePlugin, device *FPGADevice) []HealthProbe
+	failureThreshold int
+	successThreshold int
+	states           map[*FPGADevice]*healthState
+	stop             chan struct{}
+	waitGroup        sync.WaitGroup
+}
+
+func NewHealthMonitor(plugins []*FPGADevicePlugin, interval time.Duration) *HealthMonitor {
+	return &HealthMonitor{
+		plugins:          plugins,
+		interval:         interval,
+		probes:           defaultHealthProbes,
+		failureThreshold: healthFailureThreshold,
+		successThreshold: healthSuccessThreshold,
+		states:           make(map[*FPGADevice]*healthState),
+	}
+}
+
+func (monitor *HealthMonitor) setPlugins(plugins []*FPGADevicePlugin) {
+	monitor.mutex.Lock()
+	monitor.plugins = plugins
+	monitor.mutex.Unlock()
+}
+
+func (monitor *HealthMonitor) Start() {
+	monitor.stop = make(chan struct{})
+	monitor.waitGroup.Add(1)
+	go func() {
+		defer monitor.waitGroup.Done()
+		ticker := time.NewTicker(monitor.interval)
+		defer ticker.Stop()
+		for {
+			monitor.check()
+			select {
+			case <-ticker.C:
+			case <-monitor.stop:
+				return
+			}
+		}
+	}()
+	log.WithFields(log.Fields{
+		"Interval": monitor.interval,
+	}).Info("Started health monitor.")
+}
+
+func (monitor *HealthMonitor) Stop() {
+	close(monitor.stop)
+	monitor.waitGroup.Wait()
+}
+
+// Run all probes on all FPGAs once
+func (monitor *HealthMonitor) check() {
+	monitor.mutex.RLock()
+	plugins := monitor.plugins
+	monitor.mutex.RUnlock()
+	for _, plugin := range plugins {
+		plugin.mutex.RLock()
+		devices := append([]*FPGADevice{}, plugin.devices...)
+		probes := make([][]HealthProbe, len(devices))
+		for index, device := range devices {
+			probes[index] = monitor.probes(plugin, device)
+		}
+		plugin.mutex.RUnlock()
+		// Probes may be slow, run them without the lock
+		results := make([]error, len(devices))
+		for index, device := range devices {
+			results[index] = runHealthProbes(probes[index], device)
+		}
+		plugin.mutex.Lock()
+		for index, device := range devices {
+			monitor.update(device, results[index])
+		}
+		plugin.mutex.Unlock()
+	}
+}
+
+func runHealthProbes(probes []HealthProbe, device *FPGADevice) error {
+	for _, probe := range probes {
+		err := probe.Check(device)
+		if err != nil {
+			observeHealthFailure(device.resource, probe.Name())
+			return fmt.Errorf("%s: %v", probe.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Count the result of a check, and change the health of the FPGA once there
+// were enough of the same in a row. Must be called with the plugin lock held.
+func (monitor *HealthMonitor) update(device *FPGADevice, err error) {
+	state, ok := monitor.states[device]
+	if !ok {
+		state = &healthState{healthy: true}
+		monitor.states[device] = state
+	}
+	if err != nil {
+		state.failures++
+		state.successes = 0
+		if state.healthy && state.failures >= monitor.failureThreshold {
+			state.healthy = false
+			log.WithFields(log.Fields{
+				"ID":    device.ID,
+				"Error": err,
+			}).Error("FPGA device failed its health checks. Device is now unhealthy")
+		}
+	} else {
+		state.successes++
+		state.failures = 0
+		if !state.healthy && state.successes >= monitor.successThreshold {
+			state.healthy = true
+			log.WithFields(log.Fields{
+				"ID": device.ID,
+			}).Info("FPGA device passes its health checks again")
+		}
+	}
+	if state.healthy {
+		monitor.enable(device, state)
+	} else {
+		monitor.disable(device, state)
+	}
+}
+
+// Keep an unhealthy FPGA out of service. FPGAs that are in use are DRAINING
+// until they are released, FPGAs whose tenants are in use are only reported
+// unhealthy until then. FPGAs being programmed or wiped are dealt with on
+// the next check.
+func (monitor *HealthMonitor) disable(device *FPGADevice, state *healthState) {
+	switch device.status {
+	case FREE:
+		device.SetUnhealthy()
+		state.disabled = true
+	case RESERVED, USED:
+		err := device.setState(DRAINING)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"ID":    device.ID,
+				"Error": err,
+			}).Error("Cannot drain FPGA device")
+			return
+		}
+		state.disabled = true
+	case BLOCKED:
+		device.setHealth(pluginapi.Unhealthy)
+	}
+}
+
+// Bring an FPGA we took out of service back
+func (monitor *HealthMonitor) enable(device *FPGADevice, state *healthState) {
+	var err error
+	switch device.status {
+	case UNHEALTHY:
+		if state.disabled {
+			err = device.SetFree()
+		}
+	case DRAINING:
+		// Unless someone else drains it, e.g. through the admin API
+		if state.disabled {
+			err = device.setState(USED)
+		}
+	case BLOCKED:
+		device.setHealth(pluginapi.Healthy)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"ID":    device.ID,
+			"Error": err,
+		}).Error("Cannot bring FPGA device back")
+	}
+	state.disabled = false
+}
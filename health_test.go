@@ -0,0 +1,142 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+)
+
+// A probe failing for the FPGAs in its set
+type fakeProbe struct {
+	failing map[*FPGADevice]bool
+}
+
+func (probe *fakeProbe) Name() string {
+	return "fake"
+}
+
+func (probe *fakeProbe) Check(device *FPGADevice) error {
+	if probe.failing[device] {
+		return errors.New("simulated failure")
+	}
+	return nil
+}
+
+// A monitor of the given plugins running only the fake probe
+func newFakeMonitor(plugins []*FPGADevicePlugin) (*HealthMonitor, *fakeProbe) {
+	probe := &fakeProbe{failing: make(map[*FPGADevice]bool)}
+	monitor := NewHealthMonitor(plugins, 0)
+	monitor.probes = func(plugin *FPGADevicePlugin, device *FPGADevice) []HealthProbe {
+		return []HealthProbe{probe}
+	}
+	return monitor, probe
+}
+
+// FPGAs only change health after enough checks in a row agree
+func TestHealthHysteresis(t *testing.T) {
+	plugins := newSimPlugins(t, simConfig(1))
+	device := plugins[0].devices[0]
+	monitor, probe := newFakeMonitor(plugins)
+	steps := []struct {
+		failing bool
+		state   DeviceState
+	}{
+		{true, FREE},
+		{true, FREE},
+		{false, FREE},
+		{true, FREE},
+		{true, FREE},
+		{true, UNHEALTHY},
+		{false, UNHEALTHY},
+		{false, UNHEALTHY},
+		{true, UNHEALTHY},
+		{false, UNHEALTHY},
+		{false, UNHEALTHY},
+		{false, FREE},
+	}
+	for index, step := range steps {
+		probe.failing[device] = step.failing
+		monitor.check()
+		if device.status != step.state {
+			t.Fatalf("check %d: device is %s, want %s", index, device.status, step.state)
+		}
+	}
+}
+
+// What the monitor does to an FPGA in each state when it turns unhealthy, and
+// once it is healthy again
+func TestHealthTransitions(t *testing.T) {
+	tests := []struct {
+		name      string
+		prepare   func(device *FPGADevice) error
+		unhealthy DeviceState
+		health    string
+		healthy   DeviceState
+	}{
+		{"free", func(device *FPGADevice) error {
+			return nil
+		}, UNHEALTHY, pluginapi.Unhealthy, FREE},
+		{"used", func(device *FPGADevice) error {
+			return device.setState(USED)
+		}, DRAINING, pluginapi.Unhealthy, USED},
+		{"reserved", func(device *FPGADevice) error {
+			return device.setState(RESERVED)
+		}, DRAINING, pluginapi.Unhealthy, USED},
+		{"blocked", func(device *FPGADevice) error {
+			return device.children[0].setState(USED)
+		}, BLOCKED, pluginapi.Unhealthy, BLOCKED},
+		// Devices taken out of service by someone else stay out of it
+		{"drained", func(device *FPGADevice) error {
+			if err := device.setState(USED); err != nil {
+				return err
+			}
+			return device.setState(DRAINING)
+		}, DRAINING, pluginapi.Unhealthy, DRAINING},
+		{"failed reset", func(device *FPGADevice) error {
+			device.SetUnhealthy()
+			return nil
+		}, UNHEALTHY, pluginapi.Unhealthy, UNHEALTHY},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugins := newSimPlugins(t, simConfig(1, TenantConfig{Name: "tenant", Count: 2}))
+			device := plugins[0].devices[0]
+			if err := test.prepare(device); err != nil {
+				t.Fatal(err)
+			}
+			monitor, probe := newFakeMonitor(plugins)
+			monitor.failureThreshold = 1
+			monitor.successThreshold = 1
+			probe.failing[device] = true
+			monitor.check()
+			if device.status != test.unhealthy || device.Health != test.health {
+				t.Errorf("unhealthy device is %s and %s, want %s and %s", device.status, device.Health, test.unhealthy, test.health)
+			}
+			probe.failing[device] = false
+			monitor.check()
+			if device.status != test.healthy {
+				t.Errorf("healthy device is %s, want %s", device.status, test.healthy)
+			}
+			if device.status != UNHEALTHY && device.status != DRAINING && device.Health != pluginapi.Healthy {
+				t.Errorf("healthy %s device is reported %s", device.status, device.Health)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// A directory tree standing in for sysfs, /dev or the firmware directory,
+// removed when the test ends
+type fakeTree struct {
+	t    *testing.T
+	root string
+}
+
+func newFakeTree(t *testing.T) *fakeTree {
+	t.Helper()
+	root, err := ioutil.TempDir("", "fpga-device-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Resolve the root, so that paths resolved by the code under test
+	// compare equal to ours
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(root)
+	})
+	return &fakeTree{t: t, root: root}
+}
+
+// The absolute path of a path relative to the tree
+func (tree *fakeTree) path(relative string) string {
+	return path.Join(tree.root, relative)
+}
+
+func (tree *fakeTree) mkdir(relative string) {
+	tree.t.Helper()
+	err := os.MkdirAll(tree.path(relative), 0755)
+	if err != nil {
+		tree.t.Fatal(err)
+	}
+}
+
+// Write a file, creating its directories
+func (tree *fakeTree) write(relative string, content string) {
+	tree.t.Helper()
+	tree.mkdir(path.Dir(relative))
+	err := ioutil.WriteFile(tree.path(relative), []byte(content), 0644)
+	if err != nil {
+		tree.t.Fatal(err)
+	}
+}
+
+// Read a file, empty if it doesn't exist
+func (tree *fakeTree) read(relative string) string {
+	dat, _ := ioutil.ReadFile(tree.path(relative))
+	return string(dat)
+}
+
+// Create a symlink to another path of the tree, like sysfs class and bus
+// entries point into /sys/devices
+func (tree *fakeTree) link(relative string, target string) {
+	tree.t.Helper()
+	tree.mkdir(path.Dir(relative))
+	err := os.Symlink(tree.path(target), tree.path(relative))
+	if err != nil {
+		tree.t.Fatal(err)
+	}
+}
+
+// Add a PCI function under /sys/devices, listed in /sys/bus/pci/devices
+func (tree *fakeTree) addPCIFunction(address string, vendorID string, deviceID string) string {
+	tree.t.Helper()
+	devicePath := path.Join("devices/pci0000:00", address)
+	tree.write(path.Join(devicePath, "vendor"), vendorID+"\n")
+	tree.write(path.Join(devicePath, "device"), deviceID+"\n")
+	tree.link(path.Join("bus/pci/devices", address), devicePath)
+	return devicePath
+}
+
+// A config with the given number of simulated FPGAs of one board, divided
+// into the given tenant classes
+func simConfig(count int, tenants ...TenantConfig) *Config {
+	return &Config{
+		Boards: []BoardConfig{{
+			Vendor:  "example.com",
+			Board:   "sim-board",
+			Tenants: tenants,
+		}},
+		Simulated: []SimulatedBoardConfig{{
+			Vendor: "example.com",
+			Board:  "sim-board",
+			Count:  count,
+		}},
+	}
+}
+
+// The plugins of the simulated boards of a config, found like at startup
+func newSimPlugins(t *testing.T, config *Config) []*FPGADevicePlugin {
+	t.Helper()
+	backend, err := newSimBackend(&BackendOptions{Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugins, _ := getAllDevices([]Backend{backend}, config, nil)
+	if len(plugins) != 1 {
+		t.Fatalf("found %d plugins, want 1", len(plugins))
+	}
+	return plugins
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Device IDs are derived from the identity of the hardware, so that an FPGA
+// keeps its ID no matter in which order FPGAs are found, and kubelet's and
+// our checkpoints stay valid across reboots and rescans:
+//
+//	FPGA ID   = <vendor> "/" <board> "-" <identity>
+//	identity  = "pci-" <domain> "-" <bus> "-" <slot> "." <function>
+//	          | "sn-" <serial>
+//	          | "mpsoc"
+//	          | "sim-" <index>
+//	tenant ID = <FPGA ID> "-" <tenant class> "-" <region index>
+//
+// Vendors, boards and tenant classes are made of letters, digits, `.`, `_`
+// and `-`, like the resource names they come from. PCI addresses are in
+// lowercase hex.
+//
+// PCIe FPGAs are identified by their PCI address, e.g. 0000:65:00.0 becomes
+// `xilinx.com/alveo-u250-pci-0000-65-00.0`. MPSoCs are identified by the
+// board serial number in their device tree, which the bootloader usually
+// reads from the board EEPROM. Characters other than letters and digits in
+// the serial are replaced by `_`. MPSoCs without a serial number are just
+// `mpsoc`, there is only ever one of them. Simulated FPGAs are numbered
+// within their board. Tenants are identified by their
+// FPGA, their class and the index of their PR region within that class, e.g.
+// `fidus.com/sidewinder-100-mpsoc-size1-1`.
+//
+// Earlier versions numbered devices in the order they were found, e.g.
+// `fidus.com/sidewinder-100-0` and its tenant `fidus.com/sidewinder-100-0-1`.
+// If kubelet still has such IDs assigned to containers, devices found on the
+// first start after upgrading keep them, see DeviceAliases.
+var (
+	stableIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+/[A-Za-z0-9._-]+-(pci-[0-9a-f]{4,}-[0-9a-f]{2}-[0-9a-f]{2}\.[0-7]|sn-[A-Za-z0-9_]+|mpsoc|sim-[0-9]+)(-[A-Za-z0-9._-]+-[0-9]+)?$`)
+	legacyIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+/[A-Za-z0-9._-]+-[0-9]+(-[0-9]+)?$`)
+	serialRegexp   = regexp.MustCompile(`[^A-Za-z0-9]`)
+)
+
+// Check that an ID follows the grammar above
+func validDeviceID(id string) bool {
+	return stableIDRegexp.MatchString(id)
+}
+
+// Check that an ID was given out by earlier versions. Boards may end in
+// numbers too, so IDs following the grammar above are not.
+func validLegacyDeviceID(id string) bool {
+	return legacyIDRegexp.MatchString(id) && !validDeviceID(id)
+}
+
+// The identity of a PCIe FPGA, from its PCI address
+func pciIdentity(pciAddress string) string {
+	return "pci-" + strings.ToLower(strings.Replace(pciAddress, ":", "-", -1))
+}
+
+// The identity of an MPSoC FPGA, from the serial number in the device tree
+func mpsocIdentity(serialPath string) string {
+	dat, err := ioutil.ReadFile(serialPath)
+	if err != nil {
+		return "mpsoc"
+	}
+	serial := strings.TrimRight(string(dat), "\x00\n")
+	if serial == "" {
+		return "mpsoc"
+	}
+	return "sn-" + serialRegexp.ReplaceAllString(serial, "_")
+}
+
+// The IDs devices had before IDs were derived from the hardware, by the ID
+// they would have now. These are recorded once, on the first start after
+// upgrading, and kept forever after, so that devices that are in use, and
+// any other place those IDs were written down, keep working. On disk it
+// looks like this:
+//
+//	{"aliases": {"fidus.com/sidewinder-100-mpsoc": "fidus.com/sidewinder-100-0"}}
+type DeviceAliases struct {
+	path    string
+	aliases map[string]string
+	// Whether there was no alias file, it is written once discovery is done
+	missing bool
+	// Whether we are upgrading from a version that numbered devices, so
+	// every device found is recorded under its old ID
+	upgrading bool
+	mutex     sync.Mutex
+}
+
+type aliasesFile struct {
+	Aliases map[string]string `json:"aliases"`
+}
+
+func NewDeviceAliases(path string) *DeviceAliases {
+	return &DeviceAliases{
+		path:    path,
+		aliases: map[string]string{},
+	}
+}
+
+// Read the aliases from disk. A missing alias file means either a fresh
+// install, or an upgrade from a version that numbered devices. In the latter
+// case kubelet's checkpoint has numbered IDs assigned to containers, and
+// every device found until finishDiscovery keeps its old ID.
+func (aliases *DeviceAliases) Load(kubeletCheckpointPath string) error {
+	aliases.mutex.Lock()
+	defer aliases.mutex.Unlock()
+	if aliases.path == "" {
+		return nil
+	}
+	dat, err := ioutil.ReadFile(aliases.path)
+	if os.IsNotExist(err) {
+		aliases.missing = true
+		if usesLegacyIDs(kubeletCheckpointPath) {
+			aliases.upgrading = true
+			log.WithFields(log.Fields{
+				"Path": aliases.path,
+			}).Info("Upgrading from numbered device IDs, devices keep their old IDs.")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var file aliasesFile
+	err = json.Unmarshal(dat, &file)
+	if err != nil {
+		return fmt.Errorf("cannot parse aliases '%s': %v", aliases.path, err)
+	}
+	for id, alias := range file.Aliases {
+		if !validDeviceID(id) || !validLegacyDeviceID(alias) {
+			return fmt.Errorf("invalid alias '%s' of device '%s' in '%s'", alias, id, aliases.path)
+		}
+	}
+	if file.Aliases != nil {
+		aliases.aliases = file.Aliases
+	}
+	return nil
+}
+
+// Whether kubelet has devices assigned to containers under the IDs earlier
+// versions gave out. A missing or unreadable checkpoint means it doesn't.
+func usesLegacyIDs(kubeletCheckpointPath string) bool {
+	allocated, err := readKubeletCheckpoint(kubeletCheckpointPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithFields(log.Fields{
+				"Path":  kubeletCheckpointPath,
+				"Error": err,
+			}).Warn("Cannot read kubelet checkpoint, devices get new IDs.")
+		}
+		return false
+	}
+	for _, ids := range allocated {
+		for id := range ids {
+			if validLegacyDeviceID(id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The ID to advertise a device as, given the ID derived from its hardware
+// and the one earlier versions would have given it
+func (aliases *DeviceAliases) resolve(id string, legacyID string) string {
+	if aliases == nil {
+		return id
+	}
+	aliases.mutex.Lock()
+	defer aliases.mutex.Unlock()
+	if alias, ok := aliases.aliases[id]; ok {
+		return alias
+	}
+	if aliases.upgrading {
+		aliases.aliases[id] = legacyID
+		return legacyID
+	}
+	return id
+}
+
+// Called once the devices present at startup are found. Devices found from
+// now on are new, and get the IDs derived from their hardware.
+func (aliases *DeviceAliases) finishDiscovery() error {
+	aliases.mutex.Lock()
+	defer aliases.mutex.Unlock()
+	upgrading := aliases.upgrading
+	aliases.upgrading = false
+	if !aliases.missing {
+		return nil
+	}
+	dat, err := json.Marshal(aliasesFile{Aliases: aliases.aliases})
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(aliases.path, dat)
+	if err != nil {
+		return err
+	}
+	aliases.missing = false
+	if upgrading {
+		log.WithFields(log.Fields{
+			"Path":    aliases.path,
+			"Devices": len(aliases.aliases),
+		}).Info("Recorded old device IDs.")
+	}
+	return nil
+}
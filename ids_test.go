@@ -0,0 +1,150 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestDeviceIDGrammar(t *testing.T) {
+	tests := []struct {
+		id     string
+		valid  bool
+		legacy bool
+	}{
+		{"xilinx.com/alveo-u250-pci-0000-65-00.0", true, false},
+		{"xilinx.com/alveo-u250-pci-0000-65-00.0-tenant-3", true, false},
+		{"fidus.com/sidewinder-100-sn-SW100_0042", true, false},
+		{"fidus.com/sidewinder-100-mpsoc", true, false},
+		{"fidus.com/sidewinder-100-mpsoc-size1-1", true, false},
+		{"example.com/sim-board-sim-0", true, false},
+		// Vendors and boards may use any case, like resource names
+		{"Example.com/Sim_Board-sim-1", true, false},
+		{"Fidus.com/Sidewinder-100-0", false, true},
+		{"fidus.com/sidewinder-100-0", false, true},
+		{"fidus.com/sidewinder-100-0-1", false, true},
+		{"xilinx.com/alveo-u250-pci-0000-65-00.8", false, false},
+		{"xilinx.com/alveo-u250-pci-0000-AB-00.0", false, false},
+		{"fidus.com/sidewinder-100-sn-SW.100", false, false},
+		{"fidus.com/sidewinder-100-mpsoc-size1", false, false},
+		{"sidewinder-100-0", false, false},
+		{"GPU-3f2b1c4d", false, false},
+	}
+	for _, test := range tests {
+		if validDeviceID(test.id) != test.valid {
+			t.Errorf("%s is valid: %v, want %v", test.id, validDeviceID(test.id), test.valid)
+		}
+		if validLegacyDeviceID(test.id) != test.legacy {
+			t.Errorf("%s is legacy: %v, want %v", test.id, validLegacyDeviceID(test.id), test.legacy)
+		}
+	}
+}
+
+// Devices keep the numbered IDs kubelet still has assigned to containers when
+// upgrading, and nothing changes on fresh installs
+func TestDeviceAliasesUpgrade(t *testing.T) {
+	legacy := map[string]string{
+		"example.com/sim-board-sim-0":          "example.com/sim-board-0",
+		"example.com/sim-board-sim-0-tenant-0": "example.com/sim-board-0-0",
+		"example.com/sim-board-sim-0-tenant-1": "example.com/sim-board-0-1",
+		"example.com/sim-board-sim-1":          "example.com/sim-board-1",
+		"example.com/sim-board-sim-1-tenant-0": "example.com/sim-board-1-2",
+		"example.com/sim-board-sim-1-tenant-1": "example.com/sim-board-1-3",
+	}
+	tests := []struct {
+		name       string
+		checkpoint string
+		aliases    map[string]string
+	}{
+		{"upgrade", `{"Data": {"PodDeviceEntries": [
+			{"PodUID": "pod", "ContainerName": "tenant", "ResourceName": "example.com/sim-board-tenant", "DeviceIDs": ["example.com/sim-board-1-3"]}
+		]}}`, legacy},
+		{"upgrade with other plugins", `{"Data": {"PodDeviceEntries": [
+			{"PodUID": "pod", "ContainerName": "gpu", "ResourceName": "nvidia.com/gpu", "DeviceIDs": ["GPU-3f2b1c4d"]},
+			{"PodUID": "pod", "ContainerName": "fpga", "ResourceName": "example.com/sim-board", "DeviceIDs": ["example.com/sim-board-0"]}
+		]}}`, legacy},
+		{"nothing allocated", `{"Data": {"PodDeviceEntries": []}}`, map[string]string{}},
+		{"stable IDs", `{"Data": {"PodDeviceEntries": [
+			{"PodUID": "pod", "ContainerName": "fpga", "ResourceName": "example.com/sim-board", "DeviceIDs": ["example.com/sim-board-sim-0"]}
+		]}}`, map[string]string{}},
+		{"no kubelet checkpoint", "", map[string]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := newFakeTree(t)
+			if test.checkpoint != "" {
+				tree.write("kubelet_internal_checkpoint", test.checkpoint)
+			}
+			config := simConfig(2, TenantConfig{Name: "tenant", Count: 2})
+			backend, err := newSimBackend(&BackendOptions{Config: config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			aliases := NewDeviceAliases(tree.path("aliases.json"))
+			if err := aliases.Load(tree.path("kubelet_internal_checkpoint")); err != nil {
+				t.Fatal(err)
+			}
+			plugins, _ := getAllDevices([]Backend{backend}, config, aliases)
+			if err := aliases.finishDiscovery(); err != nil {
+				t.Fatal(err)
+			}
+			ids := map[string]string{}
+			for _, device := range plugins[0].devices {
+				ids[device.stableID] = device.ID
+				for _, child := range device.children {
+					ids[join_strings(device.stableID, "-tenant-", strconv.Itoa(child.region))] = child.ID
+				}
+			}
+			for stableID, id := range ids {
+				want, ok := test.aliases[stableID]
+				if !ok {
+					want = stableID
+				}
+				if id != want {
+					t.Errorf("%s is advertised as %s, want %s", stableID, id, want)
+				}
+			}
+			// The aliases are kept once recorded, whatever kubelet has now
+			reloaded := NewDeviceAliases(tree.path("aliases.json"))
+			if err := reloaded.Load(tree.path("missing")); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reloaded.aliases, test.aliases) {
+				t.Errorf("recorded aliases %v, want %v", reloaded.aliases, test.aliases)
+			}
+			if id := reloaded.resolve("example.com/sim-board-sim-2", "example.com/sim-board-2"); id != "example.com/sim-board-sim-2" {
+				t.Errorf("new device found after upgrading is advertised as %s", id)
+			}
+		})
+	}
+}
+
+func TestDeviceAliasesInvalid(t *testing.T) {
+	for _, content := range []string{
+		`{"aliases": {"example.com/sim-board-sim-0": "example.com/sim-board-sim-1"}}`,
+		`{"aliases": {"example.com/sim-board-0": "example.com/sim-board-1"}}`,
+		`{"aliases": `,
+	} {
+		tree := newFakeTree(t)
+		tree.write("aliases.json", content)
+		if err := NewDeviceAliases(tree.path("aliases.json")).Load(tree.path("missing")); err == nil {
+			t.Errorf("loaded aliases %s", content)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	podresourcesapi "github.com/mewais/FPGA-K8s-DevicePlugin/podresources/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Which kubelet we are talking to. The patched kubelet supports the
+// Deallocate and PostStopContainer calls, the upstream one doesn't, so we
+// have to find out about released devices ourselves through the PodResources
+// API.
+const (
+	KUBELET_AUTO     string = "auto"
+	KUBELET_PATCHED  string = "patched"
+	KUBELET_UPSTREAM string = "upstream"
+)
+
+// Where kubelet serves the PodResources API
+const PodResourcesSocket = "/var/lib/kubelet/pod-resources/kubelet.sock"
+
+// How long to wait for kubelet, tests shorten it
+var podResourcesTimeout = 10 * time.Second
+
+// kubelet gives up on PreStartContainer after 30 seconds
+// (KubeletPreStartContainerRPCTimeoutInSecs). We stop a bit earlier, so that
+// kubelet gets our error instead of a timeout.
+const (
+	preStartTimeout = 30 * time.Second
+	preStartMargin  = time.Second
+)
+
+// When PreStartContainer must be done
+func preStartDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(preStartTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	return deadline.Add(-preStartMargin)
+}
+
+// Guess which kubelet we are running with. The patched kubelet is based on
+// 1.18, which doesn't serve the v1 PodResources API that upstream kubelets
+// serve since 1.20. If we can't tell, we assume the patched kubelet, as that
+// is what this plugin always required.
+func detectKubeletMode(socket string) string {
+	conn, err := dial(socket, podResourcesTimeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Socket": socket,
+			"Error":  err,
+		}).Warn("Cannot reach the PodResources API, assuming patched kubelet")
+		return KUBELET_PATCHED
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), podResourcesTimeout)
+	defer cancel()
+	// The v1 List request is empty, just like the v1alpha1 one
+	err = conn.Invoke(ctx, "/v1.PodResourcesLister/List", &podresourcesapi.ListPodResourcesRequest{}, &podresourcesapi.ListPodResourcesResponse{})
+	if err == nil {
+		return KUBELET_UPSTREAM
+	}
+	if status.Code(err) != codes.Unimplemented {
+		log.WithFields(log.Fields{
+			"Socket": socket,
+			"Error":  err,
+		}).Warn("Cannot tell which kubelet serves the PodResources API, assuming patched kubelet")
+	}
+	return KUBELET_PATCHED
+}
+
+// Get the set of device IDs of every resource that kubelet has assigned to
+// containers, from the PodResources API.
+func readPodResources(socket string) (map[string]map[string]bool, error) {
+	conn, err := dial(socket, podResourcesTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the PodResources API at '%s': %v", socket, err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), podResourcesTimeout)
+	defer cancel()
+	client := podresourcesapi.NewPodResourcesListerClient(conn)
+	resp, err := client.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list pod resources at '%s': %v", socket, err)
+	}
+	allocated := map[string]map[string]bool{}
+	for _, pod := range resp.PodResources {
+		for _, container := range pod.Containers {
+			for _, devices := range container.Devices {
+				if allocated[devices.ResourceName] == nil {
+					allocated[devices.ResourceName] = map[string]bool{}
+				}
+				for _, id := range devices.DeviceIds {
+					allocated[devices.ResourceName][id] = true
+				}
+			}
+		}
+	}
+	return allocated, nil
+}
+
+// Find the container kubelet assigned the given devices of a resource to
+func findContainer(ctx context.Context, socket string, resource string, ids []string) (string, string, string, error) {
+	conn, err := dial(socket, podResourcesTimeout)
+	if err != nil {
+		return "", "", "", fmt.Errorf("cannot reach the PodResources API at '%s': %v", socket, err)
+	}
+	defer conn.Close()
+	client := podresourcesapi.NewPodResourcesListerClient(conn)
+	resp, err := client.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("cannot list pod resources at '%s': %v", socket, err)
+	}
+	for _, pod := range resp.PodResources {
+		for _, container := range pod.Containers {
+			assigned := make(map[string]bool)
+			for _, devices := range container.Devices {
+				if devices.ResourceName != resource {
+					continue
+				}
+				for _, id := range devices.DeviceIds {
+					assigned[id] = true
+				}
+			}
+			found := len(ids) > 0
+			for _, id := range ids {
+				found = found && assigned[id]
+			}
+			if found {
+				return pod.Namespace, pod.Name, container.Name, nil
+			}
+		}
+	}
+	return "", "", "", fmt.Errorf("no container has %v of resource '%s'", ids, resource)
+}
+
+// Same as reconcileWithKubelet, but asks the PodResources API. This is how
+// released devices are found with the upstream kubelet.
+func reconcileWithPodResources(socket string, plugins []*FPGADevicePlugin) {
+	allocated, err := readPodResources(socket)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Socket": socket,
+			"Error":  err,
+		}).Warn("Cannot read pod resources, skipping reconciliation")
+		return
+	}
+	log.Debug("Reconciling devices with pod resources")
+	for _, plugin := range plugins {
+		plugin.reconcile(allocated)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	podresourcesapi "github.com/mewais/FPGA-K8s-DevicePlugin/podresources/v1alpha1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Serves the PodResources API like kubelet, with the devices given to it
+type fakePodResources struct {
+	mutex   sync.Mutex
+	devices map[string][]string
+	// What List fails with, and how long it takes to answer
+	err   error
+	delay time.Duration
+}
+
+func (fake *fakePodResources) setDevices(devices map[string][]string) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.devices = devices
+}
+
+// Make List slow or fail
+func (fake *fakePodResources) setFailure(err error, delay time.Duration) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.err = err
+	fake.delay = delay
+}
+
+// Every resource goes into a container of its own pod
+func (fake *fakePodResources) List(ctx context.Context, req *podresourcesapi.ListPodResourcesRequest) (*podresourcesapi.ListPodResourcesResponse, error) {
+	fake.mutex.Lock()
+	delay := fake.delay
+	fake.mutex.Unlock()
+	time.Sleep(delay)
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if fake.err != nil {
+		return nil, fake.err
+	}
+	resp := &podresourcesapi.ListPodResourcesResponse{}
+	for resource, ids := range fake.devices {
+		resp.PodResources = append(resp.PodResources, &podresourcesapi.PodResources{
+			Name:      "pod-" + resource,
+			Namespace: "default",
+			Containers: []*podresourcesapi.ContainerResources{{
+				Name: "container",
+				Devices: []*podresourcesapi.ContainerDevices{{
+					ResourceName: resource,
+					DeviceIds:    ids,
+				}},
+			}},
+		})
+	}
+	return resp, nil
+}
+
+// The v1 API of kubelets since 1.20 has the same List call
+var podResourcesV1ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "v1.PodResourcesLister",
+	HandlerType: (*podresourcesapi.PodResourcesListerServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "List",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := &podresourcesapi.ListPodResourcesRequest{}
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			return srv.(podresourcesapi.PodResourcesListerServer).List(ctx, req)
+		},
+	}},
+}
+
+// Serve the PodResources API on a socket until the test ends, the v1 API
+// only if upstream is set. Missing sockets are given up on quickly.
+func startFakePodResources(t *testing.T, upstream bool) (*fakePodResources, string) {
+	timeout := podResourcesTimeout
+	podResourcesTimeout = 100 * time.Millisecond
+	t.Cleanup(func() {
+		podResourcesTimeout = timeout
+	})
+	socket := newFakeTree(t).path("kubelet.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakePodResources{}
+	server := grpc.NewServer()
+	podresourcesapi.RegisterPodResourcesListerServer(server, fake)
+	if upstream {
+		server.RegisterService(&podResourcesV1ServiceDesc, fake)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return fake, socket
+}
+
+func TestDetectKubeletMode(t *testing.T) {
+	_, patched := startFakePodResources(t, false)
+	_, upstream := startFakePodResources(t, true)
+	// Only a kubelet that answers the v1 API is upstream, one we can't
+	// tell apart is assumed to be patched
+	slow, slowSocket := startFakePodResources(t, true)
+	slow.setFailure(nil, 2*podResourcesTimeout)
+	failing, failingSocket := startFakePodResources(t, true)
+	failing.setFailure(status.Error(codes.Unavailable, "kubelet is shutting down"), 0)
+	tests := []struct {
+		socket string
+		mode   string
+	}{
+		{patched, KUBELET_PATCHED},
+		{upstream, KUBELET_UPSTREAM},
+		{slowSocket, KUBELET_PATCHED},
+		{failingSocket, KUBELET_PATCHED},
+		{newFakeTree(t).path("missing.sock"), KUBELET_PATCHED},
+	}
+	for _, test := range tests {
+		if mode := detectKubeletMode(test.socket); mode != test.mode {
+			t.Errorf("detected %s kubelet, want %s", mode, test.mode)
+		}
+	}
+}
+
+func TestReadPodResources(t *testing.T) {
+	fake, socket := startFakePodResources(t, true)
+	fake.setDevices(map[string][]string{
+		"example.com/sim-board":        {"example.com/sim-board-sim-0"},
+		"example.com/sim-board-tenant": {"example.com/sim-board-sim-1-tenant-0", "example.com/sim-board-sim-1-tenant-1"},
+	})
+	allocated, err := readPodResources(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]bool{
+		"example.com/sim-board": {
+			"example.com/sim-board-sim-0": true,
+		},
+		"example.com/sim-board-tenant": {
+			"example.com/sim-board-sim-1-tenant-0": true,
+			"example.com/sim-board-sim-1-tenant-1": true,
+		},
+	}
+	if !reflect.DeepEqual(allocated, want) {
+		t.Errorf("read %v, want %v", allocated, want)
+	}
+	if _, err := readPodResources(newFakeTree(t).path("missing.sock")); err == nil {
+		t.Error("read pod resources from a missing socket")
+	}
+}
+
+// Upstream kubelets never deallocate, devices they stop listing are released
+func TestPodResourcesRelease(t *testing.T) {
+	fake, socket := startFakePodResources(t, true)
+	plugin := newSimPlugins(t, simConfig(2))[0]
+	for _, device := range plugin.devices {
+		if err := device.setState(USED); err != nil {
+			t.Fatal(err)
+		}
+		device.allocated = time.Now().Add(-2 * reconcileGracePeriod)
+	}
+	kept := plugin.devices[0]
+	released := plugin.devices[1]
+	fake.setDevices(map[string][]string{
+		plugin.fullName(): {kept.ID},
+	})
+	reconcileWithPodResources(socket, []*FPGADevicePlugin{plugin})
+	if kept.status != USED {
+		t.Errorf("%s is %s while kubelet lists it, want USED", kept.ID, kept.status)
+	}
+	if released.status != FREE {
+		t.Errorf("%s is %s once kubelet stopped listing it, want FREE", released.ID, released.status)
+	}
+	// Nothing is released if kubelet can't be asked
+	reconcileWithPodResources(newFakeTree(t).path("missing.sock"), []*FPGADevicePlugin{plugin})
+	if kept.status != USED {
+		t.Errorf("%s is %s without kubelet, want USED", kept.ID, kept.status)
+	}
+}
+
+// Upstream kubelets may allocate devices again before reconciliation freed
+// them, those no container holds anymore are wiped and handed out
+func TestUpstreamAllocateReleases(t *testing.T) {
+	fake, socket := startFakePodResources(t, true)
+	config := simConfig(2)
+	config.Boards[0].BlankBitstream = "blank.bin"
+	plugin := newSimPlugins(t, config)[0]
+	plugin.kubeletMode = KUBELET_UPSTREAM
+	plugin.podResources = socket
+	held := plugin.devices[0]
+	stale := plugin.devices[1]
+	for _, device := range plugin.devices {
+		if err := device.backend.Program(device, WHOLE_FPGA, "running.bin", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := device.setState(USED); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.setDevices(map[string][]string{
+		plugin.fullName(): {held.ID},
+	})
+	checkStatus(t, allocate(plugin.server, held.ID), codes.FailedPrecondition, "device is busy: "+held.ID)
+	if err := allocate(plugin.server, stale.ID); err != nil {
+		t.Fatalf("cannot allocate %s no container holds: %v", stale.ID, err)
+	}
+	if stale.status != RESERVED {
+		t.Errorf("%s is %s, want RESERVED", stale.ID, stale.status)
+	}
+	reporter := plugin.devices[0].backend.(BitstreamReporter)
+	if loaded := reporter.LoadedBitstream(stale, WHOLE_FPGA); loaded != "blank.bin" {
+		t.Errorf("%s has %q loaded, want it wiped", stale.ID, loaded)
+	}
+	if loaded := reporter.LoadedBitstream(held, WHOLE_FPGA); loaded != "running.bin" {
+		t.Errorf("%s has %q loaded, want it left alone", held.ID, loaded)
+	}
+	// Nothing is freed if kubelet can't be asked
+	fake.setDevices(nil)
+	plugin.podResources = newFakeTree(t).path("missing.sock")
+	checkStatus(t, allocate(plugin.server, held.ID), codes.FailedPrecondition, "device is busy: "+held.ID)
+	if held.status != USED {
+		t.Errorf("%s is %s without kubelet, want USED", held.ID, held.status)
+	}
+}
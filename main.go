@@ -19,7 +19,10 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
@@ -27,9 +30,30 @@ import (
 )
 
 func main() {
+	// The admin client shares our binary
+	if len(os.Args) > 1 && os.Args[1] == "fpgactl" {
+		os.Exit(runFpgactl(os.Args[2:]))
+	}
+
 	// Parse arguments
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	logLevel := flag.String("log-level", "info", "Define the logging level: error, info, debug.")
+	sysfsRoot := flag.String("sysfs-root", "/sys", "Path where the host sysfs is mounted, used for PCIe FPGA discovery.")
+	devRoot := flag.String("dev-root", "/dev", "Path where the host device nodes are, used to program DFL FPGAs.")
+	backendList := flag.String("backends", "mpsoc,pcie", "Comma separated list of the backends to find FPGAs with, in order of preference. Known backends: "+strings.Join(backendNames(), ", ")+".")
+	configPath := flag.String("config", "", "Path of the YAML/JSON file describing the tenants of each board. Without it, only entire FPGAs are advertised.")
+	firmwareDir := flag.String("firmware-dir", "/lib/firmware", "Path where the kernel firmware loader looks for bitstreams.")
+	bitstreamDir := flag.String("bitstream-dir", "", "Path where accelerator bitstreams are looked up, the firmware directory if empty. Bitstreams outside of it are copied into it before programming.")
+	bitstreamAnnotations := flag.Bool("bitstream-annotations", false, "Let pods choose the bitstream of their containers with the "+ANNOTATION_BITSTREAM+" annotation, instead of the configured one. Needs the PodResources API and permission to get pods.")
+	checkpointPath := flag.String("checkpoint", "/var/lib/fpga-device-plugin/checkpoint.json", "Path of the file where device allocations are persisted across restarts.")
+	aliasesPath := flag.String("aliases", "/var/lib/fpga-device-plugin/aliases.json", "Path of the file where device IDs given out by earlier versions are kept. Disabled if empty.")
+	kubeletMode := flag.String("kubelet-mode", KUBELET_AUTO, "Which kubelet to work with: patched (supports Deallocate), upstream, or auto to detect it.")
+	allocationPolicy := flag.String("allocation-policy", ALLOCATION_PACKED, "How to pick devices when kubelet asks for a preferred allocation: packed (keep tenants on as few FPGAs as possible) or none.")
+	reconcileInterval := flag.Duration("reconcile-interval", time.Minute, "How often to reconcile device allocations with the kubelet checkpoint. Disabled if 0.")
+	healthInterval := flag.Duration("health-interval", 30*time.Second, "How often to run the health checks of every FPGA. Disabled if 0.")
+	adminSocket := flag.String("admin-socket", AdminSocket, "Path of the unix socket to serve the admin API on, used by the fpgactl subcommand. Disabled if empty.")
+	statusAddress := flag.String("status-address", "", "Address to serve the plugin status on, e.g. :8080. Disabled if empty.")
+	metricsAddress := flag.String("metrics-address", "", "Address to serve Prometheus metrics on, e.g. :9100. Disabled if empty.")
 	help := flag.Bool("help", false, "Print this help message.")
 	flag.Parse()
 
@@ -50,6 +74,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Load the board configuration
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+			"Path":  *configPath,
+		}).Error("Failed to load config.")
+		os.Exit(1)
+	}
+
 	// Start the filesystem watcher. This gets notified everytime
 	// a path is modified. TODO: Explain what this does
 	log.Info("Starting FS watcher.")
@@ -63,13 +97,172 @@ func main() {
 	}
 	defer fsWatcher.Close()
 
+	// Start the config watcher. We watch the directory rather than the file,
+	// since editors and ConfigMap updates replace the file instead of
+	// writing to it.
+	configEvents := make(chan fsnotify.Event)
+	configErrors := make(chan error)
+	if *configPath != "" {
+		log.Info("Starting config watcher.")
+		configWatcher, err := newFSWatcher(filepath.Dir(*configPath))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Error": err,
+				"Path":  *configPath,
+			}).Error("Failed to create config watcher.")
+			os.Exit(1)
+		}
+		defer configWatcher.Close()
+		configEvents = configWatcher.Events
+		configErrors = configWatcher.Errors
+	}
+
+	// Start the status server
+	statusServer := NewStatusServer(*statusAddress)
+	if *statusAddress != "" {
+		err = statusServer.Start()
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+
+	// Start the metrics server
+	if *metricsAddress != "" {
+		err = StartMetricsServer(*metricsAddress)
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+
 	// Start the OS watcher, this is basically a signal handler
 	log.Info("Starting OS watcher.")
 	sigsWatcher := newOSWatcher(syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
 	// Get all the devices
 	log.Info("Getting Devices.")
-	plugins, _ := getAllDevices()
+	manager := NewFPGAManager(*sysfsRoot, *firmwareDir, *bitstreamDir)
+	err = manager.CheckStaging()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+		}).Error("Bitstream directory is unusable, the firmware directory must be writable.")
+		os.Exit(1)
+	}
+	backends, err := newBackends(*backendList, &BackendOptions{
+		SysfsRoot: *sysfsRoot,
+		DevRoot:   *devRoot,
+		Manager:   manager,
+		Config:    config,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+		}).Error("Failed to create backends.")
+		os.Exit(1)
+	}
+	// Devices known to earlier versions keep their IDs
+	aliases := NewDeviceAliases(*aliasesPath)
+	err = aliases.Load(KubeletCheckpoint)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+			"Path":  *aliasesPath,
+		}).Error("Failed to load device aliases.")
+		os.Exit(1)
+	}
+	plugins, _ := getAllDevices(backends, config, aliases)
+	err = aliases.finishDiscovery()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+			"Path":  *aliasesPath,
+		}).Error("Failed to save device aliases.")
+	}
+
+	// Restore the allocations we had before restarting
+	log.Info("Restoring checkpoint.")
+	checkpoint := NewCheckpoint(*checkpointPath)
+	err = checkpoint.Load()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+			"Path":  *checkpointPath,
+		}).Error("Failed to load checkpoint, assuming all devices are free.")
+	}
+	checkpoint.Restore(plugins)
+
+	// Find out which kubelet we are working with
+	switch *kubeletMode {
+	case KUBELET_AUTO:
+		*kubeletMode = detectKubeletMode(PodResourcesSocket)
+	case KUBELET_PATCHED, KUBELET_UPSTREAM:
+	default:
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	log.WithFields(log.Fields{
+		"Mode": *kubeletMode,
+	}).Info("Using kubelet mode.")
+	if !validAllocationPolicy(*allocationPolicy) {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	var chooser *BitstreamChooser
+	if *bitstreamAnnotations {
+		pods, err := NewInClusterPodClient()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Cannot read pod annotations.")
+			os.Exit(1)
+		}
+		chooser = NewBitstreamChooser(PodResourcesSocket, pods)
+	}
+	for _, plugin := range plugins {
+		plugin.kubeletMode = *kubeletMode
+		plugin.allocationPolicy = *allocationPolicy
+		plugin.chooser = chooser
+	}
+	// The upstream kubelet never deallocates, so we have to ask it what's
+	// still in use instead
+	reconcile := func() {
+		reconcileWithKubelet(KubeletCheckpoint, plugins)
+	}
+	if *kubeletMode == KUBELET_UPSTREAM {
+		reconcile = func() {
+			reconcileWithPodResources(PodResourcesSocket, plugins)
+		}
+		if *reconcileInterval <= 0 {
+			log.Error("Upstream kubelet mode requires a positive reconcile interval.")
+			os.Exit(1)
+		}
+	}
+
+	// Keep an eye on the health of the FPGAs
+	var healthMonitor *HealthMonitor
+	if *healthInterval > 0 {
+		healthMonitor = NewHealthMonitor(plugins, *healthInterval)
+		healthMonitor.Start()
+		defer healthMonitor.Stop()
+	}
+
+	// Start the admin server
+	adminServer := NewAdminServer(*adminSocket, plugins)
+	if *adminSocket != "" {
+		err = adminServer.Start()
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+
+	// Make sure we agree with kubelet on what's in use, and keep agreeing
+	var reconcileTicks <-chan time.Time
+	if *reconcileInterval > 0 {
+		reconcile()
+		reconcileTicker := time.NewTicker(*reconcileInterval)
+		defer reconcileTicker.Stop()
+		reconcileTicks = reconcileTicker.C
+	}
 
 Lifetime:
 	// Start all
@@ -111,12 +304,59 @@ Lifetime:
 				log.WithFields(log.Fields{
 					"Error": err,
 				}).Info("FS Watcher Error")
+			// Check for config changes
+			case <-configEvents:
+				var status *ReloadStatus
+				config, status = reloadConfig(*configPath, config, plugins)
+				if status != nil {
+					statusServer.setReloadStatus(status)
+				}
+			// Check for allocations kubelet and us disagree on
+			case <-reconcileTicks:
+				reconcile()
+			// Look for new FPGAs when asked to through the admin API
+			case request := <-adminServer.rediscoverRequests:
+				var found int
+				oldCount := len(plugins)
+				plugins, found = rediscoverDevices(backends, config, aliases, plugins)
+				for _, plugin := range plugins[oldCount:] {
+					plugin.mutex.Lock()
+					plugin.checkpoint = checkpoint
+					plugin.kubeletMode = *kubeletMode
+					plugin.allocationPolicy = *allocationPolicy
+					plugin.chooser = chooser
+					plugin.mutex.Unlock()
+					err := plugin.Start()
+					if err != nil {
+						log.WithFields(log.Fields{
+							"Error": err,
+						}).Debug("Plugin Starting failed, skipping")
+					}
+				}
+				adminServer.setPlugins(plugins)
+				if healthMonitor != nil {
+					healthMonitor.setPlugins(plugins)
+				}
+				log.WithFields(log.Fields{
+					"Found": found,
+				}).Info("Rediscovered devices.")
+				request.found <- found
+			case err := <-configErrors:
+				log.WithFields(log.Fields{
+					"Error": err,
+				}).Info("Config Watcher Error")
 			// Check for signal interrupts
 			case signal := <-sigsWatcher:
 				switch signal {
 				case syscall.SIGHUP:
-					log.Info("Received SIGHUP, restarting.")
-					break PostInit
+					log.Info("Received SIGHUP, reloading config.")
+					if *configPath != "" {
+						var status *ReloadStatus
+						config, status = reloadConfig(*configPath, config, plugins)
+						if status != nil {
+							statusServer.setReloadStatus(status)
+						}
+					}
 				default:
 					log.WithFields(log.Fields{
 						"Signal": signal,
@@ -0,0 +1,114 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// All metrics are labelled by the resource (full name) they belong to, e.g.
+// fidus.com/sidewinder-100 or fidus.com/sidewinder-100-tenant.
+var (
+	deviceStatusGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fpga_devices",
+		Help: "Number of devices by status.",
+	}, []string{"resource", "status"})
+	requestsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fpga_plugin_requests_total",
+		Help: "Number of device plugin calls from kubelet.",
+	}, []string{"resource", "method"})
+	requestsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fpga_plugin_request_duration_seconds",
+		Help:    "Duration of device plugin calls from kubelet.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"resource", "method"})
+	resetsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fpga_resets_total",
+		Help: "Number of device resets by result, success or failure.",
+	}, []string{"resource", "result"})
+	resetsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fpga_reset_duration_seconds",
+		Help:    "Duration of device resets.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"resource"})
+	listAndWatchCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fpga_list_and_watch_updates_total",
+		Help: "Number of device lists sent to kubelet.",
+	}, []string{"resource"})
+	healthFailuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fpga_health_check_failures_total",
+		Help: "Number of failed health checks by probe.",
+	}, []string{"resource", "probe"})
+)
+
+// Record a call from kubelet, meant to be deferred at the start of the call:
+//
+//	defer observeRequest(plugin.fullName(), "Allocate", time.Now())
+func observeRequest(resource string, method string, start time.Time) {
+	requestsCounter.WithLabelValues(resource, method).Inc()
+	requestsDuration.WithLabelValues(resource, method).Observe(time.Since(start).Seconds())
+}
+
+func observeReset(resource string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	resetsCounter.WithLabelValues(resource, result).Inc()
+	resetsDuration.WithLabelValues(resource).Observe(time.Since(start).Seconds())
+}
+
+func observeHealthFailure(resource string, probe string) {
+	healthFailuresCounter.WithLabelValues(resource, probe).Inc()
+}
+
+// Move a device from one status to another in the status gauge
+func observeStatus(resource string, oldStatus DeviceState, newStatus DeviceState) {
+	deviceStatusGauge.WithLabelValues(resource, oldStatus.String()).Dec()
+	deviceStatusGauge.WithLabelValues(resource, newStatus.String()).Inc()
+}
+
+func StartMetricsServer(address string) error {
+	sock, err := net.Listen("tcp", address)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Address": address,
+			"Error":   err,
+		}).Error("Cannot listen on metrics address.")
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		err := http.Serve(sock, mux)
+		log.WithFields(log.Fields{
+			"Address": address,
+			"Error":   err,
+		}).Error("Metrics server stopped")
+	}()
+	log.WithFields(log.Fields{
+		"Address": address,
+	}).Info("Started metrics server.")
+	return nil
+}
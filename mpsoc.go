@@ -0,0 +1,114 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Where the host device tree is mounted in our container
+const mpsocDeviceTreeRoot = "/work/device-tree"
+
+func init() {
+	registerBackend("mpsoc", newMPSoCBackend)
+}
+
+// Finds the FPGA of MPSoCs through the device tree. MPSoCs are expected to
+// have device tree overlays similar to those in `utils/`, which give the
+// vendor and board of the FPGA. They are programmed through their only
+// fpga_manager.
+type mpsocBackend struct {
+	fpgaManagerBackend
+	// Where the host sysfs is mounted, usually `/sys`
+	sysfsRoot string
+	// Where the host device tree is mounted, usually `/work/device-tree`
+	deviceTreeRoot string
+	manager        *FPGAManager
+}
+
+func newMPSoCBackend(options *BackendOptions) (Backend, error) {
+	return &mpsocBackend{
+		sysfsRoot:      options.SysfsRoot,
+		deviceTreeRoot: mpsocDeviceTreeRoot,
+		manager:        options.Manager,
+	}, nil
+}
+
+func (backend *mpsocBackend) Name() string {
+	return "mpsoc"
+}
+
+// Read a string property of the device tree, without its terminating NUL
+func (backend *mpsocBackend) readProperty(name string) (string, error) {
+	dat, err := ioutil.ReadFile(path.Join(backend.deviceTreeRoot, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(dat), "\x00\n"), nil
+}
+
+func (backend *mpsocBackend) Discover() []*DiscoveredFPGA {
+	// We expect SoC FPGAs info to be at `/proc/device-tree/fpga-full/`
+	// according to the sample device trees in `utils`.
+	fpgaPath := path.Join(backend.deviceTreeRoot, "fpga-full")
+	if _, err := os.Stat(fpgaPath); err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+		}).Info("No MPSoC FPGA found.")
+		return nil
+	}
+	// FPGA exists, try getting the vendor and board info
+	vendorName, err := backend.readProperty("vendor")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+		}).Warn("Could not read FPGA Info. Did you install the device tree overlay?")
+		return nil
+	}
+	boardName, err := backend.readProperty("board")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+		}).Warn("Could not read FPGA Info. Did you install the device tree overlay?")
+		return nil
+	}
+	// Note that in MPSoCs, there's typically one FPGA
+	device := &FPGADevice{
+		manager:        backend.manager,
+		managerName:    backend.manager.firstManager(),
+		deviceTreePath: fpgaPath,
+	}
+	device.findMPSoCFiles(backend.sysfsRoot)
+	return []*DiscoveredFPGA{{
+		vendorName: vendorName,
+		boardName:  boardName,
+		identity:   mpsocIdentity(path.Join(backend.deviceTreeRoot, "serial-number")),
+		device:     device,
+	}}
+}
+
+func (backend *mpsocBackend) Health() []HealthProbe {
+	return []HealthProbe{
+		&presenceProbe{sysfsRoot: backend.sysfsRoot},
+		&managerStateProbe{},
+	}
+}
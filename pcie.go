@@ -0,0 +1,161 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A PCIe board we know how to identify. The IDs are matched against the
+// sysfs attributes of every PCI function, a zero subsystem ID matches any
+// subsystem. Cards that expose more than one function (e.g. Alveo user and
+// management functions) must only list one of them here, otherwise the same
+// card will be advertised twice.
+type pcieBoard struct {
+	vendorID          uint64
+	deviceID          uint64
+	subsystemVendorID uint64
+	subsystemDeviceID uint64
+	vendorName        string
+	boardName         string
+}
+
+// Alveo cards are matched on their management function (function 0). The
+// U200 keeps the `alveo` name it was always advertised as.
+var knownPCIeBoards = []pcieBoard{
+	{0x10ee, 0x5000, 0, 0, "xilinx.com", "alveo"},
+	{0x10ee, 0x5004, 0, 0, "xilinx.com", "alveo-u250"},
+	{0x10ee, 0x500c, 0, 0, "xilinx.com", "alveo-u280"},
+	{0x10ee, 0x5020, 0, 0, "xilinx.com", "alveo-u50"},
+}
+
+// Read a sysfs attribute of the form `0x10ee` into an integer
+func readPCIeID(devicePath string, attribute string) (uint64, error) {
+	dat, err := ioutil.ReadFile(path.Join(devicePath, attribute))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(dat)), 0, 16)
+}
+
+// Find which of the given boards a PCI function belongs to, nil if none
+func matchPCIeBoard(devicePath string, boards []pcieBoard) *pcieBoard {
+	vendorID, err := readPCIeID(devicePath, "vendor")
+	if err != nil {
+		return nil
+	}
+	deviceID, err := readPCIeID(devicePath, "device")
+	if err != nil {
+		return nil
+	}
+	// Not all devices have subsystem IDs, treat missing ones as zero
+	subsystemVendorID, _ := readPCIeID(devicePath, "subsystem_vendor")
+	subsystemDeviceID, _ := readPCIeID(devicePath, "subsystem_device")
+	for index, board := range boards {
+		if board.vendorID != vendorID || board.deviceID != deviceID {
+			continue
+		}
+		if board.subsystemVendorID != 0 && board.subsystemVendorID != subsystemVendorID {
+			continue
+		}
+		if board.subsystemDeviceID != 0 && board.subsystemDeviceID != subsystemDeviceID {
+			continue
+		}
+		return &boards[index]
+	}
+	return nil
+}
+
+func init() {
+	registerBackend("pcie", newPCIeBackend)
+}
+
+// Finds PCIe FPGAs through sysfs, and gives containers the device nodes of
+// their drivers
+type pcieBackend struct {
+	fpgaManagerBackend
+	// Where the host sysfs is mounted, usually `/sys`
+	sysfsRoot string
+	// Programs and wipes the cards through their fpga_manager
+	manager *FPGAManager
+}
+
+func newPCIeBackend(options *BackendOptions) (Backend, error) {
+	return &pcieBackend{
+		sysfsRoot: options.SysfsRoot,
+		manager:   options.Manager,
+	}, nil
+}
+
+func (backend *pcieBackend) Name() string {
+	return "pcie"
+}
+
+// Search the PCI bus for known FPGA boards, one FPGA for every card
+func (backend *pcieBackend) Discover() []*DiscoveredFPGA {
+	var found []*DiscoveredFPGA
+	busPath := path.Join(backend.sysfsRoot, "bus/pci/devices")
+	entries, err := ioutil.ReadDir(busPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+			"Path":  busPath,
+		}).Info("No PCIe bus found.")
+		return found
+	}
+	// Entries are sorted by their PCI address, so cards are always
+	// discovered in the same order
+	for _, entry := range entries {
+		board := matchPCIeBoard(path.Join(busPath, entry.Name()), knownPCIeBoards)
+		if board == nil {
+			continue
+		}
+		// Cards driven by XRT are left to the xrt backend, whichever backend
+		// comes first
+		if driver := pciDriver(path.Join(busPath, entry.Name())); driver == XRT_MGMT_DRIVER || driver == XRT_USER_DRIVER {
+			log.WithFields(log.Fields{
+				"Address": entry.Name(),
+				"Driver":  driver,
+			}).Debug("Skipping PCIe FPGA driven by XRT.")
+			continue
+		}
+		device := &FPGADevice{
+			pciAddress: entry.Name(),
+			manager:    backend.manager,
+		}
+		device.findPCIeFiles(backend.sysfsRoot)
+		found = append(found, &DiscoveredFPGA{
+			vendorName: board.vendorName,
+			boardName:  board.boardName,
+			identity:   pciIdentity(entry.Name()),
+			device:     device,
+		})
+	}
+	return found
+}
+
+func (backend *pcieBackend) Health() []HealthProbe {
+	return []HealthProbe{
+		&presenceProbe{sysfsRoot: backend.sysfsRoot},
+		&managerStateProbe{},
+	}
+}
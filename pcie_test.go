@@ -0,0 +1,127 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path"
+	"testing"
+)
+
+func TestPCIeDiscovery(t *testing.T) {
+	sysfs := newFakeTree(t)
+	// An Alveo U200 with its user function, an Alveo U250, and a NIC
+	mgmt := sysfs.addPCIFunction("0000:65:00.0", "0x10ee", "0x5000")
+	user := sysfs.addPCIFunction("0000:65:00.1", "0x10ee", "0x5001")
+	sysfs.addPCIFunction("0000:b3:00.0", "0x10ee", "0x5004")
+	sysfs.addPCIFunction("0000:3d:00.0", "0x8086", "0x37d2")
+	sysfs.mkdir(path.Join(user, "xdma/xdma0_user"))
+	sysfs.mkdir(path.Join(mgmt, "hwmon/hwmon2"))
+	sysfs.link("class/hwmon/hwmon2", path.Join(mgmt, "hwmon/hwmon2"))
+
+	backend, err := newPCIeBackend(&BackendOptions{SysfsRoot: sysfs.root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := backend.Discover()
+	if len(found) != 2 {
+		t.Fatalf("found %d FPGAs, want 2", len(found))
+	}
+	tests := []struct {
+		board       string
+		identity    string
+		deviceNodes []string
+		hwmon       []string
+	}{
+		{"alveo", "pci-0000-65-00.0", []string{"/dev/xdma0_user"}, []string{sysfs.path(path.Join(mgmt, "hwmon/hwmon2"))}},
+		{"alveo-u250", "pci-0000-b3-00.0", nil, nil},
+	}
+	for index, test := range tests {
+		fpga := found[index]
+		if fpga.vendorName != "xilinx.com" || fpga.boardName != test.board {
+			t.Errorf("FPGA %d is %s/%s, want xilinx.com/%s", index, fpga.vendorName, fpga.boardName, test.board)
+		}
+		if fpga.identity != test.identity {
+			t.Errorf("FPGA %d has identity %s, want %s", index, fpga.identity, test.identity)
+		}
+		if !equalStrings(fpga.device.deviceNodes, test.deviceNodes) {
+			t.Errorf("FPGA %d has device nodes %v, want %v", index, fpga.device.deviceNodes, test.deviceNodes)
+		}
+		if !equalStrings(fpga.device.hwmon, test.hwmon) {
+			t.Errorf("FPGA %d has sensors %v, want %v", index, fpga.device.hwmon, test.hwmon)
+		}
+	}
+}
+
+func TestMatchPCIeBoardSubsystem(t *testing.T) {
+	sysfs := newFakeTree(t)
+	function := sysfs.addPCIFunction("0000:01:00.0", "0x10ee", "0x5000")
+	sysfs.write(path.Join(function, "subsystem_vendor"), "0x10ee\n")
+	sysfs.write(path.Join(function, "subsystem_device"), "0x000e\n")
+	boards := []pcieBoard{
+		{0x10ee, 0x5000, 0x10ee, 0x1234, "xilinx.com", "other"},
+		{0x10ee, 0x5000, 0x10ee, 0x000e, "xilinx.com", "match"},
+	}
+	board := matchPCIeBoard(sysfs.path(function), boards)
+	if board == nil || board.boardName != "match" {
+		t.Errorf("matched %v, want the board with the same subsystem", board)
+	}
+	if matchPCIeBoard(sysfs.path("devices/missing"), boards) != nil {
+		t.Error("matched a missing function")
+	}
+}
+
+// Released cards are wiped through the fpga_manager under their PCI function
+func TestPCIeReleaseWipes(t *testing.T) {
+	sysfs := newFakeTree(t)
+	firmware := newFakeTree(t)
+	mgmt := sysfs.addPCIFunction("0000:65:00.0", "0x10ee", "0x5000")
+	manager := path.Join(mgmt, "fpga_manager/fpga0")
+	sysfs.write(path.Join(manager, "state"), "operating\n")
+	sysfs.write(path.Join(manager, "flags"), "")
+	sysfs.write(path.Join(manager, "firmware"), "")
+	sysfs.link("class/fpga_manager/fpga0", manager)
+	firmware.write("blank.bin", "bitstream")
+
+	backend, err := newPCIeBackend(&BackendOptions{
+		SysfsRoot: sysfs.root,
+		Manager:   NewFPGAManager(sysfs.root, firmware.root, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Boards: []BoardConfig{{Vendor: "xilinx.com", Board: "alveo", BlankBitstream: "blank.bin"}}}
+	plugins, _ := getAllDevices([]Backend{backend}, config, nil)
+	if len(plugins) != 1 || len(plugins[0].devices) != 1 {
+		t.Fatalf("found %d plugins, want one with one FPGA", len(plugins))
+	}
+	device := plugins[0].devices[0]
+	if device.managerName != "fpga0" {
+		t.Fatalf("FPGA has fpga_manager %q, want fpga0", device.managerName)
+	}
+	if err := device.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deallocate(plugins[0].server, device.ID); err != nil {
+		t.Fatal(err)
+	}
+	if written := sysfs.read(path.Join(manager, "firmware")); written != "blank.bin" {
+		t.Errorf("released FPGA had %q written to its fpga_manager, want blank.bin", written)
+	}
+	if device.status != FREE {
+		t.Errorf("released FPGA is %s, want FREE", device.status)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// Pod annotation choosing the accelerator bitstream programmed into the FPGAs
+// and PR regions of its containers, instead of the configured one.
+// `fpga-device-plugin/bitstream.<container>` chooses it for one container
+// only. Tenant bitstreams may have a region placeholder.
+const ANNOTATION_BITSTREAM string = "fpga-device-plugin/bitstream"
+
+// Where Kubernetes puts the credentials of the service account of a pod
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Reads pods from the Kubernetes API server, as the service account of the
+// plugin pod
+type PodClient struct {
+	// The API server, e.g. https://10.96.0.1:443
+	server string
+	// Read on every request, as service account tokens are rotated
+	tokenPath string
+	client    *http.Client
+}
+
+// A client of the API server of the cluster the plugin runs in
+func NewInClusterPodClient() (*PodClient, error) {
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes pod")
+	}
+	ca, err := ioutil.ReadFile(path.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the cluster CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in the cluster CA")
+	}
+	return &PodClient{
+		server:    "https://" + net.JoinHostPort(host, port),
+		tokenPath: path.Join(serviceAccountDir, "token"),
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+// The annotations of a pod
+func (client *PodClient) annotations(ctx context.Context, namespace string, name string) (map[string]string, error) {
+	token, err := ioutil.ReadFile(client.tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the service account token: %v", err)
+	}
+	podURL := fmt.Sprintf("%s/api/v1/namespaces/%s/pods/%s", client.server, url.PathEscape(namespace), url.PathEscape(name))
+	req, err := http.NewRequest(http.MethodGet, podURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get pod '%s/%s': %v", namespace, name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot get pod '%s/%s': %s", namespace, name, resp.Status)
+	}
+	var pod struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&pod)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode pod '%s/%s': %v", namespace, name, err)
+	}
+	return pod.Metadata.Annotations, nil
+}
+
+// Finds the bitstream the pod of a container chose for it. kubelet doesn't
+// tell device plugins which pod they serve, so the container is looked up in
+// the PodResources API by its devices, and its pod on the API server.
+type BitstreamChooser struct {
+	// The PodResources API socket
+	socket string
+	pods   *PodClient
+}
+
+func NewBitstreamChooser(socket string, pods *PodClient) *BitstreamChooser {
+	return &BitstreamChooser{
+		socket: socket,
+		pods:   pods,
+	}
+}
+
+// The bitstream chosen for the container the given devices of a resource are
+// assigned to, empty if its pod didn't choose any
+func (chooser *BitstreamChooser) choose(ctx context.Context, resource string, ids []string) (string, error) {
+	namespace, pod, container, err := findContainer(ctx, chooser.socket, resource, ids)
+	if err != nil {
+		return "", err
+	}
+	annotations, err := chooser.pods.annotations(ctx, namespace, pod)
+	if err != nil {
+		return "", err
+	}
+	bitstream, ok := annotations[ANNOTATION_BITSTREAM+"."+container]
+	if !ok {
+		bitstream = annotations[ANNOTATION_BITSTREAM]
+	}
+	if bitstream != "" && !validBitstreamName(bitstream) {
+		return "", fmt.Errorf("pod '%s/%s' chose invalid bitstream '%s'", namespace, pod, bitstream)
+	}
+	if bitstream != "" {
+		log.WithFields(log.Fields{
+			"Pod":       namespace + "/" + pod,
+			"Container": container,
+			"Bitstream": bitstream,
+		}).Debug("Pod chose bitstream")
+	}
+	return bitstream, nil
+}
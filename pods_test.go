@@ -0,0 +1,200 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+	"golang.org/x/net/context"
+)
+
+// Serve the annotations of the given pods, by namespace/name, like the API
+// server does to the service account with the given token
+func startFakeAPIServer(t *testing.T, token string, pods map[string]map[string]string) *PodClient {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/")
+		name = strings.Replace(name, "/pods/", "/", 1)
+		annotations, ok := pods[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		pod := map[string]interface{}{
+			"kind": "Pod",
+			"metadata": map[string]interface{}{
+				"annotations": annotations,
+			},
+		}
+		json.NewEncoder(w).Encode(pod)
+	}))
+	t.Cleanup(server.Close)
+	tree := newFakeTree(t)
+	tree.write("token", token+"\n")
+	return &PodClient{
+		server:    server.URL,
+		tokenPath: tree.path("token"),
+		client:    server.Client(),
+	}
+}
+
+func TestPodClientAnnotations(t *testing.T) {
+	annotations := map[string]string{ANNOTATION_BITSTREAM: "accelerator.bin"}
+	client := startFakeAPIServer(t, "secret", map[string]map[string]string{
+		"default/pod": annotations,
+	})
+	read, err := client.annotations(context.Background(), "default", "pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, annotations) {
+		t.Errorf("read annotations %v, want %v", read, annotations)
+	}
+	if _, err := client.annotations(context.Background(), "default", "missing"); err == nil {
+		t.Error("read the annotations of a missing pod")
+	}
+	unauthorized := *client
+	unauthorized.tokenPath = newFakeTree(t).path("token")
+	if _, err := unauthorized.annotations(context.Background(), "default", "pod"); err == nil {
+		t.Error("read annotations without a token")
+	}
+}
+
+func TestBitstreamChooser(t *testing.T) {
+	fake, socket := startFakePodResources(t, false)
+	fake.setDevices(map[string][]string{
+		"example.com/pod-wide":      {"fpga-0", "fpga-1"},
+		"example.com/per-container": {"fpga-2"},
+		"example.com/none":          {"fpga-3"},
+		"example.com/invalid":       {"fpga-4"},
+	})
+	pods := startFakeAPIServer(t, "secret", map[string]map[string]string{
+		"default/pod-example.com/pod-wide": {
+			ANNOTATION_BITSTREAM: "accelerator.bin",
+		},
+		"default/pod-example.com/per-container": {
+			ANNOTATION_BITSTREAM:                "accelerator.bin",
+			ANNOTATION_BITSTREAM + ".container": "container.bin",
+			ANNOTATION_BITSTREAM + ".other":     "other.bin",
+		},
+		"default/pod-example.com/none": {},
+		"default/pod-example.com/invalid": {
+			ANNOTATION_BITSTREAM: "../../etc/shadow",
+		},
+	})
+	chooser := NewBitstreamChooser(socket, pods)
+	tests := []struct {
+		resource  string
+		ids       []string
+		bitstream string
+		fails     bool
+	}{
+		{"example.com/pod-wide", []string{"fpga-1", "fpga-0"}, "accelerator.bin", false},
+		{"example.com/per-container", []string{"fpga-2"}, "container.bin", false},
+		{"example.com/none", []string{"fpga-3"}, "", false},
+		{"example.com/invalid", []string{"fpga-4"}, "", true},
+		{"example.com/pod-wide", []string{"fpga-0", "fpga-2"}, "", true},
+		{"example.com/missing", []string{"fpga-0"}, "", true},
+	}
+	for _, test := range tests {
+		bitstream, err := chooser.choose(context.Background(), test.resource, test.ids)
+		if (err != nil) != test.fails {
+			t.Errorf("choosing for %v of %s returned error %v", test.ids, test.resource, err)
+		}
+		if bitstream != test.bitstream {
+			t.Errorf("chose %q for %v of %s, want %q", bitstream, test.ids, test.resource, test.bitstream)
+		}
+	}
+}
+
+// The bitstream a pod chose is programmed instead of the configured one
+func TestPreStartChosenBitstream(t *testing.T) {
+	config := simConfig(2, TenantConfig{Name: "tenant", Count: 2, Bitstream: "tenant-{region}.bin"})
+	config.Boards[0].Bitstream = "configured.bin"
+	plugin := newSimPlugins(t, config)[0]
+	tenants := plugin.childPlugins[0]
+	fpga := plugin.devices[0]
+	tenant := plugin.devices[1].children[1]
+	fake, socket := startFakePodResources(t, false)
+	fake.setDevices(map[string][]string{
+		plugin.fullName():  {fpga.ID},
+		tenants.fullName(): {tenant.ID},
+	})
+	plugin.chooser = NewBitstreamChooser(socket, startFakeAPIServer(t, "secret", map[string]map[string]string{
+		"default/pod-" + plugin.fullName(): {
+			ANNOTATION_BITSTREAM: "chosen.bin",
+		},
+		"default/pod-" + tenants.fullName(): {
+			ANNOTATION_BITSTREAM: "chosen-{region}.bin",
+		},
+	}))
+	tests := []struct {
+		server    *ResourceServer
+		device    managedDevice
+		parent    *FPGADevice
+		region    Region
+		bitstream string
+	}{
+		{plugin.server, fpga, fpga, WHOLE_FPGA, "chosen.bin"},
+		{tenants.server, tenant, tenant.parent, tenant.backendRegion(), "chosen-1.bin"},
+	}
+	for _, test := range tests {
+		_, err := test.server.Allocate(context.Background(), &pluginapi.AllocateRequest{
+			ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{test.device.deviceID()}}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = test.server.PreStartContainer(context.Background(), &pluginapi.PreStartContainerRequest{
+			DevicesIDs: []string{test.device.deviceID()},
+		})
+		if err != nil {
+			t.Fatalf("PreStartContainer of %s failed: %v", test.device.deviceID(), err)
+		}
+		loaded := test.parent.backend.(BitstreamReporter).LoadedBitstream(test.parent, test.region)
+		if loaded != test.bitstream {
+			t.Errorf("%s has %q loaded, want %q", test.device.deviceID(), loaded, test.bitstream)
+		}
+		if test.device.state() != USED {
+			t.Errorf("%s is %s, want USED", test.device.deviceID(), test.device.state())
+		}
+	}
+	// Containers don't start if their pod can't be found
+	fake.setDevices(nil)
+	other := plugin.devices[1].children[0]
+	tenants.server.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{other.ID}}},
+	})
+	_, err := tenants.server.PreStartContainer(context.Background(), &pluginapi.PreStartContainerRequest{
+		DevicesIDs: []string{other.ID},
+	})
+	if err == nil {
+		t.Error("started a container whose pod wasn't found")
+	}
+	if other.status != RESERVED {
+		t.Errorf("%s is %s after failing to start, want RESERVED", other.ID, other.status)
+	}
+}
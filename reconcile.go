@@ -0,0 +1,240 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+	log "github.com/sirupsen/logrus"
+)
+
+// Where kubelet records which devices are assigned to which containers
+const KubeletCheckpoint = pluginapi.DevicePluginPath + "kubelet_internal_checkpoint"
+
+// Kubelet writes its checkpoint after Allocate returns, so devices that were
+// allocated very recently may not be in it yet.
+const reconcileGracePeriod = time.Minute
+
+// The parts of the kubelet checkpoint we care about. Older kubelets store the
+// device IDs as a list, newer ones as a map from NUMA node to list.
+type kubeletCheckpoint struct {
+	Data struct {
+		PodDeviceEntries []struct {
+			PodUID        string          `json:"PodUID"`
+			ContainerName string          `json:"ContainerName"`
+			ResourceName  string          `json:"ResourceName"`
+			DeviceIDs     json.RawMessage `json:"DeviceIDs"`
+		} `json:"PodDeviceEntries"`
+	} `json:"Data"`
+}
+
+func parseKubeletDeviceIDs(raw json.RawMessage) ([]string, error) {
+	var ids []string
+	if err := json.Unmarshal(raw, &ids); err == nil {
+		return ids, nil
+	}
+	var numaIDs map[string][]string
+	if err := json.Unmarshal(raw, &numaIDs); err != nil {
+		return nil, err
+	}
+	for _, nodeIDs := range numaIDs {
+		ids = append(ids, nodeIDs...)
+	}
+	return ids, nil
+}
+
+// Parse the kubelet checkpoint into the set of allocated device IDs of every
+// resource.
+func readKubeletCheckpoint(checkpointPath string) (map[string]map[string]bool, error) {
+	dat, err := ioutil.ReadFile(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint kubeletCheckpoint
+	err = json.Unmarshal(dat, &checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse kubelet checkpoint '%s': %v", checkpointPath, err)
+	}
+	allocated := map[string]map[string]bool{}
+	for _, entry := range checkpoint.Data.PodDeviceEntries {
+		ids, err := parseKubeletDeviceIDs(entry.DeviceIDs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse device IDs of pod '%s' container '%s' in kubelet checkpoint '%s': %v", entry.PodUID, entry.ContainerName, checkpointPath, err)
+		}
+		if allocated[entry.ResourceName] == nil {
+			allocated[entry.ResourceName] = map[string]bool{}
+		}
+		for _, id := range ids {
+			allocated[entry.ResourceName][id] = true
+		}
+	}
+	return allocated, nil
+}
+
+// A device that was released and is waiting to be wiped
+type pendingRelease struct {
+	device managedDevice
+	// Where it goes once it is wiped
+	state DeviceState
+}
+
+// Move a device that was released to RESETTING, it is wiped by the caller
+// once the lock is released, see finishReset
+func startRelease(device managedDevice) (*pendingRelease, error) {
+	state := releasedState(device.state())
+	err := device.setState(RESETTING)
+	if err != nil {
+		return nil, err
+	}
+	return &pendingRelease{device: device, state: state}, nil
+}
+
+// Wipe and free a device kubelet no longer knows about. Devices that fail to
+// be wiped are marked unhealthy instead, only illegal transitions are errors.
+func releaseDevice(device managedDevice) error {
+	release, err := startRelease(device)
+	if err != nil {
+		return err
+	}
+	return finishReset(device, release.state, device.Reset())
+}
+
+// Make the status of our devices and their tenants agree with kubelet:
+// devices kubelet assigned to containers are USED, and devices in use that
+// kubelet doesn't reference anymore are wiped and freed. Devices that are
+// being programmed are left alone until that is done.
+func (plugin *FPGADevicePlugin) reconcile(allocated map[string]map[string]bool) {
+	plugin.mutex.Lock()
+	changed := false
+	var releases []*pendingRelease
+	// Entire FPGAs first, so that tenants are checked against their
+	// parents' final status
+	kubeletDevices := allocated[plugin.fullName()]
+	for _, device := range plugin.devices {
+		if kubeletDevices[device.ID] && device.status == FREE {
+			log.WithFields(log.Fields{
+				"ID": device.ID,
+			}).Warn("Kubelet has FPGA device allocated, marking it used")
+			err := device.SetUsed()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"ID":    device.ID,
+					"Error": err,
+				}).Error("Cannot reconcile FPGA device")
+				continue
+			}
+			changed = true
+		} else if kubeletDevices[device.ID] && !device.status.inUse() {
+			log.WithFields(log.Fields{
+				"ID":     device.ID,
+				"Status": device.status,
+			}).Warn("Kubelet has FPGA device allocated, but it can't be used")
+		} else if !kubeletDevices[device.ID] && device.status.inUse() && device.status != PROGRAMMING && time.Since(device.allocated) > reconcileGracePeriod {
+			log.WithFields(log.Fields{
+				"ID": device.ID,
+			}).Warn("Kubelet no longer has FPGA device allocated, freeing it")
+			release, err := startRelease(device)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"ID":    device.ID,
+					"Error": err,
+				}).Error("Cannot reconcile FPGA device")
+				continue
+			}
+			releases = append(releases, release)
+			changed = true
+		}
+	}
+	for _, childPlugin := range plugin.childPlugins {
+		kubeletDevices := allocated[childPlugin.fullName()]
+		for _, device := range childPlugin.devices {
+			if kubeletDevices[device.ID] && device.status == FREE && !device.parent.status.inUse() {
+				log.WithFields(log.Fields{
+					"ID": device.ID,
+				}).Warn("Kubelet has FPGA tenant device allocated, marking it used")
+				err := device.SetUsed()
+				if err != nil {
+					log.WithFields(log.Fields{
+						"ID":    device.ID,
+						"Error": err,
+					}).Error("Cannot reconcile FPGA tenant device")
+					continue
+				}
+				changed = true
+			} else if kubeletDevices[device.ID] && !device.status.inUse() {
+				log.WithFields(log.Fields{
+					"ID":     device.ID,
+					"Status": device.status,
+				}).Warn("Kubelet has FPGA tenant device allocated, but it can't be used")
+			} else if !kubeletDevices[device.ID] && device.status.inUse() && device.status != PROGRAMMING && time.Since(device.allocated) > reconcileGracePeriod {
+				log.WithFields(log.Fields{
+					"ID": device.ID,
+				}).Warn("Kubelet no longer has FPGA tenant device allocated, freeing it")
+				release, err := startRelease(device)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"ID":    device.ID,
+						"Error": err,
+					}).Error("Cannot reconcile FPGA tenant device")
+					continue
+				}
+				releases = append(releases, release)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		plugin.saveCheckpoint()
+	}
+	plugin.mutex.Unlock()
+	if len(releases) == 0 {
+		return
+	}
+	// Wiping takes a while, so don't hold the lock for it. The released
+	// devices are RESETTING and can't be handed out meanwhile.
+	wipeErrs := make([]error, len(releases))
+	for index, release := range releases {
+		wipeErrs[index] = release.device.Reset()
+	}
+	plugin.mutex.Lock()
+	defer plugin.mutex.Unlock()
+	for index, release := range releases {
+		finishReset(release.device, release.state, wipeErrs[index])
+	}
+	plugin.saveCheckpoint()
+}
+
+// Reconcile all plugins against the kubelet checkpoint. Nothing is touched if
+// the checkpoint can't be read, since that would free everything.
+func reconcileWithKubelet(checkpointPath string, plugins []*FPGADevicePlugin) {
+	allocated, err := readKubeletCheckpoint(checkpointPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Path":  checkpointPath,
+			"Error": err,
+		}).Warn("Cannot read kubelet checkpoint, skipping reconciliation")
+		return
+	}
+	log.Debug("Reconciling devices with kubelet checkpoint")
+	for _, plugin := range plugins {
+		plugin.reconcile(allocated)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadKubeletCheckpoint(t *testing.T) {
+	tests := []struct {
+		file      string
+		allocated map[string]map[string]bool
+	}{
+		{"testdata/kubelet_internal_checkpoint_list.json", map[string]map[string]bool{
+			"fidus.com/sidewinder-100": {
+				"fidus.com/sidewinder-100-0": true,
+			},
+			"fidus.com/sidewinder-100-tenant": {
+				"fidus.com/sidewinder-100-1-2": true,
+				"fidus.com/sidewinder-100-1-3": true,
+			},
+			"nvidia.com/gpu": {
+				"GPU-3f2b1c4d": true,
+			},
+		}},
+		{"testdata/kubelet_internal_checkpoint_numa.json", map[string]map[string]bool{
+			"xilinx.com/alveo": {
+				"xilinx.com/alveo-pci-0000-65-00.0": true,
+				"xilinx.com/alveo-pci-0000-b3-00.0": true,
+			},
+			"xilinx.com/alveo-tenant": {
+				"xilinx.com/alveo-pci-0000-17-00.0-tenant-4": true,
+			},
+		}},
+		{"testdata/kubelet_internal_checkpoint_empty.json", map[string]map[string]bool{}},
+	}
+	for _, test := range tests {
+		allocated, err := readKubeletCheckpoint(test.file)
+		if err != nil {
+			t.Errorf("cannot read %s: %v", test.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(allocated, test.allocated) {
+			t.Errorf("%s has %v allocated, want %v", test.file, allocated, test.allocated)
+		}
+	}
+}
+
+func TestReadKubeletCheckpointErrors(t *testing.T) {
+	for _, file := range []string{
+		"testdata/kubelet_internal_checkpoint_bad_ids.json",
+		"testdata/missing.json",
+		"testdata/kubelet_internal_checkpoint_list.json/not-a-file",
+	} {
+		if allocated, err := readKubeletCheckpoint(file); err == nil {
+			t.Errorf("read %v from %s, want an error", allocated, file)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(4, TenantConfig{Name: "tenant", Count: 2}))[0]
+	tenants := plugin.childPlugins[0]
+	kubeletOnly := plugin.devices[0]
+	released := plugin.devices[1]
+	recent := plugin.devices[2]
+	kubeletTenant := plugin.devices[3].children[1]
+	for _, device := range []*FPGADevice{released, recent} {
+		if err := device.setState(USED); err != nil {
+			t.Fatal(err)
+		}
+	}
+	released.allocated = time.Now().Add(-2 * reconcileGracePeriod)
+	plugin.reconcile(map[string]map[string]bool{
+		plugin.fullName():  {kubeletOnly.ID: true},
+		tenants.fullName(): {kubeletTenant.ID: true},
+	})
+	tests := []struct {
+		device managedDevice
+		state  DeviceState
+	}{
+		{kubeletOnly, USED},
+		{kubeletOnly.children[0], BLOCKED},
+		{released, FREE},
+		{released.children[0], FREE},
+		{recent, USED},
+		{kubeletTenant, USED},
+		{kubeletTenant.parent, BLOCKED},
+		{kubeletTenant.parent.children[0], FREE},
+	}
+	for _, test := range tests {
+		if test.device.state() != test.state {
+			t.Errorf("%s is %s, want %s", test.device.deviceID(), test.device.state(), test.state)
+		}
+	}
+}
+
+// Wiping released devices takes a while, other handlers must not wait on it
+func TestReconcileWipesWithoutLock(t *testing.T) {
+	config := simConfig(1)
+	config.Simulated[0].ResetLatency = 300 * time.Millisecond
+	plugin := newSimPlugins(t, config)[0]
+	device := plugin.devices[0]
+	if err := device.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	device.allocated = time.Now().Add(-2 * reconcileGracePeriod)
+	done := make(chan struct{})
+	go func() {
+		plugin.reconcile(map[string]map[string]bool{})
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	plugin.mutex.RLock()
+	state := device.status
+	plugin.mutex.RUnlock()
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("waited %v for the lock while the device was wiped", waited)
+	}
+	if state != RESETTING {
+		t.Errorf("device is %s while it is wiped, want RESETTING", state)
+	}
+	<-done
+	if device.status != FREE {
+		t.Errorf("device is %s once wiped, want FREE", device.status)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Outcome of reloading the tenant layout of one board
+const (
+	RELOAD_UNCHANGED string = "unchanged"
+	RELOAD_UPDATED   string = "updated"
+	RELOAD_REFUSED   string = "refused"
+)
+
+type ReloadStatus struct {
+	Time    time.Time           `json:"time"`
+	Path    string              `json:"path"`
+	Success bool                `json:"success"`
+	Error   string              `json:"error,omitempty"`
+	Boards  []BoardReloadStatus `json:"boards,omitempty"`
+}
+
+type BoardReloadStatus struct {
+	Resource string `json:"resource"`
+	Result   string `json:"result"`
+	Message  string `json:"message,omitempty"`
+}
+
+func hasTenantClass(tenants []TenantConfig, childPlugin *FPGATenantDevicePlugin) bool {
+	for _, tenant := range tenants {
+		if tenant.Name == childPlugin.tenantName && tenant.Count == childPlugin.tenantCount && tenant.BlankBitstream == childPlugin.blankBitstream && tenant.Bitstream == childPlugin.bitstream && reflect.DeepEqual(tenant.Region, childPlugin.region) {
+			return true
+		}
+	}
+	return false
+}
+
+// Drop the tenants of the given tenant plugin from an FPGA device
+func (device *FPGADevice) removeChildren(childPlugin *FPGATenantDevicePlugin) {
+	var children []*FPGATenantDevice
+	for _, child := range device.children {
+		removed := false
+		for _, childDevice := range childPlugin.devices {
+			if child == childDevice {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			children = append(children, child)
+		}
+	}
+	device.children = children
+}
+
+// Apply a new tenant layout to this board. Tenant classes that are unchanged
+// keep their plugin and devices, only classes that were added, removed or
+// resized are registered again. The layout is not changed at all if any FPGA
+// of this board is in use, since that would take tenants away from running
+// containers.
+func (plugin *FPGADevicePlugin) reloadTenants(config *Config) BoardReloadStatus {
+	status, removedPlugins, addedPlugins := plugin.swapTenants(config)
+	// Talking to kubelet takes a while, or forever if it hangs, so it is done
+	// without the lock. The removed plugins have no devices left, and the
+	// added ones are only reached through kubelet once they are started.
+	for _, childPlugin := range removedPlugins {
+		childPlugin.Stop()
+	}
+	// Only start them if the parent is running, otherwise the parent will
+	// start them whenever it starts
+	if plugin.server.running() {
+		for _, childPlugin := range addedPlugins {
+			childPlugin.Start()
+		}
+	}
+	return status
+}
+
+// Swap the tenant layout of this board for the one in the config, returning
+// the tenant plugins to stop and those to start
+func (plugin *FPGADevicePlugin) swapTenants(config *Config) (BoardReloadStatus, []*FPGATenantDevicePlugin, []*FPGATenantDevicePlugin) {
+	plugin.mutex.Lock()
+	defer plugin.mutex.Unlock()
+	status := BoardReloadStatus{
+		Resource: plugin.fullName(),
+	}
+	var tenants []TenantConfig
+	blankBitstream := ""
+	bitstream := ""
+	shell := AccessConfig{}
+	health := HealthConfig{}
+	boardConfig := config.board(plugin.vendorName, plugin.boardName)
+	// Nor is anything asked of FPGAs that they can't do, e.g. being split
+	// into tenants they don't have room for
+	for _, device := range plugin.devices {
+		if err := checkBoard(device, boardConfig); err != nil {
+			status.Result = RELOAD_REFUSED
+			status.Message = fmt.Sprintf("device %s doesn't fit: %v", device.ID, err)
+			log.WithFields(log.Fields{
+				"Resource": plugin.fullName(),
+				"ID":       device.ID,
+				"Error":    err,
+			}).Warn("Refusing board config that doesn't match the FPGA")
+			return status, nil, nil
+		}
+	}
+	if boardConfig != nil {
+		tenants = boardConfig.Tenants
+		blankBitstream = boardConfig.BlankBitstream
+		bitstream = boardConfig.Bitstream
+		shell = boardConfig.Shell
+		health = boardConfig.Health
+	}
+	// The health thresholds don't change the layout, the health monitor uses
+	// them from its next check on
+	if !reflect.DeepEqual(health, plugin.health) {
+		plugin.health = health
+		log.WithFields(log.Fields{
+			"Resource": plugin.fullName(),
+			"Health":   health,
+		}).Info("Updated health thresholds")
+	}
+	// The accelerator doesn't change the layout, it is only programmed for new containers
+	if bitstream != plugin.bitstream {
+		plugin.bitstream = bitstream
+		log.WithFields(log.Fields{
+			"Resource":  plugin.fullName(),
+			"Bitstream": bitstream,
+		}).Info("Updated accelerator bitstream")
+	}
+	// The shell doesn't change the layout, it is only handed out to new tenants
+	if !reflect.DeepEqual(shell, plugin.shell) {
+		plugin.shell = shell
+		log.WithFields(log.Fields{
+			"Resource": plugin.fullName(),
+			"Devices":  shell.Devices,
+			"Mounts":   shell.Mounts,
+		}).Info("Updated shell control interface")
+	}
+	// The blank bitstream doesn't change the layout, it can always be updated
+	if blankBitstream != plugin.blankBitstream {
+		plugin.blankBitstream = blankBitstream
+		for _, device := range plugin.devices {
+			device.blankBitstream = blankBitstream
+		}
+		log.WithFields(log.Fields{
+			"Resource":  plugin.fullName(),
+			"Bitstream": blankBitstream,
+		}).Info("Updated blank bitstream")
+	}
+	// Find out what changed
+	var keptPlugins []*FPGATenantDevicePlugin
+	var removedPlugins []*FPGATenantDevicePlugin
+	var addedTenants []TenantConfig
+	for _, childPlugin := range plugin.childPlugins {
+		if hasTenantClass(tenants, childPlugin) {
+			keptPlugins = append(keptPlugins, childPlugin)
+		} else {
+			removedPlugins = append(removedPlugins, childPlugin)
+		}
+	}
+	for _, tenant := range tenants {
+		found := false
+		for _, childPlugin := range keptPlugins {
+			if childPlugin.tenantName == tenant.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addedTenants = append(addedTenants, tenant)
+		}
+	}
+	if len(removedPlugins) == 0 && len(addedTenants) == 0 {
+		status.Result = RELOAD_UNCHANGED
+		return status, nil, nil
+	}
+	// Make sure we are not pulling the rug from under anyone
+	for _, device := range plugin.devices {
+		if device.status != FREE && device.status != UNHEALTHY {
+			status.Result = RELOAD_REFUSED
+			status.Message = fmt.Sprintf("device %s is in use", device.ID)
+			log.WithFields(log.Fields{
+				"Resource": plugin.fullName(),
+				"ID":       device.ID,
+			}).Warn("Refusing to change tenant layout while FPGA is in use")
+			return status, nil, nil
+		}
+	}
+	// Unregister the tenant classes that changed or no longer exist
+	for _, childPlugin := range removedPlugins {
+		log.WithFields(log.Fields{
+			"Resource": childPlugin.fullName(),
+		}).Info("Removing tenant resource")
+		for _, device := range plugin.devices {
+			device.removeChildren(childPlugin)
+		}
+		for _, device := range childPlugin.devices {
+			deviceStatusGauge.WithLabelValues(device.resource, device.status.String()).Dec()
+		}
+	}
+	plugin.childPlugins = keptPlugins
+	// And register the new ones
+	var addedPlugins []*FPGATenantDevicePlugin
+	for _, tenant := range addedTenants {
+		childPlugin := newFPGATenantDevicePlugin(plugin, tenant)
+		log.WithFields(log.Fields{
+			"Resource": childPlugin.fullName(),
+			"Count":    tenant.Count,
+		}).Info("Adding tenant resource")
+		for _, device := range plugin.devices {
+			addTenantDevices(childPlugin, device)
+		}
+		addedPlugins = append(addedPlugins, childPlugin)
+	}
+	status.Result = RELOAD_UPDATED
+	return status, removedPlugins, addedPlugins
+}
+
+// Read the config file again and apply it to all plugins. Returns the config
+// that should be used from now on, which is the old one if the new one is
+// invalid, and nil status if nothing changed in the file.
+func reloadConfig(configPath string, oldConfig *Config, plugins []*FPGADevicePlugin) (*Config, *ReloadStatus) {
+	newConfig, err := loadConfig(configPath)
+	status := &ReloadStatus{
+		Time: time.Now(),
+		Path: configPath,
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+			"Path":  configPath,
+		}).Error("Failed to reload config, keeping the old one.")
+		status.Error = err.Error()
+		return oldConfig, status
+	}
+	if reflect.DeepEqual(newConfig, oldConfig) {
+		return oldConfig, nil
+	}
+	log.WithFields(log.Fields{
+		"Path": configPath,
+	}).Info("Config changed, reloading.")
+	status.Success = true
+	for _, plugin := range plugins {
+		boardStatus := plugin.reloadTenants(newConfig)
+		log.WithFields(log.Fields{
+			"Resource": boardStatus.Resource,
+			"Result":   boardStatus.Result,
+			"Message":  boardStatus.Message,
+		}).Info("Reloaded board config")
+		if boardStatus.Result == RELOAD_REFUSED {
+			status.Success = false
+		}
+		status.Boards = append(status.Boards, boardStatus)
+	}
+	// Keep the old config if a board refused the change, so that the next
+	// reload (e.g. SIGHUP once the board is free) tries again. Boards that
+	// were updated will just report being unchanged then.
+	if !status.Success {
+		status.Error = "some boards refused the new tenant layout"
+		return oldConfig, status
+	}
+	return newConfig, status
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestReloadTenants(t *testing.T) {
+	tests := []struct {
+		name    string
+		inUse   bool
+		tenants []TenantConfig
+		result  string
+		counts  []int
+	}{
+		{"unchanged", false, []TenantConfig{{Name: "tenant", Count: 2}}, RELOAD_UNCHANGED, []int{2}},
+		{"resized", false, []TenantConfig{{Name: "tenant", Count: 3}}, RELOAD_UPDATED, []int{3}},
+		{"added", false, []TenantConfig{{Name: "tenant", Count: 2}, {Name: "big", Count: 1}}, RELOAD_UPDATED, []int{2, 1}},
+		{"removed", false, nil, RELOAD_UPDATED, nil},
+		{"in use", true, []TenantConfig{{Name: "tenant", Count: 3}}, RELOAD_REFUSED, []int{2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugin := newSimPlugins(t, simConfig(1, TenantConfig{Name: "tenant", Count: 2}))[0]
+			device := plugin.devices[0]
+			if test.inUse {
+				if err := device.setState(RESERVED); err != nil {
+					t.Fatal(err)
+				}
+			}
+			status := plugin.reloadTenants(simConfig(1, test.tenants...))
+			if status.Result != test.result {
+				t.Fatalf("reload was %s (%s), want %s", status.Result, status.Message, test.result)
+			}
+			if len(plugin.childPlugins) != len(test.counts) {
+				t.Fatalf("%d tenant classes, want %d", len(plugin.childPlugins), len(test.counts))
+			}
+			children := 0
+			for index, childPlugin := range plugin.childPlugins {
+				if len(childPlugin.devices) != test.counts[index] {
+					t.Errorf("class %s has %d tenants, want %d", childPlugin.tenantName, len(childPlugin.devices), test.counts[index])
+				}
+				children += len(childPlugin.devices)
+			}
+			if len(device.children) != children {
+				t.Errorf("FPGA has %d tenants, want %d", len(device.children), children)
+			}
+			// Nothing is left locked for the next caller
+			plugin.mutex.Lock()
+			plugin.mutex.Unlock()
+		})
+	}
+}
@@ -0,0 +1,769 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// A set of devices advertised to kubelet as one resource, e.g. all FPGAs of a
+// board type, or all PR regions of a tenant class. The resource server talks
+// to kubelet, the set only says what its devices are and how to use them.
+// Adding a new kind of resource means implementing this interface.
+//
+// Unless noted otherwise, methods are called with the set lock held, for
+// reading or writing depending on whether they change devices.
+type DeviceSet interface {
+	// The resource name, e.g. fidus.com/sidewinder-100
+	fullName() string
+	// Path of the socket the resource is served on
+	socketName() string
+	// The plugin of the FPGAs the devices are on. Its lock guards the devices
+	// of every set of the board, as they depend on each other, and its
+	// settings apply to all of them. Called without the lock held.
+	board() *FPGADevicePlugin
+	// Every device of the set, advertised or not
+	members() []managedDevice
+	// Which of the available devices we would rather hand out
+	preferredAllocation(available []string, mustInclude []string, size int) []string
+	// What a container needs to use the given devices
+	containerResponse(ids []string) *pluginapi.ContainerAllocateResponse
+	// Bitstream programmed into the devices unless their pod chooses another,
+	// may have a region placeholder
+	configuredBitstream() string
+}
+
+// Both kinds of FPGA resources we have
+var _ DeviceSet = &FPGADevicePlugin{}
+var _ DeviceSet = &FPGATenantDevicePlugin{}
+
+// Serves one device set to kubelet through the device plugin API
+type ResourceServer struct {
+	set DeviceSet
+	// The gRPC server, nil when stopped
+	server *grpc.Server
+	mutex  sync.Mutex
+}
+
+func NewResourceServer(set DeviceSet) *ResourceServer {
+	return &ResourceServer{
+		set: set,
+	}
+}
+
+func (rs *ResourceServer) running() bool {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return rs.server != nil
+}
+
+func (rs *ResourceServer) lock() *sync.RWMutex {
+	return &rs.set.board().mutex
+}
+
+// Notified whenever the devices change
+func (rs *ResourceServer) changes() *deviceNotifier {
+	return rs.set.board().notifier
+}
+
+// What we tell kubelet about the calls we support
+func (rs *ResourceServer) options() *pluginapi.DevicePluginOptions {
+	return kubeletOptions(rs.set.board().kubeletMode)
+}
+
+// Finds the bitstreams pods chose, nil if they can't choose
+func (rs *ResourceServer) bitstreamChooser() *BitstreamChooser {
+	return rs.set.board().chooser
+}
+
+// Persist which devices are in use, must be called with the set lock held
+func (rs *ResourceServer) saveCheckpoint() {
+	rs.set.board().saveCheckpoint()
+}
+
+// The devices kubelet may hand out, must be called with the set lock held
+func (rs *ResourceServer) availableDevices() []*pluginapi.Device {
+	var devices []*pluginapi.Device
+	for _, device := range rs.set.members() {
+		if !device.state().advertised() {
+			continue
+		}
+		// Copy the device, ListAndWatch keeps this list around to find
+		// out what changed later on
+		advertised := device.apiDevice()
+		devices = append(devices, &pluginapi.Device{
+			ID:       advertised.ID,
+			Health:   advertised.Health,
+			Topology: advertised.Topology,
+		})
+	}
+	return devices
+}
+
+// A device of the set, nil if the set doesn't have it. Must be called with
+// the set lock held.
+func (rs *ResourceServer) device(id string) managedDevice {
+	for _, device := range rs.set.members() {
+		if device.deviceID() == id {
+			return device
+		}
+	}
+	return nil
+}
+
+// Reserve a device for a container, a *TransitionError if it can't be. Must
+// be called with the set lock held.
+func (rs *ResourceServer) use(device managedDevice) error {
+	err := device.setState(RESERVED)
+	if err != nil {
+		return err
+	}
+	device.chooseBitstream(rs.set.configuredBitstream())
+	return nil
+}
+
+// Start the gRPC server and register it with kubelet, unless it is running
+// already
+func (rs *ResourceServer) Start() error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	if rs.server != nil {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"Resource": rs.set.fullName(),
+		"Socket":   rs.set.socketName(),
+	}).Info("Starting plugin server.")
+
+	// Create the server
+	rs.server = grpc.NewServer([]grpc.ServerOption{}...)
+	// Register the server
+	sock, err := net.Listen("unix", rs.set.socketName())
+	if err != nil {
+		rs.server = nil
+		log.WithFields(log.Fields{
+			"Socket": rs.set.socketName(),
+			"Error":  err,
+		}).Error("Cannot listen on socket.")
+		return err
+	}
+	pluginapi.RegisterDevicePluginServer(rs.server, rs)
+	// Start the server and make sure no errors
+	server := rs.server
+	go func() {
+		lastCrashTime := time.Now()
+		restartCount := 0
+		for {
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+			}).Info("Starting GRPC server")
+			err := server.Serve(sock)
+			if err == nil {
+				break
+			}
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+				"Error":    err,
+			}).Error("GRPC server crashed")
+
+			// restart if it has not been too often
+			// i.e. if server has crashed more than 5 times and it didn't last more than one hour each time
+			if restartCount > 5 {
+				log.WithFields(log.Fields{
+					"Resource": rs.set.fullName(),
+					"Error":    err,
+				}).Error("GRPC server has repeatedly crashed recently. Quitting")
+				break
+			}
+			timeSinceLastCrash := time.Since(lastCrashTime).Seconds()
+			lastCrashTime = time.Now()
+			if timeSinceLastCrash > 3600 {
+				// it has been one hour since the last crash.. reset the count
+				// to reflect on the frequency
+				restartCount = 1
+			} else {
+				restartCount += 1
+			}
+		}
+	}()
+
+	// Wait for server to start by launching a blocking connexion
+	conn, err := dial(rs.set.socketName(), 5*time.Second)
+	if err != nil {
+		rs.server = nil
+		log.WithFields(log.Fields{
+			"Socket": rs.set.socketName(),
+			"Error":  err,
+		}).Error("Cannot dial socket.")
+		return err
+	}
+	conn.Close()
+
+	// Register our server with kubelet
+	conn, err = dial(pluginapi.KubeletSocket, 5*time.Second)
+	if err != nil {
+		rs.server = nil
+		log.WithFields(log.Fields{
+			"Socket": rs.set.socketName(),
+			"Error":  err,
+		}).Error("Cannot dial socket.")
+		return err
+	}
+	defer conn.Close()
+
+	client := pluginapi.NewRegistrationClient(conn)
+	reqt := &pluginapi.RegisterRequest{
+		Version:      pluginapi.Version,
+		Endpoint:     path.Base(rs.set.socketName()),
+		ResourceName: rs.set.fullName(),
+		Options:      rs.options(),
+	}
+
+	_, err = client.Register(context.Background(), reqt)
+	if err != nil {
+		rs.server = nil
+		log.WithFields(log.Fields{
+			"Error": err,
+		}).Error("Cannot register client.")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"Resource": rs.set.fullName(),
+	}).Info("Successfully registered device plugin")
+	return nil
+}
+
+// Stop the gRPC server and remove its socket. The devices keep their status.
+func (rs *ResourceServer) Stop() error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	log.WithFields(log.Fields{
+		"Resource": rs.set.fullName(),
+		"Socket":   rs.set.socketName(),
+	}).Info("Stopping plugin server.")
+	if rs.server == nil {
+		log.Info("Plugin already stopped")
+		return nil
+	}
+	// Stop the server
+	rs.server.Stop()
+	rs.server = nil
+	// Remove the socket
+	err := os.Remove(rs.set.socketName())
+	if err != nil && !os.IsNotExist(err) {
+		log.WithFields(log.Fields{
+			"Socket": rs.set.socketName(),
+			"Error":  err,
+		}).Error("Failed to remove socket")
+		return err
+	}
+	return nil
+}
+
+// dial establishes the gRPC communication with the registered device plugin.
+func dial(unixSocketPath string, timeout time.Duration) (*grpc.ClientConn, error) {
+	c, err := grpc.Dial(unixSocketPath, grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithTimeout(timeout),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// The options we register with. The upstream kubelet doesn't know about
+// PostStopContainer and Deallocate, so Deallocate must be off for it. It reads
+// the field number of PostStopRequired as GetPreferredAllocation being
+// available though, which we want in both cases.
+func kubeletOptions(kubeletMode string) *pluginapi.DevicePluginOptions {
+	return &pluginapi.DevicePluginOptions{
+		PreStartRequired:   true,
+		PostStopRequired:   true,
+		DeallocateRequired: kubeletMode != KUBELET_UPSTREAM,
+	}
+}
+
+// The IDs the set doesn't have, must be called with the set lock held
+func (rs *ResourceServer) unknownDevices(ids []string) []string {
+	var unknown []string
+	for _, id := range ids {
+		if rs.device(id) == nil {
+			unknown = append(unknown, id)
+		}
+	}
+	return unknown
+}
+
+func (rs *ResourceServer) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
+	return rs.options(), nil
+}
+
+// Send the list of available devices to kubelet, and again whenever it changes.
+// This blocks until the device state changes or kubelet goes away.
+func (rs *ResourceServer) ListAndWatch(e *pluginapi.Empty, s pluginapi.DevicePlugin_ListAndWatchServer) error {
+	var oldDevices []*pluginapi.Device
+	first := true
+	for {
+		rs.lock().RLock()
+		changed := rs.changes().wait()
+		availableDevices := rs.availableDevices()
+		rs.lock().RUnlock()
+		// If the list of available devices has changed, send a message.
+		if first || !check_array_equality(availableDevices, oldDevices) {
+			err := s.Send(&pluginapi.ListAndWatchResponse{Devices: availableDevices})
+			if err != nil {
+				log.WithFields(log.Fields{
+					"Resource": rs.set.fullName(),
+					"Error":    err,
+				}).Error("Cannot send available devices")
+				return err
+			}
+			listAndWatchCounter.WithLabelValues(rs.set.fullName()).Inc()
+			// and update old list
+			first = false
+			oldDevices = availableDevices
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+			}).Debug("Change in available devices")
+			for _, device := range availableDevices {
+				log.WithFields(log.Fields{
+					"ID": device.ID,
+				}).Debug("Available device")
+			}
+		}
+		select {
+		case <-changed:
+		case <-s.Context().Done():
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+			}).Info("ListAndWatch stream closed")
+			return nil
+		}
+	}
+}
+
+// Only called by upstream kubelets, the patched one predates it
+func (rs *ResourceServer) GetPreferredAllocation(ctx context.Context, reqs *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
+	defer observeRequest(rs.set.fullName(), "GetPreferredAllocation", time.Now())
+	rs.lock().RLock()
+	defer rs.lock().RUnlock()
+	responses := pluginapi.PreferredAllocationResponse{}
+	for _, req := range reqs.ContainerRequests {
+		ids := rs.set.preferredAllocation(req.AvailableDeviceIDs, req.MustIncludeDeviceIDs, int(req.AllocationSize))
+		log.WithFields(log.Fields{
+			"Resource":  rs.set.fullName(),
+			"Available": req.AvailableDeviceIDs,
+			"IDs":       ids,
+		}).Debug("Preferred devices for allocation")
+		responses.ContainerResponses = append(responses.ContainerResponses, &pluginapi.ContainerPreferredAllocationResponse{
+			DeviceIDs: ids,
+		})
+	}
+	return &responses, nil
+}
+
+// Allocate devices, blocking the devices that depend on them in the process.
+// They stay RESERVED until their container starts.
+func (rs *ResourceServer) Allocate(ctx context.Context, reqs *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
+	defer observeRequest(rs.set.fullName(), "Allocate", time.Now())
+	if rs.set.board().kubeletMode == KUBELET_UPSTREAM {
+		rs.releaseStale(reqs)
+	}
+	rs.lock().Lock()
+	defer rs.lock().Unlock()
+	responses := pluginapi.AllocateResponse{}
+	// A device can only be given to one container
+	requested := make(map[string]bool)
+	for _, req := range reqs.ContainerRequests {
+		log.WithFields(log.Fields{
+			"Resource": rs.set.fullName(),
+			"IDs":      req.DevicesIDs,
+		}).Info("Devices requested for allocation")
+		for _, id := range req.DevicesIDs {
+			device := rs.device(id)
+			if device == nil {
+				log.WithFields(log.Fields{
+					"Resource": rs.set.fullName(),
+					"ID":       id,
+				}).Error("Invalid allocation request. Resource doesn't exist")
+				return nil, status.Errorf(codes.NotFound, "invalid allocation request for unavailable resource '%s': unknown device: %s", rs.set.fullName(), id)
+			}
+			if device.state() != FREE || requested[id] {
+				log.WithFields(log.Fields{
+					"Resource": rs.set.fullName(),
+					"ID":       id,
+					"Status":   device.state(),
+				}).Error("Invalid allocation request. Resource is busy")
+				return nil, status.Errorf(codes.FailedPrecondition, "invalid allocation request for busy resource '%s': device is busy: %s", rs.set.fullName(), id)
+			}
+			requested[id] = true
+		}
+
+		responses.ContainerResponses = append(responses.ContainerResponses, rs.set.containerResponse(req.DevicesIDs))
+	}
+
+	// If we are here, it means the request didn't have any errors, we can
+	// start blocking the devices that depend on the requested ones.
+	var used []string
+	for _, req := range reqs.ContainerRequests {
+		for _, id := range req.DevicesIDs {
+			err := rs.use(rs.device(id))
+			if err != nil {
+				// We checked everything under the lock, so this is a bug.
+				// Give back what we took so the devices stay usable.
+				log.WithFields(log.Fields{
+					"Resource": rs.set.fullName(),
+					"ID":       id,
+					"Error":    err,
+				}).Error("Cannot use device that was free")
+				for _, usedID := range used {
+					releaseDevice(rs.device(usedID))
+				}
+				rs.saveCheckpoint()
+				return nil, status.Errorf(codes.Internal, "cannot allocate '%s': %v", id, err)
+			}
+			used = append(used, id)
+		}
+	}
+	rs.saveCheckpoint()
+	return &responses, nil
+}
+
+// The upstream kubelet never deallocates, so it may hand out devices again
+// before reconciliation noticed that their containers are gone. Ask it which
+// of the requested devices that are still in use a container holds, and wipe
+// and free the others so that they can be allocated.
+func (rs *ResourceServer) releaseStale(reqs *pluginapi.AllocateRequest) {
+	rs.lock().Lock()
+	var busy []string
+	for _, req := range reqs.ContainerRequests {
+		for _, id := range req.DevicesIDs {
+			device := rs.device(id)
+			if device != nil && device.state().inUse() && device.state() != PROGRAMMING {
+				busy = append(busy, id)
+			}
+		}
+	}
+	socket := rs.set.board().podResources
+	rs.lock().Unlock()
+	if len(busy) == 0 {
+		return
+	}
+	allocated, err := readPodResources(socket)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Resource": rs.set.fullName(),
+			"IDs":      busy,
+			"Error":    err,
+		}).Warn("Cannot read pod resources, keeping busy devices")
+		return
+	}
+	rs.lock().Lock()
+	var releases []*pendingRelease
+	for _, id := range busy {
+		device := rs.device(id)
+		if allocated[rs.set.fullName()][id] || !device.state().inUse() || device.state() == PROGRAMMING {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"Resource": rs.set.fullName(),
+			"ID":       id,
+		}).Warn("Kubelet allocates device no container holds anymore, freeing it")
+		release, err := startRelease(device)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+				"ID":       id,
+				"Error":    err,
+			}).Error("Cannot free device")
+			continue
+		}
+		releases = append(releases, release)
+	}
+	if len(releases) > 0 {
+		rs.saveCheckpoint()
+	}
+	rs.lock().Unlock()
+	if len(releases) == 0 {
+		return
+	}
+	// Wipe without the lock, like reconcile does
+	wipeErrs := make([]error, len(releases))
+	for index, release := range releases {
+		wipeErrs[index] = release.device.Reset()
+	}
+	rs.lock().Lock()
+	defer rs.lock().Unlock()
+	for index, release := range releases {
+		finishReset(release.device, release.state, wipeErrs[index])
+	}
+	rs.saveCheckpoint()
+}
+
+// Give devices the bitstream the pod of their container chose, if it chose one
+func (rs *ResourceServer) chooseBitstream(ctx context.Context, deadline time.Time, devices []managedDevice) error {
+	chooser := rs.bitstreamChooser()
+	if chooser == nil {
+		return nil
+	}
+	var ids []string
+	for _, device := range devices {
+		ids = append(ids, device.deviceID())
+	}
+	chooseCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	bitstream, err := chooser.choose(chooseCtx, rs.set.fullName(), ids)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Resource": rs.set.fullName(),
+			"IDs":      ids,
+			"Error":    err,
+		}).Error("Cannot find the bitstream chosen for devices")
+		return status.Errorf(codes.Unavailable, "cannot find the bitstream chosen for %v of resource '%s': %v", ids, rs.set.fullName(), err)
+	}
+	if bitstream == "" {
+		return nil
+	}
+	for _, device := range devices {
+		if err := checkBitstream(device.fpga(), bitstream); err != nil {
+			log.WithFields(log.Fields{
+				"Resource":  rs.set.fullName(),
+				"ID":        device.deviceID(),
+				"Bitstream": bitstream,
+				"Error":     err,
+			}).Error("Cannot program the bitstream chosen for device")
+			return status.Errorf(codes.FailedPrecondition, "cannot program the bitstream chosen for '%s' of resource '%s': %v", device.deviceID(), rs.set.fullName(), err)
+		}
+	}
+	rs.lock().Lock()
+	defer rs.lock().Unlock()
+	for _, device := range devices {
+		device.chooseBitstream(bitstream)
+	}
+	return nil
+}
+
+// Program the bitstreams of a container before it starts. The devices are
+// PROGRAMMING, and hidden from kubelet, in the meantime. Containers of
+// DRAINING devices aren't started again.
+func (rs *ResourceServer) PreStartContainer(ctx context.Context, req *pluginapi.PreStartContainerRequest) (*pluginapi.PreStartContainerResponse, error) {
+	defer observeRequest(rs.set.fullName(), "PreStartContainer", time.Now())
+	log.WithFields(log.Fields{
+		"Resource": rs.set.fullName(),
+		"IDs":      req.DevicesIDs,
+	}).Info("Devices PreStartContainer Requested")
+	var devices []managedDevice
+	rs.lock().Lock()
+	for _, id := range req.DevicesIDs {
+		device := rs.device(id)
+		if device == nil {
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+				"ID":       id,
+			}).Error("Invalid PreStartContainer request. Resource doesn't exist")
+			rs.lock().Unlock()
+			return nil, status.Errorf(codes.NotFound, "invalid PreStartContainer request for unavailable resource '%s': unknown device: %s", rs.set.fullName(), id)
+		}
+		if device.state() != RESERVED && device.state() != USED {
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+				"ID":       id,
+				"Status":   device.state(),
+			}).Error("Invalid PreStartContainer request. Resource is not used")
+			rs.lock().Unlock()
+			return nil, status.Errorf(codes.FailedPrecondition, "invalid PreStartContainer request for unused resource '%s': device is not allocated: %s", rs.set.fullName(), id)
+		}
+		devices = append(devices, device)
+	}
+	for _, device := range devices {
+		// Can't fail, we just checked them all
+		device.setState(PROGRAMMING)
+	}
+	rs.lock().Unlock()
+	// Programming takes a while, so don't hold the lock for it. The devices
+	// can't be released while they are being programmed.
+	deadline := preStartDeadline(ctx)
+	err := rs.chooseBitstream(ctx, deadline, devices)
+	for _, device := range devices {
+		if err != nil {
+			break
+		}
+		err = device.Program(deadline)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+				"ID":       device.deviceID(),
+				"Error":    err,
+			}).Error("Failed to program device")
+			break
+		}
+	}
+	// The container only starts if all of its devices are ready
+	state := USED
+	if err != nil {
+		state = RESERVED
+	}
+	rs.lock().Lock()
+	defer rs.lock().Unlock()
+	for _, device := range devices {
+		// Someone may have taken the device out of service meanwhile
+		stateErr := device.setState(state)
+		if stateErr != nil {
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+				"ID":       device.deviceID(),
+				"Error":    stateErr,
+			}).Error("Device changed while it was programmed")
+			if err == nil {
+				err = status.Error(codes.FailedPrecondition, stateErr.Error())
+			}
+		}
+	}
+	if err != nil {
+		if _, ok := status.FromError(err); !ok {
+			err = status.Error(codes.Internal, err.Error())
+		}
+		return nil, err
+	}
+	return &pluginapi.PreStartContainerResponse{}, nil
+}
+
+// Only checks the request. The devices stay with the pod, whose container
+// may be restarted, and are wiped once kubelet deallocates them.
+func (rs *ResourceServer) PostStopContainer(ctx context.Context, req *pluginapi.PostStopContainerRequest) (*pluginapi.Empty, error) {
+	defer observeRequest(rs.set.fullName(), "PostStopContainer", time.Now())
+	log.WithFields(log.Fields{
+		"Resource": rs.set.fullName(),
+		"IDs":      req.DevicesIDs,
+	}).Info("Devices PostStopContainer Requested")
+	rs.lock().RLock()
+	defer rs.lock().RUnlock()
+	unknown := rs.unknownDevices(req.DevicesIDs)
+	if len(unknown) > 0 {
+		log.WithFields(log.Fields{
+			"Resource": rs.set.fullName(),
+			"IDs":      unknown,
+		}).Error("Invalid PostStopContainer request. Resources don't exist")
+		return nil, status.Errorf(codes.NotFound, "invalid PostStopContainer request for resource '%s': unknown devices: %s", rs.set.fullName(), strings.Join(unknown, ", "))
+	}
+	for _, id := range req.DevicesIDs {
+		device := rs.device(id)
+		if !device.state().inUse() {
+			log.WithFields(log.Fields{
+				"Resource": rs.set.fullName(),
+				"ID":       id,
+				"Status":   device.state(),
+			}).Error("Invalid PostStopContainer request. Resource is not used")
+		}
+	}
+	return &pluginapi.Empty{}, nil
+}
+
+// Deallocate devices, unblocking the devices that depend on them in the
+// process. The devices are RESETTING, and hidden from kubelet, until they
+// are wiped.
+func (rs *ResourceServer) Deallocate(ctx context.Context, reqs *pluginapi.DeallocateRequest) (*pluginapi.Empty, error) {
+	defer observeRequest(rs.set.fullName(), "Deallocate", time.Now())
+	rs.lock().Lock()
+	// Don't release anything unless we know all the devices
+	var unknown []string
+	for _, req := range reqs.ContainerRequests {
+		unknown = append(unknown, rs.unknownDevices(req.DevicesIDs)...)
+	}
+	if len(unknown) > 0 {
+		rs.lock().Unlock()
+		log.WithFields(log.Fields{
+			"Resource": rs.set.fullName(),
+			"IDs":      unknown,
+		}).Error("Invalid deallocation request. Resources don't exist")
+		return nil, status.Errorf(codes.NotFound, "invalid deallocation request for resource '%s': unknown devices: %s", rs.set.fullName(), strings.Join(unknown, ", "))
+	}
+	var firstErr error
+	var devices []managedDevice
+	var states []DeviceState
+	for _, req := range reqs.ContainerRequests {
+		log.WithFields(log.Fields{
+			"Resource": rs.set.fullName(),
+			"IDs":      req.DevicesIDs,
+		}).Info("Devices deallocation requested")
+		for _, id := range req.DevicesIDs {
+			device := rs.device(id)
+			if !device.state().inUse() {
+				log.WithFields(log.Fields{
+					"Resource": rs.set.fullName(),
+					"ID":       id,
+					"Status":   device.state(),
+				}).Error("Invalid deallocation request. Resource is not busy")
+			}
+			// Devices that can't be freed are left alone, the others are
+			// still released.
+			state := releasedState(device.state())
+			err := device.setState(RESETTING)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"Resource": rs.set.fullName(),
+					"ID":       id,
+					"Error":    err,
+				}).Error("Invalid deallocation request. Resource can't be freed")
+				if firstErr == nil {
+					firstErr = status.Errorf(codes.FailedPrecondition, "invalid deallocation request for resource '%s': %v", rs.set.fullName(), err)
+				}
+				continue
+			}
+			devices = append(devices, device)
+			states = append(states, state)
+		}
+	}
+	rs.saveCheckpoint()
+	rs.lock().Unlock()
+
+	// Wipe whatever the containers left behind. This takes a while, so
+	// don't hold the lock for it.
+	wipeErrs := make([]error, len(devices))
+	for index, device := range devices {
+		wipeErrs[index] = device.Reset()
+	}
+
+	rs.lock().Lock()
+	defer rs.lock().Unlock()
+	for index, device := range devices {
+		finishReset(device, states[index], wipeErrs[index])
+	}
+	rs.saveCheckpoint()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return &pluginapi.Empty{}, nil
+}
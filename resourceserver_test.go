@@ -0,0 +1,400 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The kubelet end of a ListAndWatch stream
+type fakeListAndWatchStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses chan *pluginapi.ListAndWatchResponse
+}
+
+func (stream *fakeListAndWatchStream) Send(response *pluginapi.ListAndWatchResponse) error {
+	stream.responses <- response
+	return nil
+}
+
+func (stream *fakeListAndWatchStream) Context() context.Context {
+	return stream.ctx
+}
+
+// Run ListAndWatch until the test ends
+func startListAndWatch(t *testing.T, rs *ResourceServer) *fakeListAndWatchStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &fakeListAndWatchStream{
+		ctx:       ctx,
+		responses: make(chan *pluginapi.ListAndWatchResponse, 16),
+	}
+	done := make(chan struct{})
+	go func() {
+		rs.ListAndWatch(&pluginapi.Empty{}, stream)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return stream
+}
+
+// The next list sent to kubelet, by device ID
+func (stream *fakeListAndWatchStream) next(t *testing.T) map[string]*pluginapi.Device {
+	t.Helper()
+	select {
+	case response := <-stream.responses:
+		devices := make(map[string]*pluginapi.Device)
+		for _, device := range response.Devices {
+			devices[device.ID] = device
+		}
+		return devices
+	case <-time.After(time.Second):
+		t.Fatal("no update from ListAndWatch")
+	}
+	return nil
+}
+
+// Check that nothing else is sent to kubelet
+func (stream *fakeListAndWatchStream) idle(t *testing.T) {
+	t.Helper()
+	select {
+	case response := <-stream.responses:
+		t.Fatalf("unexpected update from ListAndWatch: %v", response.Devices)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestListAndWatchHealth(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(2))[0]
+	stream := startListAndWatch(t, plugin.server)
+	devices := stream.next(t)
+	if len(devices) != 2 {
+		t.Fatalf("listed %d devices, want 2", len(devices))
+	}
+	device := plugin.devices[0]
+	plugin.mutex.Lock()
+	device.SetUnhealthy()
+	plugin.mutex.Unlock()
+	devices = stream.next(t)
+	if len(devices) != 2 || devices[device.ID].Health != pluginapi.Unhealthy {
+		t.Fatalf("listed %v after SetUnhealthy, want %s unhealthy", devices, device.ID)
+	}
+	if devices[plugin.devices[1].ID].Health != pluginapi.Healthy {
+		t.Errorf("%s is not healthy anymore", plugin.devices[1].ID)
+	}
+	// Notifications that change nothing kubelet sees are not sent
+	plugin.notifier.notify()
+	stream.idle(t)
+}
+
+// Every stream on a resource gets every update, none waits for another
+func TestListAndWatchStreams(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(2, TenantConfig{Name: "tenant", Count: 2}))[0]
+	tenants := plugin.childPlugins[0]
+	streams := []*fakeListAndWatchStream{
+		startListAndWatch(t, plugin.server),
+		startListAndWatch(t, plugin.server),
+	}
+	tenantStreams := []*fakeListAndWatchStream{
+		startListAndWatch(t, tenants.server),
+		startListAndWatch(t, tenants.server),
+	}
+	for _, stream := range append(streams, tenantStreams...) {
+		stream.next(t)
+	}
+	device := plugin.devices[0]
+	tenant := device.children[0]
+	// An unhealthy FPGA takes its tenants with it, it is hidden while it
+	// is reset, and everything is healthy again once it is free
+	for round, state := range []DeviceState{UNHEALTHY, RESETTING, FREE} {
+		plugin.mutex.Lock()
+		if err := device.setState(state); err != nil {
+			t.Fatal(err)
+		}
+		plugin.mutex.Unlock()
+		health := pluginapi.Healthy
+		if state == UNHEALTHY {
+			health = pluginapi.Unhealthy
+		}
+		for index, stream := range streams {
+			devices := stream.next(t)
+			listed, found := devices[device.ID]
+			if found != state.advertised() {
+				t.Errorf("round %d: stream %d listed %s: %v, want %v", round, index, device.ID, found, state.advertised())
+			} else if found && listed.Health != health {
+				t.Errorf("round %d: stream %d listed %s %s, want %s", round, index, device.ID, listed.Health, health)
+			}
+		}
+		for index, stream := range tenantStreams {
+			// Resetting the FPGA leaves its tenants unhealthy
+			if state == RESETTING {
+				stream.idle(t)
+				continue
+			}
+			devices := stream.next(t)
+			if listed, found := devices[tenant.ID]; !found || listed.Health != health {
+				t.Errorf("round %d: tenant stream %d listed %s as %v, want %s", round, index, tenant.ID, listed, health)
+			}
+		}
+	}
+	for _, stream := range append(streams, tenantStreams...) {
+		stream.idle(t)
+	}
+}
+
+func TestListAndWatchTopology(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(2))[0]
+	stream := startListAndWatch(t, plugin.server)
+	stream.next(t)
+	device := plugin.devices[1]
+	plugin.mutex.Lock()
+	device.Topology = &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: 1}}}
+	plugin.notifier.notify()
+	plugin.mutex.Unlock()
+	devices := stream.next(t)
+	topology := devices[device.ID].Topology
+	if topology == nil || len(topology.Nodes) != 1 || topology.Nodes[0].ID != 1 {
+		t.Fatalf("listed topology %v, want NUMA node 1", topology)
+	}
+}
+
+// A backend whose Discover checks that nobody holds the lock of a plugin
+type lockCheckingBackend struct {
+	Backend
+	t      *testing.T
+	plugin *FPGADevicePlugin
+}
+
+func (backend *lockCheckingBackend) Discover() []*DiscoveredFPGA {
+	unlocked := make(chan struct{})
+	go func() {
+		backend.plugin.mutex.RLock()
+		backend.plugin.mutex.RUnlock()
+		close(unlocked)
+	}()
+	select {
+	case <-unlocked:
+	case <-time.After(time.Second):
+		backend.t.Error("plugin is locked while backends search for FPGAs")
+	}
+	return backend.Backend.Discover()
+}
+
+// Backends may take a while to search, other calls must not wait on them
+func TestRediscoveryWithoutLock(t *testing.T) {
+	config := simConfig(1)
+	plugins := newSimPlugins(t, config)
+	config.Simulated[0].Count = 2
+	backend, err := newSimBackend(&BackendOptions{Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found := rediscoverDevices([]Backend{&lockCheckingBackend{backend, t, plugins[0]}}, config, nil, plugins)
+	if found != 1 {
+		t.Errorf("found %d new FPGAs, want 1", found)
+	}
+}
+
+func TestListAndWatchRediscovery(t *testing.T) {
+	config := simConfig(2)
+	plugins := newSimPlugins(t, config)
+	stream := startListAndWatch(t, plugins[0].server)
+	stream.next(t)
+	// A third FPGA shows up
+	config.Simulated[0].Count = 3
+	backend, err := newSimBackend(&BackendOptions{Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found := rediscoverDevices([]Backend{backend}, config, nil, plugins)
+	if found != 1 {
+		t.Fatalf("found %d new FPGAs, want 1", found)
+	}
+	devices := stream.next(t)
+	if len(devices) != 3 {
+		t.Fatalf("listed %d devices after rediscovery, want 3", len(devices))
+	}
+}
+
+// Check the code and message of a rejected request
+func checkStatus(t *testing.T, err error, code codes.Code, message string) {
+	t.Helper()
+	if status.Code(err) != code || err == nil || !strings.Contains(err.Error(), message) {
+		t.Errorf("returned %v, want %s containing %q", err, code, message)
+	}
+}
+
+func allocate(rs *ResourceServer, ids ...string) error {
+	_, err := rs.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: ids}},
+	})
+	return err
+}
+
+func preStart(rs *ResourceServer, ids ...string) error {
+	_, err := rs.PreStartContainer(context.Background(), &pluginapi.PreStartContainerRequest{DevicesIDs: ids})
+	return err
+}
+
+func TestAllocateRejected(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(2, TenantConfig{Name: "tenant", Count: 2}))[0]
+	tenants := plugin.childPlugins[0]
+	used := plugin.devices[0]
+	if err := used.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	free := plugin.devices[1]
+	tests := []struct {
+		name    string
+		server  *ResourceServer
+		ids     []string
+		code    codes.Code
+		message string
+	}{
+		{"unknown", plugin.server, []string{"unknown"}, codes.NotFound, "unknown device: unknown"},
+		{"used", plugin.server, []string{used.ID}, codes.FailedPrecondition, "device is busy: " + used.ID},
+		{"blocked tenant", tenants.server, []string{used.children[0].ID}, codes.FailedPrecondition, "device is busy: " + used.children[0].ID},
+		{"twice", plugin.server, []string{free.ID, free.ID}, codes.FailedPrecondition, "device is busy: " + free.ID},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkStatus(t, allocate(test.server, test.ids...), test.code, test.message)
+		})
+	}
+	// Nothing was taken by the rejected requests
+	if free.status != FREE {
+		t.Errorf("%s is %s, want FREE", free.ID, free.status)
+	}
+}
+
+func TestPreStartRejected(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(2))[0]
+	free := plugin.devices[0]
+	resetting := plugin.devices[1]
+	if err := resetting.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	if err := resetting.setState(RESETTING); err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, preStart(plugin.server, "unknown"), codes.NotFound, "unknown device: unknown")
+	checkStatus(t, preStart(plugin.server, free.ID), codes.FailedPrecondition, "device is not allocated: "+free.ID)
+	checkStatus(t, preStart(plugin.server, resetting.ID), codes.FailedPrecondition, "device is not allocated: "+resetting.ID)
+	if free.status != FREE || resetting.status != RESETTING {
+		t.Errorf("rejected requests changed the devices to %s and %s", free.status, resetting.status)
+	}
+}
+
+func deallocate(rs *ResourceServer, ids ...string) (*pluginapi.Empty, error) {
+	return rs.Deallocate(context.Background(), &pluginapi.DeallocateRequest{
+		ContainerRequests: []*pluginapi.ContainerDeallocateRequest{{DevicesIDs: ids}},
+	})
+}
+
+func postStop(rs *ResourceServer, ids ...string) (*pluginapi.Empty, error) {
+	return rs.PostStopContainer(context.Background(), &pluginapi.PostStopContainerRequest{DevicesIDs: ids})
+}
+
+func TestDeallocate(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(2, TenantConfig{Name: "tenant", Count: 2}))[0]
+	tenants := plugin.childPlugins[0]
+	fpga := plugin.devices[0]
+	tenant := plugin.devices[1].children[0]
+	if err := fpga.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenant.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	// Requests with unknown devices release nothing
+	_, err := deallocate(plugin.server, fpga.ID, "unknown")
+	checkStatus(t, err, codes.NotFound, "unknown devices: unknown")
+	if fpga.status != USED {
+		t.Errorf("%s is %s after a rejected request, want USED", fpga.ID, fpga.status)
+	}
+	_, err = deallocate(tenants.server, fpga.ID)
+	checkStatus(t, err, codes.NotFound, "unknown devices: "+fpga.ID)
+	if fpga.status != USED {
+		t.Errorf("%s is %s after a request for another resource, want USED", fpga.ID, fpga.status)
+	}
+	tests := []struct {
+		server *ResourceServer
+		device managedDevice
+	}{
+		{plugin.server, fpga},
+		{tenants.server, tenant},
+	}
+	for _, test := range tests {
+		empty, err := deallocate(test.server, test.device.deviceID())
+		if err != nil || empty == nil {
+			t.Errorf("deallocating %s returned %v, %v", test.device.deviceID(), empty, err)
+		}
+		if test.device.state() != FREE {
+			t.Errorf("%s is %s once deallocated, want FREE", test.device.deviceID(), test.device.state())
+		}
+	}
+	if tenant.parent.status != FREE {
+		t.Errorf("%s is %s once its tenant is deallocated, want FREE", tenant.parent.ID, tenant.parent.status)
+	}
+}
+
+func TestPostStopContainer(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(2, TenantConfig{Name: "tenant", Count: 2}))[0]
+	tenants := plugin.childPlugins[0]
+	fpga := plugin.devices[0]
+	tenant := plugin.devices[1].children[0]
+	if err := fpga.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenant.setState(USED); err != nil {
+		t.Fatal(err)
+	}
+	_, err := postStop(plugin.server, fpga.ID, "unknown")
+	checkStatus(t, err, codes.NotFound, "unknown devices: unknown")
+	_, err = postStop(tenants.server, fpga.ID)
+	checkStatus(t, err, codes.NotFound, "unknown devices: "+fpga.ID)
+	// The devices stay with the pod until they are deallocated
+	tests := []struct {
+		server *ResourceServer
+		device managedDevice
+	}{
+		{plugin.server, fpga},
+		{tenants.server, tenant},
+		{tenants.server, plugin.devices[1].children[1]},
+	}
+	for _, test := range tests {
+		state := test.device.state()
+		empty, err := postStop(test.server, test.device.deviceID())
+		if err != nil || empty == nil {
+			t.Errorf("PostStopContainer of %s returned %v, %v", test.device.deviceID(), empty, err)
+		}
+		if test.device.state() != state {
+			t.Errorf("%s is %s after PostStopContainer, want %s", test.device.deviceID(), test.device.state(), state)
+		}
+	}
+}
@@ -18,19 +18,11 @@ package main
 
 import (
 	"errors"
-	"fmt"
-	"io/ioutil"
-	"net"
-	"os"
-	"path"
 	"strconv"
 	"sync"
-	"time"
 
 	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/net/context"
-	"google.golang.org/grpc"
 )
 
 // The hierarchy of this is a bit weird. We have `Device Plugins`, each plugin
@@ -55,16 +47,40 @@ type FPGADevicePlugin struct {
 	//		xilinx.com/alveo
 	vendorName string
 	boardName  string
-	// The server for this plugin
-	server *grpc.Server
+	// Serves this plugin to kubelet
+	server *ResourceServer
 	// The list of IDs of FPGA devices of this type in the system
 	devices []*FPGADevice
 	// Number of devices
 	deviceCount int
 	// Pointers to the child tenant device plugins
 	childPlugins []*FPGATenantDevicePlugin
-	// old list of available devices, used by ListAndWatch
-	oldDevices []*pluginapi.Device
+	// Bitstream used to wipe FPGAs of this type
+	blankBitstream string
+	// Bitstream programmed into FPGAs of this type before containers start
+	bitstream string
+	// The shell control interface given to tenants of FPGAs of this type
+	shell AccessConfig
+	// Thresholds the health monitor checks FPGAs of this type against
+	health HealthConfig
+	// Notifies ListAndWatch of this plugin and its children of changes
+	notifier *deviceNotifier
+	// Where allocations are persisted, nil if they aren't
+	checkpoint *Checkpoint
+	// IDs kept from earlier versions, shared by all plugins. Nil if there
+	// are none
+	aliases *DeviceAliases
+	// Which kubelet we register with, patched or upstream. Also used
+	// by the child plugins
+	kubeletMode string
+	// Where the upstream kubelet is asked which devices containers still
+	// hold
+	podResources string
+	// How GetPreferredAllocation picks devices for this plugin and its children
+	allocationPolicy string
+	// Finds the bitstreams pods chose for this plugin and its children, nil
+	// if only the configured ones are programmed
+	chooser *BitstreamChooser
 	// Mutex
 	mutex sync.RWMutex
 }
@@ -78,16 +94,23 @@ type FPGATenantDevicePlugin struct {
 	vendorName string
 	boardName  string
 	tenantName string
-	// The server for this plugin
-	server *grpc.Server
+	// Number of tenants of this type on every FPGA
+	tenantCount int
+	// Bitstream used to wipe tenants of this type, may have a region placeholder
+	blankBitstream string
+	// Bitstream programmed into tenants of this type before containers start,
+	// may have a region placeholder
+	bitstream string
+	// How containers reach the PR regions of this type
+	region RegionConfig
+	// Serves this plugin to kubelet
+	server *ResourceServer
 	// The id of this tenant in its parent FPGA device.
 	devices []*FPGATenantDevice
 	// Number of devices
 	deviceCount int
 	// Pointer to the parent device plugin
 	parentPlugin *FPGADevicePlugin
-	// old list of available devices, used by ListAndWatch
-	oldDevices []*pluginapi.Device
 }
 
 func (plugin *FPGADevicePlugin) fullName() string {
@@ -107,73 +130,125 @@ func (plugin *FPGATenantDevicePlugin) socketName() string {
 }
 
 // FPGA Plugin Constructor, this should take its inputs from system files.
-func NewFPGADevicePlugin(vendorName string, boardName string) *FPGADevicePlugin {
+func NewFPGADevicePlugin(vendorName string, boardName string, config *Config) *FPGADevicePlugin {
 	ret := FPGADevicePlugin{
-		vendorName:   vendorName,
-		boardName:    boardName,
-		server:       nil,
-		devices:      []*FPGADevice{},
-		deviceCount:  0,
-		childPlugins: []*FPGATenantDevicePlugin{},
-	}
+		vendorName:       vendorName,
+		boardName:        boardName,
+		devices:          []*FPGADevice{},
+		deviceCount:      0,
+		childPlugins:     []*FPGATenantDevicePlugin{},
+		notifier:         newDeviceNotifier(),
+		kubeletMode:      KUBELET_PATCHED,
+		podResources:     PodResourcesSocket,
+		allocationPolicy: ALLOCATION_PACKED,
+	}
+	if boardConfig := config.board(vendorName, boardName); boardConfig != nil {
+		ret.blankBitstream = boardConfig.BlankBitstream
+		ret.bitstream = boardConfig.Bitstream
+		ret.shell = boardConfig.Shell
+		ret.health = boardConfig.Health
+	}
+	ret.server = NewResourceServer(&ret)
 	return &ret
 }
 
 // FPGA Tenant Constructor, constructs one if the FPGA is divided uniformly to PR regions,
-// and constructs multiples otherwise
-func NewFPGATenantDevicePlugins(parentPlugin *FPGADevicePlugin) []*FPGATenantDevicePlugin {
+// and constructs multiples otherwise. Boards missing from the config have no tenants.
+func NewFPGATenantDevicePlugins(parentPlugin *FPGADevicePlugin, config *Config) []*FPGATenantDevicePlugin {
 	var ret []*FPGATenantDevicePlugin
-	for tenantName, _ := range tenants[parentPlugin.boardName] {
-		newTenantPlugin := &FPGATenantDevicePlugin{
-			vendorName:   parentPlugin.vendorName,
-			boardName:    parentPlugin.boardName,
-			tenantName:   tenantName,
-			server:       nil,
-			devices:      []*FPGATenantDevice{},
-			deviceCount:  0,
-			parentPlugin: parentPlugin,
-		}
-		parentPlugin.childPlugins = append(parentPlugin.childPlugins, newTenantPlugin)
-		ret = append(ret, newTenantPlugin)
+	boardConfig := config.board(parentPlugin.vendorName, parentPlugin.boardName)
+	if boardConfig == nil {
+		log.WithFields(log.Fields{
+			"Resource": parentPlugin.fullName(),
+		}).Info("Board has no tenant configuration, advertising entire FPGAs only.")
+		return ret
+	}
+	for _, tenant := range boardConfig.Tenants {
+		ret = append(ret, newFPGATenantDevicePlugin(parentPlugin, tenant))
 	}
 	return ret
 }
 
-func addDevice(parentPlugin *FPGADevicePlugin) {
+// Construct the plugin of a single tenant class and attach it to its parent
+func newFPGATenantDevicePlugin(parentPlugin *FPGADevicePlugin, tenant TenantConfig) *FPGATenantDevicePlugin {
+	newTenantPlugin := &FPGATenantDevicePlugin{
+		vendorName:     parentPlugin.vendorName,
+		boardName:      parentPlugin.boardName,
+		tenantName:     tenant.Name,
+		tenantCount:    tenant.Count,
+		blankBitstream: tenant.BlankBitstream,
+		bitstream:      tenant.Bitstream,
+		region:         tenant.Region,
+		devices:        []*FPGATenantDevice{},
+		deviceCount:    0,
+		parentPlugin:   parentPlugin,
+	}
+	newTenantPlugin.server = NewResourceServer(newTenantPlugin)
+	parentPlugin.childPlugins = append(parentPlugin.childPlugins, newTenantPlugin)
+	return newTenantPlugin
+}
+
+// Add an FPGA found by a backend to a plugin, see ids.go for how its
+// identity makes up the device ID
+func addDevice(parentPlugin *FPGADevicePlugin, found *DiscoveredFPGA) *FPGADevice {
 	// Create FPGA device
-	newFPGADevice := &FPGADevice{}
-	newFPGADevice.ID = join_strings(parentPlugin.fullName(), "-", strconv.Itoa(parentPlugin.deviceCount))
+	newFPGADevice := found.device
+	newFPGADevice.stableID = join_strings(parentPlugin.fullName(), "-", found.identity)
+	legacyID := join_strings(parentPlugin.fullName(), "-", strconv.Itoa(parentPlugin.deviceCount))
+	newFPGADevice.ID = parentPlugin.aliases.resolve(newFPGADevice.stableID, legacyID)
 	newFPGADevice.Health = pluginapi.Healthy
 	newFPGADevice.status = FREE
+	newFPGADevice.resource = parentPlugin.fullName()
+	deviceStatusGauge.WithLabelValues(newFPGADevice.resource, FREE.String()).Inc()
+	newFPGADevice.blankBitstream = parentPlugin.blankBitstream
+	newFPGADevice.notifier = parentPlugin.notifier
 	log.WithFields(log.Fields{
 		"Plugin": parentPlugin.fullName(),
 		"ID":     newFPGADevice.ID,
 	}).Info("Found device")
+	newFPGADevice.logFiles()
 	// Add it to plugin
 	parentPlugin.devices = append(parentPlugin.devices, newFPGADevice)
 	parentPlugin.deviceCount++
 	// Create FPGA tenant devices
 	for _, childPlugin := range parentPlugin.childPlugins {
-		for i := 0; i < tenants[childPlugin.boardName][childPlugin.tenantName]; i++ {
-			// Create FPGA tenant device
-			newTenantDevice := &FPGATenantDevice{}
-			newTenantDevice.ID = join_strings(newFPGADevice.ID, "-", strconv.Itoa(childPlugin.deviceCount))
-			newTenantDevice.Health = pluginapi.Healthy
-			newTenantDevice.status = FREE
-			newTenantDevice.parent = newFPGADevice
-			log.WithFields(log.Fields{
-				"Plugin": childPlugin.fullName(),
-				"ID":     newTenantDevice.ID,
-			}).Info("Found tenant device")
-			newFPGADevice.children = append(newFPGADevice.children, newTenantDevice)
-			// Add it to plugin
-			childPlugin.devices = append(childPlugin.devices, newTenantDevice)
-			childPlugin.deviceCount++
+		addTenantDevices(childPlugin, newFPGADevice)
+	}
+	return newFPGADevice
+}
+
+// Create the tenant devices of one tenant class on an FPGA device
+func addTenantDevices(childPlugin *FPGATenantDevicePlugin, parentDevice *FPGADevice) {
+	for i := 0; i < childPlugin.tenantCount; i++ {
+		// Create FPGA tenant device
+		newTenantDevice := &FPGATenantDevice{}
+		stableID := join_strings(parentDevice.stableID, "-", childPlugin.tenantName, "-", strconv.Itoa(i))
+		legacyID := join_strings(parentDevice.ID, "-", strconv.Itoa(childPlugin.deviceCount))
+		newTenantDevice.ID = childPlugin.parentPlugin.aliases.resolve(stableID, legacyID)
+		newTenantDevice.Health = pluginapi.Healthy
+		newTenantDevice.status = FREE
+		newTenantDevice.resource = childPlugin.fullName()
+		deviceStatusGauge.WithLabelValues(newTenantDevice.resource, FREE.String()).Inc()
+		newTenantDevice.class = childPlugin.tenantName
+		newTenantDevice.region = i
+		newTenantDevice.blankBitstream = regionBitstream(childPlugin.blankBitstream, i)
+		// Tenants of a broken FPGA are broken too
+		if parentDevice.status == UNHEALTHY {
+			newTenantDevice.Health = pluginapi.Unhealthy
+			newTenantDevice.setStatus(UNHEALTHY)
 		}
+		newTenantDevice.parent = parentDevice
+		log.WithFields(log.Fields{
+			"Plugin": childPlugin.fullName(),
+			"ID":     newTenantDevice.ID,
+		}).Info("Found tenant device")
+		parentDevice.children = append(parentDevice.children, newTenantDevice)
+		// Add it to plugin
+		childPlugin.devices = append(childPlugin.devices, newTenantDevice)
+		childPlugin.deviceCount++
 	}
 }
 
-// This is unused now, but will be useful in the case of multi FPGAs connected through PCIe
 // Check if a plugin for this FPGA type has already been created, and return it if found
 func havePlugin(vendorName string, boardName string, plugins []*FPGADevicePlugin) int {
 	found := -1
@@ -187,57 +262,110 @@ func havePlugin(vendorName string, boardName string, plugins []*FPGADevicePlugin
 }
 
 // Create all devices, this searches the system for all connected FPGAs
-// and constructs all of them
-// TODO: Right now, this only works for MPSoCs that have device trees
-// overlayes similar to those in `utils/`. Need to add support for PCIe
-// connected FPGAs.
-func getAllDevices() ([]*FPGADevicePlugin, []*FPGATenantDevicePlugin) {
+// through the given backends and constructs all of them
+func getAllDevices(backends []Backend, config *Config, aliases *DeviceAliases) ([]*FPGADevicePlugin, []*FPGATenantDevicePlugin) {
 	var devicePlugins []*FPGADevicePlugin
 	var tenantDevicePlugins []*FPGATenantDevicePlugin
-	// We expect SoC FPGAs info to be at `/proc/device-tree/fpga-full/`
-	// according to the sample device trees in `utils`.
-	if _, err := os.Stat("/work/device-tree/fpga-full"); err == nil {
-		// FPGA exists, try getting the vendor and board info
-		dat1, err := ioutil.ReadFile("/work/device-tree/vendor")
-		if err != nil {
-			log.WithFields(log.Fields{
-				"Error": err,
-			}).Warn("Could not read FPGA Info. Did you install the device tree overlay?")
-			return devicePlugins, tenantDevicePlugins
+	return discoverDevices(backends, config, aliases, devicePlugins, tenantDevicePlugins)
+}
+
+// Check if the FPGA with the given stable ID was already found
+func haveDevice(stableID string, plugins []*FPGADevicePlugin) bool {
+	for _, plugin := range plugins {
+		for _, device := range plugin.devices {
+			if device.stableID == stableID {
+				return true
+			}
 		}
-		dat2, err := ioutil.ReadFile("/work/device-tree/board")
-		if err != nil {
+	}
+	return false
+}
+
+// Ask every backend for its FPGAs, and add those we don't know yet to the
+// given plugins. A plugin is created once per board type, and a device for
+// every FPGA of that type.
+func discoverDevices(backends []Backend, config *Config, aliases *DeviceAliases, devicePlugins []*FPGADevicePlugin, tenantDevicePlugins []*FPGATenantDevicePlugin) ([]*FPGADevicePlugin, []*FPGATenantDevicePlugin) {
+	return addDiscovered(discoverFPGAs(backends, config), config, aliases, devicePlugins, tenantDevicePlugins)
+}
+
+// Ask every backend for its FPGAs, skipping those that don't match the config
+// of their board. This doesn't touch any plugin, so it can be done without
+// their locks while backends search the system.
+func discoverFPGAs(backends []Backend, config *Config) []*DiscoveredFPGA {
+	var fpgas []*DiscoveredFPGA
+	for _, backend := range backends {
+		for _, found := range backend.Discover() {
+			found.device.backend = backend
+			if err := checkBoard(found.device, config.board(found.vendorName, found.boardName)); err != nil {
+				log.WithFields(log.Fields{
+					"ID":    join_strings(found.vendorName, "/", found.boardName, "-", found.identity),
+					"Error": err,
+				}).Error("Skipping FPGA that doesn't match the config of its board.")
+				continue
+			}
+			fpgas = append(fpgas, found)
+		}
+	}
+	return fpgas
+}
+
+// Add the discovered FPGAs we don't know yet to the given plugins, creating
+// the plugins that don't exist yet. Must be called with the plugin mutexes
+// held.
+func addDiscovered(fpgas []*DiscoveredFPGA, config *Config, aliases *DeviceAliases, devicePlugins []*FPGADevicePlugin, tenantDevicePlugins []*FPGATenantDevicePlugin) ([]*FPGADevicePlugin, []*FPGATenantDevicePlugin) {
+	for _, found := range fpgas {
+		stableID := join_strings(found.vendorName, "/", found.boardName, "-", found.identity)
+		if haveDevice(stableID, devicePlugins) {
+			continue
+		}
+		var devicePlugin *FPGADevicePlugin
+		index := havePlugin(found.vendorName, found.boardName, devicePlugins)
+		if index == -1 {
+			devicePlugin = NewFPGADevicePlugin(found.vendorName, found.boardName, config)
+			devicePlugin.aliases = aliases
+			devicePlugins = append(devicePlugins, devicePlugin)
+			tenantDevicePlugins = append(tenantDevicePlugins, NewFPGATenantDevicePlugins(devicePlugin, config)...)
 			log.WithFields(log.Fields{
-				"Error": err,
-			}).Warn("Could not read FPGA Info. Did you install the device tree overlay?")
-			return devicePlugins, tenantDevicePlugins
+				"Vendor":  found.vendorName,
+				"Board":   found.boardName,
+				"Backend": found.device.backend.Name(),
+			}).Info("Found FPGAs connected.")
+		} else {
+			devicePlugin = devicePlugins[index]
 		}
-		vendorName := string(dat1)
-		vendorName = vendorName[:len(vendorName)-1]
-		boardName := string(dat2)
-		boardName = boardName[:len(boardName)-1]
-		// Now we can create the device plugin
-		// Note that in MPSoCs, there's typically one FPGA, so we don't need
-		// to check whether or not a device plugin has been created before.
-		newDevicePlugin := NewFPGADevicePlugin(vendorName, boardName)
-		devicePlugins = append(devicePlugins, newDevicePlugin)
-		log.WithFields(log.Fields{
-			"Vendor": vendorName,
-			"Board":  boardName,
-		}).Info("Found MPSoC FPGAs connected.")
-		// And the corresponding tenant device plugin
-		tenantDevicePlugins = append(tenantDevicePlugins, NewFPGATenantDevicePlugins(newDevicePlugin)...)
-		// Now we add the actual devices
-		addDevice(newDevicePlugin)
-	} else {
-		log.WithFields(log.Fields{
-			"Error": err,
-		}).Info("No MPSoC FPGA found.")
+		addDevice(devicePlugin, found)
 	}
-	// TODO: Check for PCIe connected FPGAs
 	return devicePlugins, tenantDevicePlugins
 }
 
+// Search the system again for FPGAs that were not there before, e.g. after
+// a PCIe rescan, and add them to their plugins, creating the plugins that
+// don't exist yet. FPGAs we already know are left alone. Returns all plugins
+// and the number of new FPGAs. The plugins must not be locked, they are only
+// locked once the backends are done searching.
+func rediscoverDevices(backends []Backend, config *Config, aliases *DeviceAliases, devicePlugins []*FPGADevicePlugin) ([]*FPGADevicePlugin, int) {
+	fpgas := discoverFPGAs(backends, config)
+	counts := make([]int, len(devicePlugins))
+	for index, plugin := range devicePlugins {
+		plugin.mutex.Lock()
+		counts[index] = len(plugin.devices)
+	}
+	var tenantDevicePlugins []*FPGATenantDevicePlugin
+	allPlugins, _ := addDiscovered(fpgas, config, aliases, devicePlugins, tenantDevicePlugins)
+	found := 0
+	for index, plugin := range devicePlugins {
+		if len(plugin.devices) != counts[index] {
+			found += len(plugin.devices) - counts[index]
+			plugin.notifier.notify()
+		}
+		plugin.mutex.Unlock()
+	}
+	for _, plugin := range allPlugins[len(devicePlugins):] {
+		found += len(plugin.devices)
+	}
+	return allPlugins, found
+}
+
 func (plugin *FPGADevicePlugin) deviceExists(id string) (bool, int) {
 	for index, device := range plugin.devices {
 		if device.ID == id {
@@ -256,721 +384,78 @@ func (plugin *FPGATenantDevicePlugin) deviceExists(id string) (bool, int) {
 	return false, -1
 }
 
-func (plugin *FPGADevicePlugin) availableDevices() []*pluginapi.Device {
-	var devices []*pluginapi.Device
-	for _, device := range plugin.devices {
-		if device.status == BLOCKED {
-			continue
-		}
-		devices = append(devices, &device.Device)
+func (plugin *FPGADevicePlugin) board() *FPGADevicePlugin {
+	return plugin
+}
+
+func (plugin *FPGATenantDevicePlugin) board() *FPGADevicePlugin {
+	return plugin.parentPlugin
+}
+
+func (plugin *FPGADevicePlugin) members() []managedDevice {
+	devices := make([]managedDevice, len(plugin.devices))
+	for index, device := range plugin.devices {
+		devices[index] = device
 	}
 	return devices
 }
 
-func (plugin *FPGATenantDevicePlugin) availableDevices() []*pluginapi.Device {
-	var devices []*pluginapi.Device
-	for _, device := range plugin.devices {
-		if device.status == BLOCKED {
-			continue
-		}
-		devices = append(devices, &device.Device)
+func (plugin *FPGATenantDevicePlugin) members() []managedDevice {
+	devices := make([]managedDevice, len(plugin.devices))
+	for index, device := range plugin.devices {
+		devices[index] = device
 	}
 	return devices
 }
 
-func (plugin *FPGADevicePlugin) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
-	return &pluginapi.DevicePluginOptions{
-		PreStartRequired:   true,
-		PostStopRequired:   true,
-		DeallocateRequired: true,
-	}, nil
+func (plugin *FPGADevicePlugin) configuredBitstream() string {
+	return plugin.bitstream
 }
 
-func (plugin *FPGATenantDevicePlugin) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
-	return &pluginapi.DevicePluginOptions{
-		PreStartRequired:   true,
-		PostStopRequired:   true,
-		DeallocateRequired: true,
-	}, nil
+func (plugin *FPGATenantDevicePlugin) configuredBitstream() string {
+	return plugin.bitstream
 }
 
+// Start serving the FPGAs, then their tenants
 func (plugin *FPGADevicePlugin) Start() error {
-	plugin.mutex.Lock()
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-		"Socket":   plugin.socketName(),
-	}).Info("Starting plugin server.")
-
-	// Create the server
-	plugin.server = grpc.NewServer([]grpc.ServerOption{}...)
-	// Register the server
-	sock, err := net.Listen("unix", plugin.socketName())
-	if err != nil {
-		plugin.server = nil
-		log.WithFields(log.Fields{
-			"Socket": plugin.socketName(),
-			"Error":  err,
-		}).Error("Cannot listen on socket.")
-		return err
-	}
-	pluginapi.RegisterDevicePluginServer(plugin.server, plugin)
-	// Start the server and make sure no errors
-	go func() {
-		lastCrashTime := time.Now()
-		restartCount := 0
-		for {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-			}).Info("Starting GRPC server")
-			err := plugin.server.Serve(sock)
-			if err == nil {
-				break
-			}
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"Error":    err,
-			}).Error("GRPC server crashed")
-
-			// restart if it has not been too often
-			// i.e. if server has crashed more than 5 times and it didn't last more than one hour each time
-			if restartCount > 5 {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"Error":    err,
-				}).Error("GRPC server has repeatedly crashed recently. Quitting")
-				break
-			}
-			timeSinceLastCrash := time.Since(lastCrashTime).Seconds()
-			lastCrashTime = time.Now()
-			if timeSinceLastCrash > 3600 {
-				// it has been one hour since the last crash.. reset the count
-				// to reflect on the frequency
-				restartCount = 1
-			} else {
-				restartCount += 1
-			}
-		}
-	}()
-
-	// Wait for server to start by launching a blocking connexion
-	conn, err := dial(plugin.socketName(), 5*time.Second)
-	if err != nil {
-		plugin.server = nil
-		log.WithFields(log.Fields{
-			"Socket": plugin.socketName(),
-			"Error":  err,
-		}).Error("Cannot dial socket.")
-		return err
-	}
-	conn.Close()
-
-	// Register our server with kubelet
-	conn, err = dial(pluginapi.KubeletSocket, 5*time.Second)
-	if err != nil {
-		plugin.server = nil
-		log.WithFields(log.Fields{
-			"Socket": plugin.socketName(),
-			"Error":  err,
-		}).Error("Cannot dial socket.")
-		return err
-	}
-	defer conn.Close()
-
-	client := pluginapi.NewRegistrationClient(conn)
-	reqt := &pluginapi.RegisterRequest{
-		Version:      pluginapi.Version,
-		Endpoint:     path.Base(plugin.socketName()),
-		ResourceName: plugin.fullName(),
-		Options: &pluginapi.DevicePluginOptions{
-			PreStartRequired:   true,
-			PostStopRequired:   true,
-			DeallocateRequired: true,
-		},
-	}
-
-	_, err = client.Register(context.Background(), reqt)
+	plugin.mutex.RLock()
+	childPlugins := plugin.childPlugins
+	plugin.mutex.RUnlock()
+	err := plugin.server.Start()
 	if err != nil {
-		plugin.server = nil
-		log.WithFields(log.Fields{
-			"Error": err,
-		}).Error("Cannot register client.")
 		return err
 	}
-
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-	}).Info("Successfully registered device plugin")
-
 	// Register children device plugins now
-	for _, childPlugin := range plugin.childPlugins {
+	for _, childPlugin := range childPlugins {
 		childPlugin.Start()
 	}
-	plugin.mutex.Unlock()
-
 	return nil
 }
 
 func (plugin *FPGATenantDevicePlugin) Start() error {
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-		"Socket":   plugin.socketName(),
-	}).Info("Starting plugin server.")
-	// Create the server
-	plugin.server = grpc.NewServer([]grpc.ServerOption{}...)
-	// Register the server
-	sock, err := net.Listen("unix", plugin.socketName())
-	if err != nil {
-		plugin.server = nil
-		log.WithFields(log.Fields{
-			"Socket": plugin.socketName(),
-			"Error":  err,
-		}).Error("Cannot listen on socket.")
-		return err
-	}
-	pluginapi.RegisterDevicePluginServer(plugin.server, plugin)
-	// Start the server and make sure no errors
-	go func() {
-		lastCrashTime := time.Now()
-		restartCount := 0
-		for {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-			}).Info("Starting GRPC server")
-			err := plugin.server.Serve(sock)
-			if err == nil {
-				break
-			}
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"Error":    err,
-			}).Error("GRPC server crashed")
-
-			// restart if it has not been too often
-			// i.e. if server has crashed more than 5 times and it didn't last more than one hour each time
-			if restartCount > 5 {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"Error":    err,
-				}).Error("GRPC server has repeatedly crashed recently. Quitting")
-				break
-			}
-			timeSinceLastCrash := time.Since(lastCrashTime).Seconds()
-			lastCrashTime = time.Now()
-			if timeSinceLastCrash > 3600 {
-				// it has been one hour since the last crash.. reset the count
-				// to reflect on the frequency
-				restartCount = 1
-			} else {
-				restartCount += 1
-			}
-		}
-	}()
-
-	// Wait for server to start by launching a blocking connexion
-	conn, err := dial(plugin.socketName(), 5*time.Second)
-	if err != nil {
-		plugin.server = nil
-		log.WithFields(log.Fields{
-			"Socket": plugin.socketName(),
-			"Error":  err,
-		}).Error("Cannot dial socket.")
-		return err
-	}
-	conn.Close()
-
-	// Register our server with kubelet
-	conn, err = dial(pluginapi.KubeletSocket, 5*time.Second)
-	if err != nil {
-		plugin.server = nil
-		log.WithFields(log.Fields{
-			"Socket": plugin.socketName(),
-			"Error":  err,
-		}).Error("Cannot dial socket.")
-		return err
-	}
-	defer conn.Close()
-
-	client := pluginapi.NewRegistrationClient(conn)
-	reqt := &pluginapi.RegisterRequest{
-		Version:      pluginapi.Version,
-		Endpoint:     path.Base(plugin.socketName()),
-		ResourceName: plugin.fullName(),
-		Options: &pluginapi.DevicePluginOptions{
-			PreStartRequired:   true,
-			PostStopRequired:   true,
-			DeallocateRequired: true,
-		},
-	}
-
-	_, err = client.Register(context.Background(), reqt)
-	if err != nil {
-		plugin.server = nil
-		log.WithFields(log.Fields{
-			"Error": err,
-		}).Error("Cannot register client.")
-		return err
-	}
-
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-	}).Info("Successfully registered device plugin")
-
-	return nil
+	return plugin.server.Start()
 }
 
-// Stop the gRPC server.
+// Stop serving the FPGAs and their tenants
 func (plugin *FPGADevicePlugin) Stop() error {
-	// Lock the mutex
-	plugin.mutex.Lock()
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-		"Socket":   plugin.socketName(),
-	}).Info("Stopping plugin server.")
-	var err error
-	err = nil
 	if plugin == nil {
-		log.Fatal("Attempting to stop a non existing plugin server")
-		err = errors.New("Attempting to stop a non existing plugin server")
-		plugin.mutex.Unlock()
-		return err
-	}
-	if plugin.server == nil {
-		log.Info("Plugin already stopped")
-		plugin.mutex.Unlock()
-		return nil
-	}
-	// Stop the server
-	plugin.server.Stop()
-	plugin.server = nil
-	// Remove the socket
-	if err = os.Remove(plugin.socketName()); err != nil && !os.IsNotExist(err) {
-		log.WithFields(log.Fields{
-			"Socket": plugin.socketName(),
-			"Error":  err,
-		}).Error("Failed to remove socket")
-	} else {
-		err = nil
+		log.Error("Attempting to stop a non existing plugin server")
+		return errors.New("Attempting to stop a non existing plugin server")
 	}
+	plugin.mutex.RLock()
+	childPlugins := plugin.childPlugins
+	plugin.mutex.RUnlock()
+	err := plugin.server.Stop()
 	// Stop tenant plugin servers
-	for _, childPlugin := range plugin.childPlugins {
+	for _, childPlugin := range childPlugins {
 		childPlugin.Stop()
 	}
-	// Stop all FPGAs and reset their status
-	for _, device := range plugin.devices {
-		if device.status == USED || device.status == BLOCKED {
-			err = device.Reset()
-			if err != nil {
-				device.SetUnhealthy()
-				log.WithFields(log.Fields{
-					"ID":    device.ID,
-					"Error": err,
-				}).Error("Failed to clear FPGA device. Device is now unhealthy")
-			} else {
-				device.SetFree()
-			}
-		}
-		// UNHEALTHY devices remain unhealthy
-		// FREE devices require no action
-	}
-
-	// Unlock the mutex
-	plugin.mutex.Unlock()
+	// Devices keep their status, the containers using them may still be
+	// running. It is in the checkpoint for when we start again.
 	return err
 }
 
-// Stop the gRPC server.
+// Stop serving the tenants, which keep their status like their FPGAs
 func (plugin *FPGATenantDevicePlugin) Stop() error {
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-		"Socket":   plugin.socketName(),
-	}).Info("Stopping plugin server.")
-	var err error
-	err = nil
-	if plugin == nil {
-		log.Fatal("Attempting to stop a non existing plugin server")
-		err = errors.New("Attempting to stop a non existing plugin server")
-		return err
-	}
-	if plugin.server == nil {
-		log.Info("Plugin already stopped")
-		return nil
-	}
-	// Stop the server
-	plugin.server.Stop()
-	plugin.server = nil
-	// Remove the socket
-	if err = os.Remove(plugin.socketName()); err != nil && !os.IsNotExist(err) {
-		log.WithFields(log.Fields{
-			"Socket": plugin.socketName(),
-			"Error":  err,
-		}).Error("Failed to remove socket")
-	} else {
-		err = nil
-	}
-	// We don't need to stop PR tenants, parent already wiped FPGAs clean
-	return err
-}
-
-// dial establishes the gRPC communication with the registered device plugin.
-func dial(unixSocketPath string, timeout time.Duration) (*grpc.ClientConn, error) {
-	c, err := grpc.Dial(unixSocketPath, grpc.WithInsecure(), grpc.WithBlock(),
-		grpc.WithTimeout(timeout),
-		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
-			return net.DialTimeout("unix", addr, timeout)
-		}),
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return c, nil
-}
-
-// Allocate entire FPGAs, disabling partial FPGA tenancy in the process.
-func (plugin *FPGADevicePlugin) Allocate(ctx context.Context, reqs *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
-	plugin.mutex.Lock()
-	responses := pluginapi.AllocateResponse{}
-	for _, req := range reqs.ContainerRequests {
-		var deviceMounts []*pluginapi.Mount
-		log.WithFields(log.Fields{
-			"Resource": plugin.fullName(),
-			"IDs":      req.DevicesIDs,
-		}).Info("FPGAs requested for allocation")
-		for _, id := range req.DevicesIDs {
-			exists, index := plugin.deviceExists(id)
-			if !exists {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-				}).Error("Invalid allocation request. Resource doesn't exist")
-				plugin.mutex.Unlock()
-				return nil, fmt.Errorf("invalid allocation request for unavailable resource '%s': unknown device: %s", plugin.fullName(), id)
-			}
-			if plugin.devices[index].status != FREE {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-					"Status":   plugin.devices[index].status,
-				}).Error("Invalid allocation request. Resource is busy")
-				plugin.mutex.Unlock()
-				return nil, fmt.Errorf("invalid allocation request for busy resource '%s': unknown device: %s", plugin.fullName(), id)
-			}
-			deviceMount := &pluginapi.Mount{
-				ContainerPath: "/sys/devices/platform/pcap/fpga_manager/fpga0",
-				HostPath:      "/sys/devices/platform/pcap/fpga_manager/fpga0",
-				ReadOnly:      false,
-			}
-			deviceMounts = append(deviceMounts, deviceMount)
-		}
-
-		response := pluginapi.ContainerAllocateResponse{
-			Mounts: deviceMounts,
-		}
-
-		responses.ContainerResponses = append(responses.ContainerResponses, &response)
-	}
-
-	// If we are here, it means the request didn't have any errors, we can start killing off the FPGA tenants to
-	// be able to serve FPGAs.
-	for _, req := range reqs.ContainerRequests {
-		for _, id := range req.DevicesIDs {
-			exists, index := plugin.deviceExists(id)
-			if !exists {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-				}).Fatal("Possible race condition, device should exist")
-				plugin.mutex.Unlock()
-				os.Exit(2)
-			}
-			plugin.devices[index].SetUsed()
-		}
-	}
-
-	plugin.mutex.Unlock()
-	return &responses, nil
-}
-
-// Allocate FPGA tenants, disabling entire FPGA allocation in the process.
-func (plugin *FPGATenantDevicePlugin) Allocate(ctx context.Context, reqs *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
-	plugin.parentPlugin.mutex.Lock()
-	responses := pluginapi.AllocateResponse{}
-	for _, req := range reqs.ContainerRequests {
-		log.WithFields(log.Fields{
-			"Resource": plugin.fullName(),
-			"IDs":      req.DevicesIDs,
-		}).Info("FPGA tenants requested for allocation")
-		for _, id := range req.DevicesIDs {
-			exists, index := plugin.deviceExists(id)
-			if !exists {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-				}).Error("Invalid allocation request. Resource doesn't exist")
-				plugin.parentPlugin.mutex.Unlock()
-				return nil, fmt.Errorf("invalid allocation request for unavailable resource '%s': unknown device: %s", plugin.fullName(), id)
-			}
-			if plugin.devices[index].status != FREE {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-					"Status":   plugin.devices[index].status,
-				}).Error("Invalid allocation request. Resource is busy")
-				plugin.parentPlugin.mutex.Unlock()
-				return nil, fmt.Errorf("invalid allocation request for busy resource '%s': unknown device: %s", plugin.fullName(), id)
-			}
-		}
-
-		response := pluginapi.ContainerAllocateResponse{
-			// TODO: Fill this up
-		}
-
-		responses.ContainerResponses = append(responses.ContainerResponses, &response)
-	}
-
-	// If we are here, it means the request didn't have any errors, we can start killing off the FPGA tenants to
-	// be able to serve FPGAs.
-	for _, req := range reqs.ContainerRequests {
-		for _, id := range req.DevicesIDs {
-			exists, index := plugin.deviceExists(id)
-			if !exists {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-				}).Fatal("Possible race condition, device should exist")
-				plugin.parentPlugin.mutex.Unlock()
-				os.Exit(2)
-			}
-			plugin.devices[index].SetUsed()
-		}
-	}
-
-	plugin.parentPlugin.mutex.Unlock()
-	return &responses, nil
-}
-
-func (plugin *FPGADevicePlugin) PreStartContainer(ctx context.Context, req *pluginapi.PreStartContainerRequest) (*pluginapi.PreStartContainerResponse, error) {
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-		"IDs":      req.DevicesIDs,
-	}).Info("FPGAs PreStartContainer Requested")
-	plugin.mutex.RLock()
-	for _, id := range req.DevicesIDs {
-		exists, index := plugin.deviceExists(id)
-		if !exists {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"ID":       id,
-			}).Error("Invalid PreStartContainer request. Resource doesn't exist")
-			plugin.mutex.RUnlock()
-			return nil, fmt.Errorf("invalid PreStartContainer request for unavailable resource '%s': unknown device: %s", plugin.fullName(), id)
-		}
-		if plugin.devices[index].status != USED {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"ID":       id,
-				"Status":   plugin.devices[index].status,
-			}).Error("Invalid PreStartContainer request. Resource is not used")
-			plugin.mutex.RUnlock()
-			return nil, fmt.Errorf("invalid PreStartContainer request for unused resource '%s': unknown device: %s", plugin.fullName(), id)
-		}
-		// TODO: Should reset and cleanup the FPGA here
-	}
-	plugin.mutex.RUnlock()
-	return &pluginapi.PreStartContainerResponse{}, nil
-}
-
-func (plugin *FPGATenantDevicePlugin) PreStartContainer(ctx context.Context, req *pluginapi.PreStartContainerRequest) (*pluginapi.PreStartContainerResponse, error) {
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-		"IDs":      req.DevicesIDs,
-	}).Info("FPGA tenants PreStartContainer Requested")
-	plugin.parentPlugin.mutex.RLock()
-	for _, id := range req.DevicesIDs {
-		exists, index := plugin.deviceExists(id)
-		if !exists {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"ID":       id,
-			}).Error("Invalid PreStartContainer request. Resource doesn't exist")
-			plugin.parentPlugin.mutex.RUnlock()
-			return nil, fmt.Errorf("invalid PreStartContainer request for unavailable resource '%s': unknown device: %s", plugin.fullName(), id)
-		}
-		if plugin.devices[index].status != USED {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"ID":       id,
-				"Status":   plugin.devices[index].status,
-			}).Error("Invalid PreStartContainer request. Resource is not used")
-			plugin.parentPlugin.mutex.RUnlock()
-			return nil, fmt.Errorf("invalid PreStartContainer request for unused resource '%s': unknown device: %s", plugin.fullName(), id)
-		}
-		// TODO: Should reset and cleanup the FPGA here
-	}
-	plugin.parentPlugin.mutex.RUnlock()
-	return &pluginapi.PreStartContainerResponse{}, nil
-}
-
-func (plugin *FPGADevicePlugin) PostStopContainer(ctx context.Context, req *pluginapi.PostStopContainerRequest) (*pluginapi.Empty, error) {
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-		"IDs":      req.DevicesIDs,
-	}).Info("FPGAs PostStopContainer Requested")
-	plugin.mutex.RLock()
-	for _, id := range req.DevicesIDs {
-		exists, index := plugin.deviceExists(id)
-		if !exists {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"ID":       id,
-			}).Error("Invalid PostStopContainer request. Resource doesn't exist")
-		}
-		if plugin.devices[index].status != USED {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"ID":       id,
-				"Status":   plugin.devices[index].status,
-			}).Error("Invalid PostStopContainer request. Resource is not used")
-		}
-		// TODO: Should reset and cleanup the FPGA here
-	}
-	plugin.mutex.RUnlock()
-	return nil, nil
-}
-
-func (plugin *FPGATenantDevicePlugin) PostStopContainer(ctx context.Context, req *pluginapi.PostStopContainerRequest) (*pluginapi.Empty, error) {
-	log.WithFields(log.Fields{
-		"Resource": plugin.fullName(),
-		"IDs":      req.DevicesIDs,
-	}).Info("FPGA tenants PostStopContainer Requested")
-	plugin.parentPlugin.mutex.RLock()
-	for _, id := range req.DevicesIDs {
-		exists, index := plugin.deviceExists(id)
-		if !exists {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"ID":       id,
-			}).Error("Invalid PostStopContainer request. Resource doesn't exist")
-		}
-		if plugin.devices[index].status != USED {
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-				"ID":       id,
-				"Status":   plugin.devices[index].status,
-			}).Error("Invalid PostStopContainer request. Resource is not used")
-		}
-		// TODO: Should reset and cleanup the FPGA here
-	}
-	plugin.parentPlugin.mutex.RUnlock()
-	return nil, nil
-}
-
-//	Deallocate entire FPGAs, enabling partial FPGA tenancy in the process.
-func (plugin *FPGADevicePlugin) Deallocate(ctx context.Context, reqs *pluginapi.DeallocateRequest) (*pluginapi.Empty, error) {
-	plugin.mutex.Lock()
-	for _, req := range reqs.ContainerRequests {
-		log.WithFields(log.Fields{
-			"Resource": plugin.fullName(),
-			"IDs":      req.DevicesIDs,
-		}).Info("FPGAs deallocation requested")
-		for _, id := range req.DevicesIDs {
-			exists, index := plugin.deviceExists(id)
-			if !exists {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-				}).Error("Invalid deallocation request. Resource doesn't exist")
-			}
-			if plugin.devices[index].status != USED {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-					"Status":   plugin.devices[index].status,
-				}).Error("Invalid deallocation request. Resource is not busy")
-			}
-			plugin.devices[index].SetFree()
-		}
-	}
-	plugin.mutex.Unlock()
-	return nil, nil
-}
-
-// Deallocate FPGA tenants, enabling entire FPGA allocation in the process.
-func (plugin *FPGATenantDevicePlugin) Deallocate(ctx context.Context, reqs *pluginapi.DeallocateRequest) (*pluginapi.Empty, error) {
-	plugin.parentPlugin.mutex.Lock()
-	for _, req := range reqs.ContainerRequests {
-		log.WithFields(log.Fields{
-			"Resource": plugin.fullName(),
-			"IDs":      req.DevicesIDs,
-		}).Info("FPGA tenants deallocation requested")
-		for _, id := range req.DevicesIDs {
-			exists, index := plugin.deviceExists(id)
-			if !exists {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-				}).Error("Invalid deallocation request. Resource doesn't exist")
-			}
-			if plugin.devices[index].status != USED {
-				log.WithFields(log.Fields{
-					"Resource": plugin.fullName(),
-					"ID":       id,
-					"Status":   plugin.devices[index].status,
-				}).Error("Invalid deallocation request. Resource is not busy")
-			}
-			plugin.devices[index].SetFree()
-		}
-	}
-
-	plugin.parentPlugin.mutex.Unlock()
-	return nil, nil
-}
-
-func (plugin *FPGADevicePlugin) ListAndWatch(e *pluginapi.Empty, s pluginapi.DevicePlugin_ListAndWatchServer) error {
-	for {
-		// Loop forever and check
-		plugin.mutex.RLock()
-		availableDevices := plugin.availableDevices()
-		// If the list of available devices has changed, send a message.
-		if !check_array_equality(availableDevices, plugin.oldDevices) {
-			s.Send(&pluginapi.ListAndWatchResponse{Devices: availableDevices})
-			// and update old list
-			plugin.oldDevices = availableDevices
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-			}).Debug("Change in available FPGA devices")
-			for _, device := range availableDevices {
-				log.WithFields(log.Fields{
-					"ID": device.ID,
-				}).Debug("Available FPGA device")
-			}
-		}
-		plugin.mutex.RUnlock()
-	}
-	return nil
-}
-
-func (plugin *FPGATenantDevicePlugin) ListAndWatch(e *pluginapi.Empty, s pluginapi.DevicePlugin_ListAndWatchServer) error {
-	for {
-		// Loop forever and check
-		plugin.parentPlugin.mutex.RLock()
-		availableDevices := plugin.availableDevices()
-		// If the list of available devices has changed, send a message.
-		if !check_array_equality(availableDevices, plugin.oldDevices) {
-			s.Send(&pluginapi.ListAndWatchResponse{Devices: availableDevices})
-			// and update old list
-			plugin.oldDevices = availableDevices
-			log.WithFields(log.Fields{
-				"Resource": plugin.fullName(),
-			}).Debug("Change in available FPGA tenant devices")
-			for _, device := range availableDevices {
-				log.WithFields(log.Fields{
-					"ID": device.ID,
-				}).Debug("Available FPGA tenant device")
-			}
-		}
-		plugin.parentPlugin.mutex.RUnlock()
-	}
-	return nil
+	return plugin.server.Stop()
 }
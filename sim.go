@@ -0,0 +1,192 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Set in the containers of simulated FPGAs, so that workloads know there is
+// no hardware behind them. Like other lists it has one entry per device,
+// `true` for every one.
+const ENV_SIMULATED string = "FPGA_SIMULATED"
+
+func init() {
+	registerBackend("sim", newSimBackend)
+}
+
+// What is loaded into a simulated FPGA
+type simFPGA struct {
+	// The bitstream of the entire FPGA, empty if none was programmed yet
+	bitstream string
+	// The partial bitstreams of its PR regions
+	regions map[Region]string
+}
+
+// Pretends the boards of the `simulated` section of the config are connected,
+// so the plugin can run where there are no FPGAs, e.g. in kind or CI.
+// Nothing is programmed or wiped, the bitstreams are only remembered, after
+// waiting for the configured latency and failing at the configured rate.
+// Changes to the simulated boards only take effect on restart.
+type simBackend struct {
+	boards []SimulatedBoardConfig
+	fpgas  map[*FPGADevice]*simFPGA
+	random *rand.Rand
+	mutex  sync.Mutex
+}
+
+func newSimBackend(options *BackendOptions) (Backend, error) {
+	if options.Config == nil || len(options.Config.Simulated) == 0 {
+		return nil, errors.New("no simulated boards in the config")
+	}
+	return &simBackend{
+		boards: options.Config.Simulated,
+		fpgas:  make(map[*FPGADevice]*simFPGA),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+func (backend *simBackend) Name() string {
+	return "sim"
+}
+
+func (backend *simBackend) Discover() []*DiscoveredFPGA {
+	var found []*DiscoveredFPGA
+	for _, board := range backend.boards {
+		for index := 0; index < board.Count; index++ {
+			found = append(found, &DiscoveredFPGA{
+				vendorName: board.Vendor,
+				boardName:  board.Board,
+				identity:   simIdentity(index),
+				device:     &FPGADevice{},
+			})
+		}
+	}
+	return found
+}
+
+// The config of the simulated board an FPGA belongs to
+func (backend *simBackend) board(device *FPGADevice) *SimulatedBoardConfig {
+	for index, board := range backend.boards {
+		if device.resource == join_strings(board.Vendor, "/", board.Board) {
+			return &backend.boards[index]
+		}
+	}
+	return &SimulatedBoardConfig{}
+}
+
+func (backend *simBackend) fpga(device *FPGADevice) *simFPGA {
+	fpga, ok := backend.fpgas[device]
+	if !ok {
+		fpga = &simFPGA{regions: make(map[Region]string)}
+		backend.fpgas[device] = fpga
+	}
+	return fpga
+}
+
+// Wait for the latency of an operation, giving up at the deadline, and
+// decide whether it failed
+func (backend *simBackend) simulate(latency time.Duration, failureRate float64, deadline time.Time) error {
+	if !deadline.IsZero() && time.Now().Add(latency).After(deadline) {
+		time.Sleep(time.Until(deadline))
+		return fmt.Errorf("timed out after %v", latency)
+	}
+	time.Sleep(latency)
+	backend.mutex.Lock()
+	failed := backend.random.Float64() < failureRate
+	backend.mutex.Unlock()
+	if failed {
+		return errors.New("simulated failure")
+	}
+	return nil
+}
+
+// Remember what was loaded into an FPGA or one of its PR regions. Loading
+// the entire FPGA replaces its PR regions too.
+func (backend *simBackend) load(device *FPGADevice, region Region, bitstream string) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	fpga := backend.fpga(device)
+	if region == WHOLE_FPGA {
+		fpga.bitstream = bitstream
+		fpga.regions = make(map[Region]string)
+	} else {
+		fpga.regions[region] = bitstream
+	}
+	log.WithFields(log.Fields{
+		"ID":        device.ID,
+		"Region":    region.String(),
+		"Bitstream": bitstream,
+	}).Debug("Loaded simulated bitstream")
+}
+
+func (backend *simBackend) Program(device *FPGADevice, region Region, bitstream string, deadline time.Time) error {
+	board := backend.board(device)
+	err := backend.simulate(board.ProgramLatency, board.ProgramFailureRate, deadline)
+	if err != nil {
+		return err
+	}
+	backend.load(device, region, bitstream)
+	return nil
+}
+
+func (backend *simBackend) Reset(device *FPGADevice, region Region, blankBitstream string) error {
+	board := backend.board(device)
+	err := backend.simulate(board.ResetLatency, board.ResetFailureRate, time.Time{})
+	if err != nil {
+		return err
+	}
+	backend.load(device, region, blankBitstream)
+	return nil
+}
+
+// Simulated FPGAs never break on their own, but can still be taken out of
+// service through the admin API
+func (backend *simBackend) Health() []HealthProbe {
+	return nil
+}
+
+func (backend *simBackend) AllocateSpec(device *FPGADevice, region Region) *ContainerSpec {
+	return &ContainerSpec{
+		Envs: map[string]string{ENV_SIMULATED: "true"},
+	}
+}
+
+func (backend *simBackend) LoadedBitstream(device *FPGADevice, region Region) string {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	fpga, ok := backend.fpgas[device]
+	if !ok {
+		return ""
+	}
+	if region == WHOLE_FPGA {
+		return fpga.bitstream
+	}
+	return fpga.regions[region]
+}
+
+// The identity of the simulated FPGA with the given index on its board
+func simIdentity(index int) string {
+	return "sim-" + strconv.Itoa(index)
+}
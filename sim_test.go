@@ -0,0 +1,70 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Tenants of different classes with the same region index have their own
+// PR regions, and programming the entire FPGA replaces them all
+func TestSimRegionsByClass(t *testing.T) {
+	plugin := newSimPlugins(t, simConfig(1, TenantConfig{Name: "small", Count: 2}, TenantConfig{Name: "large", Count: 1}))[0]
+	device := plugin.devices[0]
+	reporter := device.backend.(BitstreamReporter)
+	steps := []struct {
+		region    Region
+		bitstream string
+	}{
+		{Region{"small", 0}, "small-0.bin"},
+		{Region{"small", 1}, "small-1.bin"},
+		{Region{"large", 0}, "large-0.bin"},
+	}
+	for _, step := range steps {
+		if err := device.backend.Program(device, step.region, step.bitstream, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, step := range steps {
+		if loaded := reporter.LoadedBitstream(device, step.region); loaded != step.bitstream {
+			t.Errorf("%s has %q loaded, want %q", step.region, loaded, step.bitstream)
+		}
+	}
+	// The admin API shows each tenant its own bitstream
+	loaded := map[Region]string{}
+	for _, step := range steps {
+		loaded[step.region] = step.bitstream
+	}
+	for index, tenant := range plugin.adminTree().Devices[0].Tenants {
+		want := loaded[device.children[index].backendRegion()]
+		if tenant.Bitstream != want {
+			t.Errorf("admin API shows %q loaded into %s, want %q", tenant.Bitstream, tenant.ID, want)
+		}
+	}
+	if err := device.backend.Program(device, WHOLE_FPGA, "entire.bin", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := reporter.LoadedBitstream(device, WHOLE_FPGA); loaded != "entire.bin" {
+		t.Errorf("FPGA has %q loaded, want %q", loaded, "entire.bin")
+	}
+	for _, step := range steps {
+		if loaded := reporter.LoadedBitstream(device, step.region); loaded != "" {
+			t.Errorf("%s still has %q loaded", step.region, loaded)
+		}
+	}
+}
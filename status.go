@@ -0,0 +1,84 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A small HTTP server reporting the state of the plugin itself, mostly
+// useful for debugging.
+type StatusServer struct {
+	address string
+	mux     *http.ServeMux
+	// Outcome of the last config reload, nil if no reload happened yet
+	lastReload *ReloadStatus
+	mutex      sync.RWMutex
+}
+
+func NewStatusServer(address string) *StatusServer {
+	server := &StatusServer{
+		address: address,
+		mux:     http.NewServeMux(),
+	}
+	server.mux.HandleFunc("/status", server.serveStatus)
+	return server
+}
+
+func (server *StatusServer) setReloadStatus(status *ReloadStatus) {
+	server.mutex.Lock()
+	server.lastReload = status
+	server.mutex.Unlock()
+}
+
+func (server *StatusServer) serveStatus(w http.ResponseWriter, r *http.Request) {
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		LastReload *ReloadStatus `json:"lastReload"`
+	}{
+		LastReload: server.lastReload,
+	})
+}
+
+func (server *StatusServer) Start() error {
+	sock, err := net.Listen("tcp", server.address)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Address": server.address,
+			"Error":   err,
+		}).Error("Cannot listen on status address.")
+		return err
+	}
+	go func() {
+		err := http.Serve(sock, server.mux)
+		log.WithFields(log.Fields{
+			"Address": server.address,
+			"Error":   err,
+		}).Error("Status server stopped")
+	}()
+	log.WithFields(log.Fields{
+		"Address": server.address,
+	}).Info("Started status server.")
+	return nil
+}
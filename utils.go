@@ -16,7 +16,14 @@
 
 package main
 
-import pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+)
 
 func join_strings(strs ...string) string {
 	var ret string
@@ -26,23 +33,107 @@ func join_strings(strs ...string) string {
 	return ret
 }
 
-// FIXME: Arrays are not that big for now, but we should improve
-// this
+// Write a file through a temporary file that is renamed into place, so a
+// crash never leaves a half written file behind
+func writeFileAtomic(filePath string, dat []byte) error {
+	dir := filepath.Dir(filePath)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(dat)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// Check whether two lists of devices advertise the same thing to kubelet,
+// regardless of their order. Devices are compared by value, so a device that
+// changes its health or topology makes the lists different.
 func check_array_equality(arr1, arr2 []*pluginapi.Device) bool {
 	if len(arr1) != len(arr2) {
 		return false
 	}
+	devices := make(map[string]*pluginapi.Device, len(arr2))
+	for _, element2 := range arr2 {
+		devices[element2.ID] = element2
+	}
 	for _, element1 := range arr1 {
-		found := false
-		for _, element2 := range arr2 {
-			if element1 == element2 {
-				found = true
-				break
-			}
+		element2, found := devices[element1.ID]
+		if !found || !check_device_equality(element1, element2) {
+			return false
 		}
-		if !found {
+	}
+	return true
+}
+
+func check_device_equality(device1, device2 *pluginapi.Device) bool {
+	if device1.ID != device2.ID || device1.Health != device2.Health {
+		return false
+	}
+	return check_topology_equality(device1.Topology, device2.Topology)
+}
+
+func check_topology_equality(topology1, topology2 *pluginapi.TopologyInfo) bool {
+	if topology1 == nil || topology2 == nil {
+		return topology1 == topology2
+	}
+	if len(topology1.Nodes) != len(topology2.Nodes) {
+		return false
+	}
+	for index, node1 := range topology1.Nodes {
+		node2 := topology2.Nodes[index]
+		if (node1 == nil) != (node2 == nil) {
+			return false
+		}
+		if node1 != nil && node1.ID != node2.ID {
 			return false
 		}
 	}
 	return true
 }
+
+// Broadcasts device changes to whoever is waiting on them, e.g. ListAndWatch
+// streams. Every waiter gets a channel that is closed on the next change, so
+// any number of waiters can be woken up at once.
+type deviceNotifier struct {
+	mutex   sync.Mutex
+	channel chan struct{}
+}
+
+func newDeviceNotifier() *deviceNotifier {
+	return &deviceNotifier{
+		channel: make(chan struct{}),
+	}
+}
+
+// Get a channel that is closed on the next change. Get it before reading the
+// devices, otherwise changes that happen in between are missed.
+func (notifier *deviceNotifier) wait() <-chan struct{} {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	return notifier.channel
+}
+
+// Wake up all waiters
+func (notifier *deviceNotifier) notify() {
+	if notifier == nil {
+		return
+	}
+	notifier.mutex.Lock()
+	close(notifier.channel)
+	notifier.channel = make(chan struct{})
+	notifier.mutex.Unlock()
+}
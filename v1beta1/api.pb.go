@@ -50,6 +50,8 @@ type DevicePluginOptions struct {
 	// Indicates if PreStartContainer call is required before each container start
 	PreStartRequired bool `protobuf:"varint,1,opt,name=pre_start_required,json=preStartRequired,proto3" json:"pre_start_required,omitempty"`
 	// Indicates if PostStopContainer call is required before each container start
+	// Upstream kubelets (1.19+) know this field as get_preferred_allocation_available,
+	// which indicates if GetPreferredAllocation is implemented and available for calling
 	PostStopRequired bool `protobuf:"varint,2,opt,name=post_stop_required,json=postStopRequired,proto3" json:"post_stop_required,omitempty"`
 	// Indicates if the Deallocate call is required before after each container death
 	DeallocateRequired   bool     `protobuf:"varint,3,opt,name=deallocate_required,json=deallocateRequired,proto3" json:"deallocate_required,omitempty"`
@@ -315,7 +317,7 @@ func (m *TopologyInfo) GetNodes() []*NUMANode {
 }
 
 type NUMANode struct {
-	ID                   int64    `protobuf:"varint,1,opt,name=ID,json=iD,proto3" json:"ID,omitempty"`
+	ID                   int64    `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
@@ -360,18 +362,19 @@ func (m *NUMANode) GetID() int64 {
 }
 
 // E.g:
-// struct Device {
-//    ID: "GPU-fef8089b-4820-abfc-e83e-94318197576e",
-//    Health: "Healthy",
-//    Topology:
-//      Node:
-//ID: 1
-//}
+//
+//	struct Device {
+//	   ID: "GPU-fef8089b-4820-abfc-e83e-94318197576e",
+//	   Health: "Healthy",
+//	   Topology:
+//	     Node:
+//	       ID: 1
+//	}
 type Device struct {
 	// A unique ID assigned by the device plugin used
 	// to identify devices during the communication
 	// Max length of this field is 63 characters
-	ID string `protobuf:"bytes,1,opt,name=ID,json=iD,proto3" json:"ID,omitempty"`
+	ID string `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
 	// Health of the device, can be healthy or unhealthy, see constants.go
 	Health string `protobuf:"bytes,2,opt,name=health,proto3" json:"health,omitempty"`
 	// Topology for device
@@ -433,10 +436,10 @@ func (m *Device) GetTopology() *TopologyInfo {
 	return nil
 }
 
-// - PreStartContainer is expected to be called before each container start if indicated by plugin during registration phase.
-// - PreStartContainer allows kubelet to pass reinitialized devices to containers.
-// - PreStartContainer allows Device Plugin to run device specific operations on
-//   the Devices requested
+//   - PreStartContainer is expected to be called before each container start if indicated by plugin during registration phase.
+//   - PreStartContainer allows kubelet to pass reinitialized devices to containers.
+//   - PreStartContainer allows Device Plugin to run device specific operations on
+//     the Devices requested
 type PreStartContainerRequest struct {
 	DevicesIDs           []string `protobuf:"bytes,1,rep,name=devicesIDs,proto3" json:"devicesIDs,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -520,9 +523,9 @@ func (m *PreStartContainerResponse) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_PreStartContainerResponse proto.InternalMessageInfo
 
-// - PostStopContainer is expected to be called after each container death if indicated by plugin during registration phase.
-// - PostStopContainer allows Device Plugin to run device specific operations on
-//   the Devices requested to clear/reset them
+//   - PostStopContainer is expected to be called after each container death if indicated by plugin during registration phase.
+//   - PostStopContainer allows Device Plugin to run device specific operations on
+//     the Devices requested to clear/reset them
 type PostStopContainerRequest struct {
 	DevicesIDs           []string `protobuf:"bytes,1,rep,name=devicesIDs,proto3" json:"devicesIDs,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -568,12 +571,218 @@ func (m *PostStopContainerRequest) GetDevicesIDs() []string {
 	return nil
 }
 
-// - Allocate is expected to be called during pod creation since allocation
-//   failures for any container would result in pod startup failure.
-// - Allocate allows kubelet to exposes additional artifacts in a pod's
-//   environment as directed by the plugin.
-// - Allocate allows Device Plugin to run device specific operations on
-//   the Devices requested
+// PreferredAllocationRequest is passed via a call to GetPreferredAllocation()
+// at pod admission time. The device plugin should take the list of
+// `available_deviceIDs` and calculate a preferred allocation of size
+// 'allocation_size' from them, making sure to include the set of devices
+// listed in 'must_include_deviceIDs'.
+type PreferredAllocationRequest struct {
+	ContainerRequests    []*ContainerPreferredAllocationRequest `protobuf:"bytes,1,rep,name=container_requests,json=containerRequests,proto3" json:"container_requests,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                               `json:"-"`
+	XXX_sizecache        int32                                  `json:"-"`
+}
+
+func (m *PreferredAllocationRequest) Reset()      { *m = PreferredAllocationRequest{} }
+func (*PreferredAllocationRequest) ProtoMessage() {}
+func (*PreferredAllocationRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{10}
+}
+func (m *PreferredAllocationRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *PreferredAllocationRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_PreferredAllocationRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *PreferredAllocationRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PreferredAllocationRequest.Merge(m, src)
+}
+func (m *PreferredAllocationRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *PreferredAllocationRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PreferredAllocationRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PreferredAllocationRequest proto.InternalMessageInfo
+
+func (m *PreferredAllocationRequest) GetContainerRequests() []*ContainerPreferredAllocationRequest {
+	if m != nil {
+		return m.ContainerRequests
+	}
+	return nil
+}
+
+type ContainerPreferredAllocationRequest struct {
+	// List of available deviceIDs from which to choose a preferred allocation
+	AvailableDeviceIDs []string `protobuf:"bytes,1,rep,name=available_deviceIDs,json=availableDeviceIDs,proto3" json:"available_deviceIDs,omitempty"`
+	// List of deviceIDs that must be included in the preferred allocation
+	MustIncludeDeviceIDs []string `protobuf:"bytes,2,rep,name=must_include_deviceIDs,json=mustIncludeDeviceIDs,proto3" json:"must_include_deviceIDs,omitempty"`
+	// Number of devices to include in the preferred allocation
+	AllocationSize       int32    `protobuf:"varint,3,opt,name=allocation_size,json=allocationSize,proto3" json:"allocation_size,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ContainerPreferredAllocationRequest) Reset()      { *m = ContainerPreferredAllocationRequest{} }
+func (*ContainerPreferredAllocationRequest) ProtoMessage() {}
+func (*ContainerPreferredAllocationRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{11}
+}
+func (m *ContainerPreferredAllocationRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ContainerPreferredAllocationRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ContainerPreferredAllocationRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ContainerPreferredAllocationRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ContainerPreferredAllocationRequest.Merge(m, src)
+}
+func (m *ContainerPreferredAllocationRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *ContainerPreferredAllocationRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ContainerPreferredAllocationRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ContainerPreferredAllocationRequest proto.InternalMessageInfo
+
+func (m *ContainerPreferredAllocationRequest) GetAvailableDeviceIDs() []string {
+	if m != nil {
+		return m.AvailableDeviceIDs
+	}
+	return nil
+}
+
+func (m *ContainerPreferredAllocationRequest) GetMustIncludeDeviceIDs() []string {
+	if m != nil {
+		return m.MustIncludeDeviceIDs
+	}
+	return nil
+}
+
+func (m *ContainerPreferredAllocationRequest) GetAllocationSize() int32 {
+	if m != nil {
+		return m.AllocationSize
+	}
+	return 0
+}
+
+// PreferredAllocationResponse returns a preferred allocation,
+// resulting from a PreferredAllocationRequest.
+type PreferredAllocationResponse struct {
+	ContainerResponses   []*ContainerPreferredAllocationResponse `protobuf:"bytes,1,rep,name=container_responses,json=containerResponses,proto3" json:"container_responses,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                                `json:"-"`
+	XXX_sizecache        int32                                   `json:"-"`
+}
+
+func (m *PreferredAllocationResponse) Reset()      { *m = PreferredAllocationResponse{} }
+func (*PreferredAllocationResponse) ProtoMessage() {}
+func (*PreferredAllocationResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{12}
+}
+func (m *PreferredAllocationResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *PreferredAllocationResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_PreferredAllocationResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *PreferredAllocationResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PreferredAllocationResponse.Merge(m, src)
+}
+func (m *PreferredAllocationResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *PreferredAllocationResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PreferredAllocationResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PreferredAllocationResponse proto.InternalMessageInfo
+
+func (m *PreferredAllocationResponse) GetContainerResponses() []*ContainerPreferredAllocationResponse {
+	if m != nil {
+		return m.ContainerResponses
+	}
+	return nil
+}
+
+type ContainerPreferredAllocationResponse struct {
+	DeviceIDs            []string `protobuf:"bytes,1,rep,name=deviceIDs,proto3" json:"deviceIDs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ContainerPreferredAllocationResponse) Reset()      { *m = ContainerPreferredAllocationResponse{} }
+func (*ContainerPreferredAllocationResponse) ProtoMessage() {}
+func (*ContainerPreferredAllocationResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{13}
+}
+func (m *ContainerPreferredAllocationResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ContainerPreferredAllocationResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ContainerPreferredAllocationResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ContainerPreferredAllocationResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ContainerPreferredAllocationResponse.Merge(m, src)
+}
+func (m *ContainerPreferredAllocationResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *ContainerPreferredAllocationResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ContainerPreferredAllocationResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ContainerPreferredAllocationResponse proto.InternalMessageInfo
+
+func (m *ContainerPreferredAllocationResponse) GetDeviceIDs() []string {
+	if m != nil {
+		return m.DeviceIDs
+	}
+	return nil
+}
+
+//   - Allocate is expected to be called during pod creation since allocation
+//     failures for any container would result in pod startup failure.
+//   - Allocate allows kubelet to exposes additional artifacts in a pod's
+//     environment as directed by the plugin.
+//   - Allocate allows Device Plugin to run device specific operations on
+//     the Devices requested
 type AllocateRequest struct {
 	ContainerRequests    []*ContainerAllocateRequest `protobuf:"bytes,1,rep,name=container_requests,json=containerRequests,proto3" json:"container_requests,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}                    `json:"-"`
@@ -583,7 +792,7 @@ type AllocateRequest struct {
 func (m *AllocateRequest) Reset()      { *m = AllocateRequest{} }
 func (*AllocateRequest) ProtoMessage() {}
 func (*AllocateRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_00212fb1f9d3bf1c, []int{10}
+	return fileDescriptor_00212fb1f9d3bf1c, []int{14}
 }
 func (m *AllocateRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -628,7 +837,7 @@ type ContainerAllocateRequest struct {
 func (m *ContainerAllocateRequest) Reset()      { *m = ContainerAllocateRequest{} }
 func (*ContainerAllocateRequest) ProtoMessage() {}
 func (*ContainerAllocateRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_00212fb1f9d3bf1c, []int{11}
+	return fileDescriptor_00212fb1f9d3bf1c, []int{15}
 }
 func (m *ContainerAllocateRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -681,7 +890,7 @@ type AllocateResponse struct {
 func (m *AllocateResponse) Reset()      { *m = AllocateResponse{} }
 func (*AllocateResponse) ProtoMessage() {}
 func (*AllocateResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_00212fb1f9d3bf1c, []int{12}
+	return fileDescriptor_00212fb1f9d3bf1c, []int{16}
 }
 func (m *AllocateResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -733,7 +942,7 @@ type ContainerAllocateResponse struct {
 func (m *ContainerAllocateResponse) Reset()      { *m = ContainerAllocateResponse{} }
 func (*ContainerAllocateResponse) ProtoMessage() {}
 func (*ContainerAllocateResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_00212fb1f9d3bf1c, []int{13}
+	return fileDescriptor_00212fb1f9d3bf1c, []int{17}
 }
 func (m *ContainerAllocateResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -790,11 +999,11 @@ func (m *ContainerAllocateResponse) GetAnnotations() map[string]string {
 	return nil
 }
 
-// - Deallocate allows Device Plugin to run device specific operations on
-//   the Devices requested
-// - Deallocate is useful for complex device plugins that need to track
-//   the allocation of their devices
-// - Deallocated
+//   - Deallocate allows Device Plugin to run device specific operations on
+//     the Devices requested
+//   - Deallocate is useful for complex device plugins that need to track
+//     the allocation of their devices
+//   - Deallocated
 type DeallocateRequest struct {
 	ContainerRequests    []*ContainerDeallocateRequest `protobuf:"bytes,1,rep,name=container_requests,json=containerRequests,proto3" json:"container_requests,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}                      `json:"-"`
@@ -804,7 +1013,7 @@ type DeallocateRequest struct {
 func (m *DeallocateRequest) Reset()      { *m = DeallocateRequest{} }
 func (*DeallocateRequest) ProtoMessage() {}
 func (*DeallocateRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_00212fb1f9d3bf1c, []int{14}
+	return fileDescriptor_00212fb1f9d3bf1c, []int{18}
 }
 func (m *DeallocateRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -849,7 +1058,7 @@ type ContainerDeallocateRequest struct {
 func (m *ContainerDeallocateRequest) Reset()      { *m = ContainerDeallocateRequest{} }
 func (*ContainerDeallocateRequest) ProtoMessage() {}
 func (*ContainerDeallocateRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_00212fb1f9d3bf1c, []int{15}
+	return fileDescriptor_00212fb1f9d3bf1c, []int{19}
 }
 func (m *ContainerDeallocateRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -901,7 +1110,7 @@ type Mount struct {
 func (m *Mount) Reset()      { *m = Mount{} }
 func (*Mount) ProtoMessage() {}
 func (*Mount) Descriptor() ([]byte, []int) {
-	return fileDescriptor_00212fb1f9d3bf1c, []int{16}
+	return fileDescriptor_00212fb1f9d3bf1c, []int{20}
 }
 func (m *Mount) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -969,7 +1178,7 @@ type DeviceSpec struct {
 func (m *DeviceSpec) Reset()      { *m = DeviceSpec{} }
 func (*DeviceSpec) ProtoMessage() {}
 func (*DeviceSpec) Descriptor() ([]byte, []int) {
-	return fileDescriptor_00212fb1f9d3bf1c, []int{17}
+	return fileDescriptor_00212fb1f9d3bf1c, []int{21}
 }
 func (m *DeviceSpec) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1030,6 +1239,10 @@ func init() {
 	proto.RegisterType((*PreStartContainerRequest)(nil), "v1beta1.PreStartContainerRequest")
 	proto.RegisterType((*PreStartContainerResponse)(nil), "v1beta1.PreStartContainerResponse")
 	proto.RegisterType((*PostStopContainerRequest)(nil), "v1beta1.PostStopContainerRequest")
+	proto.RegisterType((*PreferredAllocationRequest)(nil), "v1beta1.PreferredAllocationRequest")
+	proto.RegisterType((*ContainerPreferredAllocationRequest)(nil), "v1beta1.ContainerPreferredAllocationRequest")
+	proto.RegisterType((*PreferredAllocationResponse)(nil), "v1beta1.PreferredAllocationResponse")
+	proto.RegisterType((*ContainerPreferredAllocationResponse)(nil), "v1beta1.ContainerPreferredAllocationResponse")
 	proto.RegisterType((*AllocateRequest)(nil), "v1beta1.AllocateRequest")
 	proto.RegisterType((*ContainerAllocateRequest)(nil), "v1beta1.ContainerAllocateRequest")
 	proto.RegisterType((*AllocateResponse)(nil), "v1beta1.AllocateResponse")
@@ -1045,65 +1258,74 @@ func init() {
 func init() { proto.RegisterFile("api.proto", fileDescriptor_00212fb1f9d3bf1c) }
 
 var fileDescriptor_00212fb1f9d3bf1c = []byte{
-	// 920 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0x51, 0x6f, 0x1b, 0x45,
-	0x10, 0xf6, 0xd9, 0x4d, 0x6c, 0x8f, 0xdd, 0x24, 0x9e, 0x94, 0xca, 0xb9, 0x16, 0x2b, 0x5c, 0x05,
-	0x04, 0xa9, 0x75, 0x88, 0x2b, 0xb5, 0x28, 0x42, 0x08, 0x83, 0x03, 0x8d, 0x44, 0xd3, 0x68, 0x43,
-	0xc5, 0x0b, 0x92, 0x75, 0x39, 0x6f, 0xed, 0x13, 0xe7, 0xdd, 0xe3, 0x76, 0x6d, 0xc9, 0x6f, 0x3c,
-	0xf0, 0x03, 0xf8, 0x0d, 0x88, 0x5f, 0xc2, 0x53, 0x1f, 0x79, 0xe4, 0x91, 0x86, 0x3f, 0x82, 0x6e,
-	0x6f, 0xf7, 0xee, 0x38, 0xdb, 0x09, 0x95, 0x78, 0xbb, 0x9d, 0x99, 0x6f, 0x76, 0x66, 0xf6, 0x9b,
-	0x99, 0x83, 0xba, 0x1b, 0xfa, 0xdd, 0x30, 0xe2, 0x92, 0x63, 0x75, 0x7e, 0x74, 0x49, 0xa5, 0x7b,
-	0x64, 0x3f, 0x1a, 0xfb, 0x72, 0x32, 0xbb, 0xec, 0x7a, 0x7c, 0x7a, 0x38, 0xe6, 0x63, 0x7e, 0xa8,
-	0xf4, 0x97, 0xb3, 0x57, 0xea, 0xa4, 0x0e, 0xea, 0x2b, 0xc1, 0x39, 0xbf, 0x5a, 0xb0, 0x3b, 0xa0,
-	0x73, 0xdf, 0xa3, 0xe7, 0xc1, 0x6c, 0xec, 0xb3, 0x17, 0xa1, 0xf4, 0x39, 0x13, 0xf8, 0x10, 0x30,
-	0x8c, 0xe8, 0x50, 0x48, 0x37, 0x92, 0xc3, 0x88, 0xfe, 0x38, 0xf3, 0x23, 0x3a, 0x6a, 0x5b, 0xfb,
-	0xd6, 0x41, 0x8d, 0xec, 0x84, 0x11, 0xbd, 0x88, 0x15, 0x44, 0xcb, 0x95, 0x35, 0x17, 0x72, 0x28,
-	0x24, 0x0f, 0x33, 0xeb, 0xb2, 0xb6, 0xe6, 0x42, 0x5e, 0x48, 0x1e, 0xa6, 0xd6, 0x87, 0xb0, 0x3b,
-	0xa2, 0x6e, 0x10, 0x70, 0xcf, 0x95, 0x34, 0x33, 0xaf, 0x28, 0x73, 0xcc, 0x54, 0x06, 0xe0, 0xfc,
-	0x66, 0xc1, 0x36, 0xa1, 0x63, 0x5f, 0x48, 0x1a, 0xc5, 0x42, 0x2a, 0x24, 0xb6, 0xa1, 0x3a, 0xa7,
-	0x91, 0xf0, 0x39, 0x53, 0x51, 0xd5, 0x89, 0x39, 0xa2, 0x0d, 0x35, 0xca, 0x46, 0x21, 0xf7, 0x99,
-	0x54, 0x21, 0xd4, 0x49, 0x7a, 0xc6, 0x07, 0x70, 0x3b, 0xa2, 0x82, 0xcf, 0x22, 0x8f, 0x0e, 0x99,
-	0x3b, 0xa5, 0xea, 0xd2, 0x3a, 0x69, 0x1a, 0xe1, 0x99, 0x3b, 0xa5, 0xf8, 0x04, 0xaa, 0x3c, 0x29,
-	0x43, 0xfb, 0xd6, 0xbe, 0x75, 0xd0, 0xe8, 0xdd, 0xef, 0xea, 0xea, 0x76, 0x57, 0x94, 0x8a, 0x18,
-	0x63, 0xa7, 0x0a, 0x1b, 0x27, 0xd3, 0x50, 0x2e, 0x9c, 0x3e, 0xdc, 0xf9, 0xc6, 0x17, 0xb2, 0xcf,
-	0x46, 0xdf, 0xb9, 0xd2, 0x9b, 0x10, 0x2a, 0x42, 0xce, 0x04, 0xc5, 0x8f, 0xa0, 0x3a, 0x52, 0x0e,
-	0x44, 0xdb, 0xda, 0xaf, 0x1c, 0x34, 0x7a, 0xdb, 0x05, 0xc7, 0xc4, 0xe8, 0x9d, 0xa7, 0xd0, 0xfc,
-	0x96, 0x87, 0x3c, 0xe0, 0xe3, 0xc5, 0x29, 0x7b, 0xc5, 0xf1, 0x43, 0xd8, 0x60, 0x7c, 0x94, 0x02,
-	0x5b, 0x29, 0xf0, 0xec, 0xe5, 0xf3, 0xfe, 0x19, 0x1f, 0x51, 0x92, 0xe8, 0x1d, 0x1b, 0x6a, 0x46,
-	0x84, 0x5b, 0x50, 0x3e, 0x1d, 0xa8, 0xf2, 0x54, 0x48, 0xd9, 0x1f, 0x38, 0x1e, 0x6c, 0x26, 0xf7,
-	0xe4, 0x34, 0xf5, 0x58, 0x83, 0x77, 0x61, 0x73, 0x42, 0xdd, 0x40, 0x4e, 0x74, 0xc5, 0xf4, 0x09,
-	0x8f, 0xa0, 0x26, 0x75, 0x18, 0xaa, 0x54, 0x8d, 0xde, 0x3b, 0xe9, 0xcd, 0xf9, 0xf8, 0x48, 0x6a,
-	0xe6, 0x1c, 0x43, 0xfb, 0x5c, 0xf3, 0xe3, 0x4b, 0xce, 0xa4, 0xeb, 0xb3, 0xec, 0xd1, 0x3a, 0x00,
-	0x3a, 0xc1, 0xd3, 0x41, 0x92, 0x4a, 0x9d, 0xe4, 0x24, 0xce, 0x3d, 0xd8, 0x5b, 0x81, 0x4d, 0xaa,
-	0xa7, 0x1c, 0x6b, 0x2a, 0xbd, 0xb5, 0x63, 0x0f, 0xb6, 0xfb, 0x39, 0x56, 0xc5, 0x90, 0x73, 0x40,
-	0xcf, 0xb8, 0x51, 0x24, 0xa4, 0x42, 0x9a, 0xf2, 0xbe, 0x97, 0x26, 0x99, 0xde, 0x54, 0x80, 0x93,
-	0x96, 0x57, 0x88, 0x41, 0xc4, 0x01, 0xae, 0x33, 0xbf, 0x31, 0xc0, 0x31, 0xec, 0x64, 0x10, 0x4d,
-	0x97, 0x0b, 0xd8, 0xcd, 0x47, 0x98, 0x48, 0x4d, 0x88, 0xce, 0x75, 0x21, 0x26, 0xa6, 0x04, 0xbd,
-	0x62, 0x11, 0x85, 0xf3, 0x73, 0x05, 0xf6, 0xd6, 0x22, 0xf0, 0x73, 0xb8, 0x45, 0xd9, 0xdc, 0xdc,
-	0xf1, 0xf0, 0xe6, 0x3b, 0xba, 0x27, 0x6c, 0x2e, 0x4e, 0x98, 0x8c, 0x16, 0x44, 0x21, 0xf1, 0x03,
-	0xd8, 0x9c, 0xf2, 0x19, 0x93, 0xa2, 0x5d, 0x56, 0x3e, 0xb6, 0x52, 0x1f, 0xcf, 0x63, 0x31, 0xd1,
-	0x5a, 0x7c, 0x94, 0xf5, 0x42, 0x45, 0x19, 0xee, 0x16, 0x7a, 0xe1, 0x22, 0xa4, 0x5e, 0xda, 0x0f,
-	0xf8, 0x12, 0x1a, 0x2e, 0x63, 0x5c, 0xba, 0xa6, 0x2f, 0x63, 0xc8, 0xe3, 0xff, 0x10, 0x5f, 0x3f,
-	0x43, 0x25, 0x61, 0xe6, 0xfd, 0xd8, 0x4f, 0xa1, 0x9e, 0x26, 0x80, 0x3b, 0x50, 0xf9, 0x81, 0x2e,
-	0x74, 0x57, 0xc4, 0x9f, 0x78, 0x07, 0x36, 0xe6, 0x6e, 0x30, 0xa3, 0xba, 0x2b, 0x92, 0xc3, 0x71,
-	0xf9, 0x13, 0xcb, 0xfe, 0x0c, 0x76, 0x8a, 0x9e, 0xdf, 0x06, 0xef, 0x8c, 0xa1, 0x35, 0xf8, 0xd7,
-	0xa0, 0x8b, 0x49, 0x42, 0xae, 0xa1, 0xe4, 0x83, 0xe5, 0x5c, 0x97, 0x1c, 0xac, 0x22, 0xe5, 0xa7,
-	0x60, 0xaf, 0x07, 0xdc, 0x48, 0xcb, 0x09, 0x6c, 0xa8, 0x67, 0xc3, 0xf7, 0x61, 0x2b, 0x0b, 0x2d,
-	0x74, 0xe5, 0x44, 0xa7, 0x79, 0x3b, 0x95, 0x9e, 0xbb, 0x72, 0x82, 0xf7, 0xa0, 0x3e, 0x89, 0x17,
-	0x81, 0xb2, 0xd0, 0xc3, 0x37, 0x16, 0x18, 0x65, 0x44, 0xdd, 0xd1, 0x90, 0xb3, 0x60, 0xa1, 0xa7,
-	0x7d, 0x2d, 0x16, 0xbc, 0x60, 0xc1, 0xc2, 0x89, 0x00, 0xb2, 0x77, 0xff, 0x5f, 0xae, 0xdb, 0x87,
-	0x46, 0x48, 0xa3, 0xa9, 0x2f, 0x84, 0xa2, 0x4c, 0x32, 0xe9, 0xf3, 0xa2, 0xde, 0x57, 0xd0, 0x4c,
-	0xd6, 0x4a, 0xa4, 0x9e, 0x11, 0x9f, 0x40, 0xcd, 0xac, 0x19, 0x6c, 0xa7, 0xf5, 0x2e, 0x6c, 0x1e,
-	0x3b, 0x63, 0x74, 0x32, 0xed, 0x4b, 0xbd, 0xdf, 0x2b, 0xd0, 0xcc, 0x6f, 0x06, 0x7c, 0x06, 0x77,
-	0xbf, 0xa6, 0x72, 0xd5, 0x5e, 0x2d, 0x80, 0xed, 0x6b, 0x57, 0x8b, 0x53, 0xc2, 0x3e, 0x34, 0xf3,
-	0xab, 0x64, 0x09, 0xff, 0x6e, 0x7a, 0x5e, 0xb5, 0x71, 0x9c, 0xd2, 0xc7, 0x16, 0xf6, 0xa1, 0x66,
-	0xba, 0x22, 0x97, 0x55, 0x61, 0x40, 0xd9, 0x7b, 0x2b, 0x34, 0xc6, 0x09, 0x7e, 0x0f, 0xad, 0xa5,
-	0xb9, 0x8c, 0xd9, 0x90, 0x5c, 0x37, 0xef, 0x6d, 0xe7, 0x3a, 0x93, 0xd4, 0xfb, 0x33, 0x68, 0x2d,
-	0x0d, 0xf6, 0xbc, 0xf7, 0x35, 0x43, 0x7f, 0xf9, 0x21, 0xf0, 0x38, 0x26, 0x91, 0xe1, 0x38, 0xda,
-	0xb9, 0xda, 0x16, 0x88, 0xbf, 0x8c, 0xfd, 0xe2, 0xfe, 0xeb, 0x37, 0x1d, 0xeb, 0xcf, 0x37, 0x9d,
-	0xd2, 0x4f, 0x57, 0x1d, 0xeb, 0xf5, 0x55, 0xc7, 0xfa, 0xe3, 0xaa, 0x63, 0xfd, 0x75, 0xd5, 0xb1,
-	0x7e, 0xf9, 0xbb, 0x53, 0xba, 0xdc, 0x54, 0xbf, 0x4b, 0x8f, 0xff, 0x09, 0x00, 0x00, 0xff, 0xff,
-	0x2f, 0x42, 0x8f, 0x63, 0x73, 0x09, 0x00, 0x00,
+	// 1063 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0x5f, 0x6f, 0x1b, 0x45,
+	0x10, 0xcf, 0xd9, 0x71, 0x6c, 0x8f, 0xdd, 0x24, 0xde, 0x84, 0xc8, 0xb9, 0x04, 0x2b, 0xbd, 0x14,
+	0x1a, 0xa4, 0xc6, 0x21, 0x2e, 0x6a, 0x51, 0x84, 0x10, 0x06, 0x07, 0x6a, 0x89, 0xa6, 0xd6, 0x99,
+	0x8a, 0x07, 0x10, 0xd6, 0xfa, 0x6e, 0x63, 0x9f, 0x38, 0xef, 0x1e, 0xb7, 0x6b, 0x4b, 0xae, 0x84,
+	0xc4, 0x03, 0x1f, 0x80, 0xcf, 0x80, 0x78, 0xe1, 0x03, 0xf0, 0x1d, 0xfa, 0xc8, 0x23, 0x8f, 0x34,
+	0x7c, 0x11, 0x74, 0x7b, 0x7f, 0x75, 0x3e, 0xbb, 0xa9, 0xd4, 0xb7, 0xdb, 0x99, 0xf9, 0xcd, 0xce,
+	0xfc, 0x66, 0x6e, 0x76, 0xa0, 0x8c, 0x1d, 0xab, 0xe9, 0xb8, 0x4c, 0x30, 0x54, 0x9c, 0x9d, 0x0f,
+	0x89, 0xc0, 0xe7, 0xea, 0xe9, 0xc8, 0x12, 0xe3, 0xe9, 0xb0, 0x69, 0xb0, 0xc9, 0xd9, 0x88, 0x8d,
+	0xd8, 0x99, 0xd4, 0x0f, 0xa7, 0xd7, 0xf2, 0x24, 0x0f, 0xf2, 0xcb, 0xc7, 0x69, 0xbf, 0x2b, 0xb0,
+	0xd3, 0x21, 0x33, 0xcb, 0x20, 0x3d, 0x7b, 0x3a, 0xb2, 0xe8, 0x33, 0x47, 0x58, 0x8c, 0x72, 0xf4,
+	0x00, 0x90, 0xe3, 0x92, 0x01, 0x17, 0xd8, 0x15, 0x03, 0x97, 0xfc, 0x34, 0xb5, 0x5c, 0x62, 0xd6,
+	0x95, 0x23, 0xe5, 0xa4, 0xa4, 0x6f, 0x3b, 0x2e, 0xe9, 0x7b, 0x0a, 0x3d, 0x90, 0x4b, 0x6b, 0xc6,
+	0xc5, 0x80, 0x0b, 0xe6, 0xc4, 0xd6, 0xb9, 0xc0, 0x9a, 0x71, 0xd1, 0x17, 0xcc, 0x89, 0xac, 0xcf,
+	0x60, 0xc7, 0x24, 0xd8, 0xb6, 0x99, 0x81, 0x05, 0x89, 0xcd, 0xf3, 0xd2, 0x1c, 0xc5, 0xaa, 0x10,
+	0xa0, 0xfd, 0xa1, 0xc0, 0x96, 0x4e, 0x46, 0x16, 0x17, 0xc4, 0xf5, 0x84, 0x84, 0x0b, 0x54, 0x87,
+	0xe2, 0x8c, 0xb8, 0xdc, 0x62, 0x54, 0x46, 0x55, 0xd6, 0xc3, 0x23, 0x52, 0xa1, 0x44, 0xa8, 0xe9,
+	0x30, 0x8b, 0x0a, 0x19, 0x42, 0x59, 0x8f, 0xce, 0xe8, 0x18, 0xee, 0xb8, 0x84, 0xb3, 0xa9, 0x6b,
+	0x90, 0x01, 0xc5, 0x13, 0x22, 0x2f, 0x2d, 0xeb, 0xd5, 0x50, 0x78, 0x85, 0x27, 0x04, 0x3d, 0x82,
+	0x22, 0xf3, 0x69, 0xa8, 0xaf, 0x1f, 0x29, 0x27, 0x95, 0xd6, 0x61, 0x33, 0x60, 0xb7, 0x99, 0x41,
+	0x95, 0x1e, 0x1a, 0x6b, 0x45, 0x28, 0x5c, 0x4e, 0x1c, 0x31, 0xd7, 0xda, 0xb0, 0xfb, 0xb5, 0xc5,
+	0x45, 0x9b, 0x9a, 0xdf, 0x62, 0x61, 0x8c, 0x75, 0xc2, 0x1d, 0x46, 0x39, 0x41, 0x1f, 0x40, 0xd1,
+	0x94, 0x0e, 0x78, 0x5d, 0x39, 0xca, 0x9f, 0x54, 0x5a, 0x5b, 0x29, 0xc7, 0x7a, 0xa8, 0xd7, 0x1e,
+	0x43, 0xf5, 0x1b, 0xe6, 0x30, 0x9b, 0x8d, 0xe6, 0x5d, 0x7a, 0xcd, 0xd0, 0x7d, 0x28, 0x50, 0x66,
+	0x46, 0xc0, 0x5a, 0x04, 0xbc, 0x7a, 0xfe, 0xb4, 0x7d, 0xc5, 0x4c, 0xa2, 0xfb, 0x7a, 0x4d, 0x85,
+	0x52, 0x28, 0x42, 0x9b, 0x90, 0xeb, 0x76, 0x24, 0x3d, 0x79, 0x3d, 0xd7, 0xed, 0x68, 0x06, 0x6c,
+	0xf8, 0xf7, 0x24, 0x34, 0x65, 0x4f, 0x83, 0xf6, 0x60, 0x63, 0x4c, 0xb0, 0x2d, 0xc6, 0x01, 0x63,
+	0xc1, 0x09, 0x9d, 0x43, 0x49, 0x04, 0x61, 0x48, 0xaa, 0x2a, 0xad, 0x77, 0xa2, 0x9b, 0x93, 0xf1,
+	0xe9, 0x91, 0x99, 0x76, 0x01, 0xf5, 0x5e, 0xd0, 0x1f, 0x5f, 0x30, 0x2a, 0xb0, 0x45, 0xe3, 0xa2,
+	0x35, 0x00, 0x82, 0x04, 0xbb, 0x1d, 0x3f, 0x95, 0xb2, 0x9e, 0x90, 0x68, 0x07, 0xb0, 0x9f, 0x81,
+	0xf5, 0xd9, 0x93, 0x8e, 0x83, 0x56, 0x7a, 0x63, 0xc7, 0x73, 0x50, 0x7b, 0x2e, 0xb9, 0x26, 0xae,
+	0x4b, 0xcc, 0xb6, 0xdf, 0x5e, 0x16, 0xa3, 0x21, 0xfa, 0x3b, 0x40, 0x46, 0xe8, 0x51, 0xf6, 0x23,
+	0xe1, 0x22, 0x64, 0xfa, 0x41, 0x94, 0x6f, 0x74, 0xe9, 0x72, 0x4f, 0x7a, 0xcd, 0x48, 0x45, 0xc6,
+	0xb5, 0xbf, 0x14, 0x38, 0xbe, 0x05, 0xd4, 0xfb, 0x2b, 0xf0, 0x0c, 0x5b, 0x36, 0x1e, 0xda, 0x64,
+	0xe0, 0x87, 0x1e, 0xe7, 0x82, 0x22, 0x55, 0x27, 0xd4, 0xa0, 0x8f, 0x60, 0x6f, 0x32, 0xe5, 0x62,
+	0x60, 0x51, 0xc3, 0x9e, 0x9a, 0x49, 0x4c, 0x4e, 0x62, 0x76, 0x3d, 0x6d, 0xd7, 0x57, 0xc6, 0xa8,
+	0xfb, 0xb0, 0x85, 0xa3, 0xbb, 0x07, 0xdc, 0x7a, 0xe1, 0xff, 0x03, 0x05, 0x7d, 0x33, 0x16, 0xf7,
+	0xad, 0x17, 0x44, 0xfb, 0x19, 0x0e, 0x32, 0xa3, 0x0d, 0x7a, 0xf9, 0x07, 0xd8, 0x49, 0x72, 0xe6,
+	0x4b, 0x43, 0xd2, 0x4e, 0x6f, 0x49, 0x9a, 0x8f, 0xd2, 0x91, 0x91, 0x2e, 0x36, 0xd7, 0x3a, 0x70,
+	0xef, 0x36, 0x58, 0x74, 0x08, 0xe5, 0x34, 0x59, 0xb1, 0x40, 0x33, 0x60, 0xab, 0x9d, 0x98, 0x26,
+	0x1e, 0xcf, 0xbd, 0x15, 0xc5, 0xbe, 0xbb, 0x18, 0x77, 0x0a, 0x9e, 0x55, 0xe1, 0x0b, 0xa8, 0x2f,
+	0x33, 0x7f, 0x6d, 0x63, 0x8e, 0x60, 0x3b, 0x86, 0x04, 0x29, 0xf5, 0x57, 0x51, 0xab, 0xad, 0x0a,
+	0x71, 0x05, 0x9f, 0xbf, 0xe6, 0x61, 0x7f, 0x29, 0x02, 0x7d, 0x06, 0xeb, 0x84, 0xce, 0x56, 0xf4,
+	0x7c, 0x1a, 0xd1, 0xbc, 0xa4, 0x33, 0x7e, 0x49, 0x85, 0x3b, 0xd7, 0x25, 0x12, 0xbd, 0x0f, 0x1b,
+	0x13, 0x36, 0xa5, 0xc2, 0xef, 0xbe, 0x4a, 0x6b, 0x33, 0xf2, 0xf1, 0xd4, 0x13, 0xeb, 0x81, 0x16,
+	0x9d, 0xc6, 0x33, 0x30, 0x2f, 0x0d, 0x77, 0x52, 0x33, 0xb0, 0xef, 0x10, 0x23, 0x9a, 0x83, 0xe8,
+	0x39, 0x54, 0x30, 0xa5, 0x4c, 0xe0, 0x70, 0x1e, 0x7b, 0x90, 0x87, 0xb7, 0x88, 0xaf, 0x1d, 0xa3,
+	0xfc, 0x30, 0x93, 0x7e, 0xd4, 0xc7, 0x50, 0x8e, 0x12, 0x40, 0xdb, 0x90, 0xff, 0x91, 0xcc, 0x83,
+	0x69, 0xe8, 0x7d, 0xa2, 0x5d, 0x28, 0xcc, 0xb0, 0x3d, 0x25, 0xc1, 0x34, 0xf4, 0x0f, 0x17, 0xb9,
+	0x8f, 0x15, 0xf5, 0x53, 0xd8, 0x4e, 0x7b, 0x7e, 0x13, 0xbc, 0x36, 0x82, 0x5a, 0x87, 0xe0, 0x54,
+	0x93, 0xe8, 0x2b, 0x5a, 0xf2, 0x78, 0x31, 0xd7, 0x05, 0x07, 0x59, 0x4d, 0xf9, 0x09, 0xa8, 0xcb,
+	0x01, 0xaf, 0x6d, 0xcb, 0x31, 0x14, 0x64, 0xd9, 0xd0, 0x7b, 0xb0, 0x19, 0x87, 0xe6, 0x60, 0x31,
+	0x0e, 0xd2, 0xbc, 0x13, 0x49, 0x7b, 0x58, 0x8c, 0xd1, 0x01, 0x94, 0xc7, 0xde, 0x02, 0x20, 0x2d,
+	0x82, 0x47, 0xd7, 0x13, 0x84, 0x4a, 0x97, 0x60, 0x73, 0xc0, 0xa8, 0x3d, 0x0f, 0x5e, 0xf9, 0x92,
+	0x27, 0x78, 0x46, 0xed, 0xb9, 0xe6, 0x02, 0xc4, 0x75, 0x7f, 0x2b, 0xd7, 0x1d, 0x41, 0xc5, 0x21,
+	0xee, 0xc4, 0xe2, 0x5c, 0xb6, 0x8c, 0xff, 0xc2, 0x27, 0x45, 0xad, 0x2f, 0xa1, 0xea, 0xaf, 0x13,
+	0xae, 0x2c, 0x23, 0x7a, 0x04, 0xa5, 0x70, 0xbd, 0x40, 0xf5, 0x88, 0xef, 0xd4, 0xc6, 0xa1, 0xc6,
+	0x1d, 0xed, 0xbf, 0xf2, 0x6b, 0xad, 0x3f, 0xd7, 0xa1, 0x9a, 0xdc, 0x08, 0xd0, 0x13, 0xd8, 0xfb,
+	0x8a, 0x88, 0xac, 0x7d, 0x2a, 0x05, 0x56, 0x57, 0xae, 0x14, 0xda, 0x1a, 0x6a, 0x43, 0x35, 0xb9,
+	0x42, 0x2c, 0xe0, 0xdf, 0x8d, 0xce, 0x59, 0x9b, 0x86, 0xb6, 0xf6, 0xa1, 0x82, 0x88, 0x0c, 0x26,
+	0x63, 0x76, 0xa2, 0xb8, 0xa7, 0x96, 0xbf, 0x47, 0xea, 0xbd, 0xd5, 0x46, 0xe1, 0x45, 0xa8, 0x0d,
+	0xa5, 0x40, 0x4e, 0x12, 0xe4, 0xa5, 0xe6, 0xa0, 0xba, 0x9f, 0xa1, 0x89, 0x5c, 0x7c, 0x0f, 0xb5,
+	0x85, 0x67, 0x1f, 0xdd, 0x4d, 0xde, 0x9f, 0xb9, 0x4e, 0xa8, 0xda, 0x2a, 0x93, 0xc8, 0xfb, 0x13,
+	0xa8, 0x2d, 0xec, 0x0d, 0x49, 0xef, 0x4b, 0x76, 0x8a, 0xc5, 0x7a, 0xa3, 0x0b, 0x80, 0xf8, 0x57,
+	0x42, 0x6a, 0xa2, 0x84, 0xa9, 0xff, 0x6b, 0x11, 0xfb, 0xf9, 0xe1, 0xcb, 0x57, 0x0d, 0xe5, 0x9f,
+	0x57, 0x8d, 0xb5, 0x5f, 0x6e, 0x1a, 0xca, 0xcb, 0x9b, 0x86, 0xf2, 0xf7, 0x4d, 0x43, 0xf9, 0xf7,
+	0xa6, 0xa1, 0xfc, 0xf6, 0x5f, 0x63, 0x6d, 0xb8, 0x21, 0xb7, 0xf1, 0x87, 0xff, 0x0f, 0x00, 0x45,
+	0xfb, 0x84, 0x0a, 0xd2, 0x0b, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -1197,6 +1419,12 @@ type DevicePluginClient interface {
 	// Whenever a Device state change or a Device disappears, ListAndWatch
 	// returns the new list
 	ListAndWatch(ctx context.Context, in *Empty, opts ...grpc.CallOption) (DevicePlugin_ListAndWatchClient, error)
+	// GetPreferredAllocation returns a preferred set of devices to allocate
+	// from a list of available ones. The resulting preferred allocation is not
+	// guaranteed to be the allocation ultimately performed by the
+	// devicemanager. It is only designed to help the devicemanager make a more
+	// informed allocation decision when possible.
+	GetPreferredAllocation(ctx context.Context, in *PreferredAllocationRequest, opts ...grpc.CallOption) (*PreferredAllocationResponse, error)
 	// Allocate is called during container creation so that the Device
 	// Plugin can run device specific operations and instruct Kubelet
 	// of the steps to make the Device available in the container
@@ -1264,6 +1492,15 @@ func (x *devicePluginListAndWatchClient) Recv() (*ListAndWatchResponse, error) {
 	return m, nil
 }
 
+func (c *devicePluginClient) GetPreferredAllocation(ctx context.Context, in *PreferredAllocationRequest, opts ...grpc.CallOption) (*PreferredAllocationResponse, error) {
+	out := new(PreferredAllocationResponse)
+	err := c.cc.Invoke(ctx, "/v1beta1.DevicePlugin/GetPreferredAllocation", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *devicePluginClient) Allocate(ctx context.Context, in *AllocateRequest, opts ...grpc.CallOption) (*AllocateResponse, error) {
 	out := new(AllocateResponse)
 	err := c.cc.Invoke(ctx, "/v1beta1.DevicePlugin/Allocate", in, out, opts...)
@@ -1309,6 +1546,12 @@ type DevicePluginServer interface {
 	// Whenever a Device state change or a Device disappears, ListAndWatch
 	// returns the new list
 	ListAndWatch(*Empty, DevicePlugin_ListAndWatchServer) error
+	// GetPreferredAllocation returns a preferred set of devices to allocate
+	// from a list of available ones. The resulting preferred allocation is not
+	// guaranteed to be the allocation ultimately performed by the
+	// devicemanager. It is only designed to help the devicemanager make a more
+	// informed allocation decision when possible.
+	GetPreferredAllocation(context.Context, *PreferredAllocationRequest) (*PreferredAllocationResponse, error)
 	// Allocate is called during container creation so that the Device
 	// Plugin can run device specific operations and instruct Kubelet
 	// of the steps to make the Device available in the container
@@ -1337,6 +1580,9 @@ func (*UnimplementedDevicePluginServer) GetDevicePluginOptions(ctx context.Conte
 func (*UnimplementedDevicePluginServer) ListAndWatch(req *Empty, srv DevicePlugin_ListAndWatchServer) error {
 	return status.Errorf(codes.Unimplemented, "method ListAndWatch not implemented")
 }
+func (*UnimplementedDevicePluginServer) GetPreferredAllocation(ctx context.Context, req *PreferredAllocationRequest) (*PreferredAllocationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPreferredAllocation not implemented")
+}
 func (*UnimplementedDevicePluginServer) Allocate(ctx context.Context, req *AllocateRequest) (*AllocateResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Allocate not implemented")
 }
@@ -1393,6 +1639,24 @@ func (x *devicePluginListAndWatchServer) Send(m *ListAndWatchResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _DevicePlugin_GetPreferredAllocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PreferredAllocationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DevicePluginServer).GetPreferredAllocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1beta1.DevicePlugin/GetPreferredAllocation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DevicePluginServer).GetPreferredAllocation(ctx, req.(*PreferredAllocationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _DevicePlugin_Allocate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(AllocateRequest)
 	if err := dec(in); err != nil {
@@ -1473,6 +1737,10 @@ var _DevicePlugin_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetDevicePluginOptions",
 			Handler:    _DevicePlugin_GetDevicePluginOptions_Handler,
 		},
+		{
+			MethodName: "GetPreferredAllocation",
+			Handler:    _DevicePlugin_GetPreferredAllocation_Handler,
+		},
 		{
 			MethodName: "Allocate",
 			Handler:    _DevicePlugin_Allocate_Handler,
@@ -1870,7 +2138,7 @@ func (m *PostStopContainerRequest) MarshalToSizedBuffer(dAtA []byte) (int, error
 	return len(dAtA) - i, nil
 }
 
-func (m *AllocateRequest) Marshal() (dAtA []byte, err error) {
+func (m *PreferredAllocationRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -1880,12 +2148,12 @@ func (m *AllocateRequest) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *AllocateRequest) MarshalTo(dAtA []byte) (int, error) {
+func (m *PreferredAllocationRequest) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *AllocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *PreferredAllocationRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
@@ -1907,7 +2175,7 @@ func (m *AllocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
-func (m *ContainerAllocateRequest) Marshal() (dAtA []byte, err error) {
+func (m *ContainerPreferredAllocationRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -1917,21 +2185,35 @@ func (m *ContainerAllocateRequest) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *ContainerAllocateRequest) MarshalTo(dAtA []byte) (int, error) {
+func (m *ContainerPreferredAllocationRequest) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *ContainerAllocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *ContainerPreferredAllocationRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if len(m.DevicesIDs) > 0 {
-		for iNdEx := len(m.DevicesIDs) - 1; iNdEx >= 0; iNdEx-- {
-			i -= len(m.DevicesIDs[iNdEx])
-			copy(dAtA[i:], m.DevicesIDs[iNdEx])
-			i = encodeVarintApi(dAtA, i, uint64(len(m.DevicesIDs[iNdEx])))
+	if m.AllocationSize != 0 {
+		i = encodeVarintApi(dAtA, i, uint64(m.AllocationSize))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.MustIncludeDeviceIDs) > 0 {
+		for iNdEx := len(m.MustIncludeDeviceIDs) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.MustIncludeDeviceIDs[iNdEx])
+			copy(dAtA[i:], m.MustIncludeDeviceIDs[iNdEx])
+			i = encodeVarintApi(dAtA, i, uint64(len(m.MustIncludeDeviceIDs[iNdEx])))
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if len(m.AvailableDeviceIDs) > 0 {
+		for iNdEx := len(m.AvailableDeviceIDs) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.AvailableDeviceIDs[iNdEx])
+			copy(dAtA[i:], m.AvailableDeviceIDs[iNdEx])
+			i = encodeVarintApi(dAtA, i, uint64(len(m.AvailableDeviceIDs[iNdEx])))
 			i--
 			dAtA[i] = 0xa
 		}
@@ -1939,7 +2221,7 @@ func (m *ContainerAllocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error
 	return len(dAtA) - i, nil
 }
 
-func (m *AllocateResponse) Marshal() (dAtA []byte, err error) {
+func (m *PreferredAllocationResponse) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -1949,12 +2231,12 @@ func (m *AllocateResponse) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *AllocateResponse) MarshalTo(dAtA []byte) (int, error) {
+func (m *PreferredAllocationResponse) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *AllocateResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *PreferredAllocationResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
@@ -1976,7 +2258,7 @@ func (m *AllocateResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
-func (m *ContainerAllocateResponse) Marshal() (dAtA []byte, err error) {
+func (m *ContainerPreferredAllocationResponse) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -1986,78 +2268,21 @@ func (m *ContainerAllocateResponse) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *ContainerAllocateResponse) MarshalTo(dAtA []byte) (int, error) {
+func (m *ContainerPreferredAllocationResponse) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *ContainerAllocateResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *ContainerPreferredAllocationResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if len(m.Annotations) > 0 {
-		for k := range m.Annotations {
-			v := m.Annotations[k]
-			baseI := i
-			i -= len(v)
-			copy(dAtA[i:], v)
-			i = encodeVarintApi(dAtA, i, uint64(len(v)))
-			i--
-			dAtA[i] = 0x12
-			i -= len(k)
-			copy(dAtA[i:], k)
-			i = encodeVarintApi(dAtA, i, uint64(len(k)))
-			i--
-			dAtA[i] = 0xa
-			i = encodeVarintApi(dAtA, i, uint64(baseI-i))
-			i--
-			dAtA[i] = 0x22
-		}
-	}
-	if len(m.Devices) > 0 {
-		for iNdEx := len(m.Devices) - 1; iNdEx >= 0; iNdEx-- {
-			{
-				size, err := m.Devices[iNdEx].MarshalToSizedBuffer(dAtA[:i])
-				if err != nil {
-					return 0, err
-				}
-				i -= size
-				i = encodeVarintApi(dAtA, i, uint64(size))
-			}
-			i--
-			dAtA[i] = 0x1a
-		}
-	}
-	if len(m.Mounts) > 0 {
-		for iNdEx := len(m.Mounts) - 1; iNdEx >= 0; iNdEx-- {
-			{
-				size, err := m.Mounts[iNdEx].MarshalToSizedBuffer(dAtA[:i])
-				if err != nil {
-					return 0, err
-				}
-				i -= size
-				i = encodeVarintApi(dAtA, i, uint64(size))
-			}
-			i--
-			dAtA[i] = 0x12
-		}
-	}
-	if len(m.Envs) > 0 {
-		for k := range m.Envs {
-			v := m.Envs[k]
-			baseI := i
-			i -= len(v)
-			copy(dAtA[i:], v)
-			i = encodeVarintApi(dAtA, i, uint64(len(v)))
-			i--
-			dAtA[i] = 0x12
-			i -= len(k)
-			copy(dAtA[i:], k)
-			i = encodeVarintApi(dAtA, i, uint64(len(k)))
-			i--
-			dAtA[i] = 0xa
-			i = encodeVarintApi(dAtA, i, uint64(baseI-i))
+	if len(m.DeviceIDs) > 0 {
+		for iNdEx := len(m.DeviceIDs) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.DeviceIDs[iNdEx])
+			copy(dAtA[i:], m.DeviceIDs[iNdEx])
+			i = encodeVarintApi(dAtA, i, uint64(len(m.DeviceIDs[iNdEx])))
 			i--
 			dAtA[i] = 0xa
 		}
@@ -2065,7 +2290,7 @@ func (m *ContainerAllocateResponse) MarshalToSizedBuffer(dAtA []byte) (int, erro
 	return len(dAtA) - i, nil
 }
 
-func (m *DeallocateRequest) Marshal() (dAtA []byte, err error) {
+func (m *AllocateRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -2075,12 +2300,12 @@ func (m *DeallocateRequest) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *DeallocateRequest) MarshalTo(dAtA []byte) (int, error) {
+func (m *AllocateRequest) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *DeallocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *AllocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
@@ -2102,7 +2327,7 @@ func (m *DeallocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
-func (m *ContainerDeallocateRequest) Marshal() (dAtA []byte, err error) {
+func (m *ContainerAllocateRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -2112,12 +2337,207 @@ func (m *ContainerDeallocateRequest) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *ContainerDeallocateRequest) MarshalTo(dAtA []byte) (int, error) {
+func (m *ContainerAllocateRequest) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *ContainerDeallocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *ContainerAllocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.DevicesIDs) > 0 {
+		for iNdEx := len(m.DevicesIDs) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.DevicesIDs[iNdEx])
+			copy(dAtA[i:], m.DevicesIDs[iNdEx])
+			i = encodeVarintApi(dAtA, i, uint64(len(m.DevicesIDs[iNdEx])))
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *AllocateResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *AllocateResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *AllocateResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.ContainerResponses) > 0 {
+		for iNdEx := len(m.ContainerResponses) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.ContainerResponses[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintApi(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ContainerAllocateResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ContainerAllocateResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ContainerAllocateResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Annotations) > 0 {
+		for k := range m.Annotations {
+			v := m.Annotations[k]
+			baseI := i
+			i -= len(v)
+			copy(dAtA[i:], v)
+			i = encodeVarintApi(dAtA, i, uint64(len(v)))
+			i--
+			dAtA[i] = 0x12
+			i -= len(k)
+			copy(dAtA[i:], k)
+			i = encodeVarintApi(dAtA, i, uint64(len(k)))
+			i--
+			dAtA[i] = 0xa
+			i = encodeVarintApi(dAtA, i, uint64(baseI-i))
+			i--
+			dAtA[i] = 0x22
+		}
+	}
+	if len(m.Devices) > 0 {
+		for iNdEx := len(m.Devices) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Devices[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintApi(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if len(m.Mounts) > 0 {
+		for iNdEx := len(m.Mounts) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Mounts[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintApi(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if len(m.Envs) > 0 {
+		for k := range m.Envs {
+			v := m.Envs[k]
+			baseI := i
+			i -= len(v)
+			copy(dAtA[i:], v)
+			i = encodeVarintApi(dAtA, i, uint64(len(v)))
+			i--
+			dAtA[i] = 0x12
+			i -= len(k)
+			copy(dAtA[i:], k)
+			i = encodeVarintApi(dAtA, i, uint64(len(k)))
+			i--
+			dAtA[i] = 0xa
+			i = encodeVarintApi(dAtA, i, uint64(baseI-i))
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *DeallocateRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *DeallocateRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *DeallocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.ContainerRequests) > 0 {
+		for iNdEx := len(m.ContainerRequests) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.ContainerRequests[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintApi(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ContainerDeallocateRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ContainerDeallocateRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ContainerDeallocateRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
@@ -2390,6 +2810,75 @@ func (m *PostStopContainerRequest) Size() (n int) {
 	return n
 }
 
+func (m *PreferredAllocationRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.ContainerRequests) > 0 {
+		for _, e := range m.ContainerRequests {
+			l = e.Size()
+			n += 1 + l + sovApi(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *ContainerPreferredAllocationRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.AvailableDeviceIDs) > 0 {
+		for _, s := range m.AvailableDeviceIDs {
+			l = len(s)
+			n += 1 + l + sovApi(uint64(l))
+		}
+	}
+	if len(m.MustIncludeDeviceIDs) > 0 {
+		for _, s := range m.MustIncludeDeviceIDs {
+			l = len(s)
+			n += 1 + l + sovApi(uint64(l))
+		}
+	}
+	if m.AllocationSize != 0 {
+		n += 1 + sovApi(uint64(m.AllocationSize))
+	}
+	return n
+}
+
+func (m *PreferredAllocationResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.ContainerResponses) > 0 {
+		for _, e := range m.ContainerResponses {
+			l = e.Size()
+			n += 1 + l + sovApi(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *ContainerPreferredAllocationResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.DeviceIDs) > 0 {
+		for _, s := range m.DeviceIDs {
+			l = len(s)
+			n += 1 + l + sovApi(uint64(l))
+		}
+	}
+	return n
+}
+
 func (m *AllocateRequest) Size() (n int) {
 	if m == nil {
 		return 0
@@ -2664,13 +3153,65 @@ func (this *PostStopContainerRequest) String() string {
 	}, "")
 	return s
 }
-func (this *AllocateRequest) String() string {
+func (this *PreferredAllocationRequest) String() string {
 	if this == nil {
 		return "nil"
 	}
-	repeatedStringForContainerRequests := "[]*ContainerAllocateRequest{"
+	repeatedStringForContainerRequests := "[]*ContainerPreferredAllocationRequest{"
 	for _, f := range this.ContainerRequests {
-		repeatedStringForContainerRequests += strings.Replace(f.String(), "ContainerAllocateRequest", "ContainerAllocateRequest", 1) + ","
+		repeatedStringForContainerRequests += strings.Replace(f.String(), "ContainerPreferredAllocationRequest", "ContainerPreferredAllocationRequest", 1) + ","
+	}
+	repeatedStringForContainerRequests += "}"
+	s := strings.Join([]string{`&PreferredAllocationRequest{`,
+		`ContainerRequests:` + repeatedStringForContainerRequests + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *ContainerPreferredAllocationRequest) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&ContainerPreferredAllocationRequest{`,
+		`AvailableDeviceIDs:` + fmt.Sprintf("%v", this.AvailableDeviceIDs) + `,`,
+		`MustIncludeDeviceIDs:` + fmt.Sprintf("%v", this.MustIncludeDeviceIDs) + `,`,
+		`AllocationSize:` + fmt.Sprintf("%v", this.AllocationSize) + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *PreferredAllocationResponse) String() string {
+	if this == nil {
+		return "nil"
+	}
+	repeatedStringForContainerResponses := "[]*ContainerPreferredAllocationResponse{"
+	for _, f := range this.ContainerResponses {
+		repeatedStringForContainerResponses += strings.Replace(f.String(), "ContainerPreferredAllocationResponse", "ContainerPreferredAllocationResponse", 1) + ","
+	}
+	repeatedStringForContainerResponses += "}"
+	s := strings.Join([]string{`&PreferredAllocationResponse{`,
+		`ContainerResponses:` + repeatedStringForContainerResponses + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *ContainerPreferredAllocationResponse) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&ContainerPreferredAllocationResponse{`,
+		`DeviceIDs:` + fmt.Sprintf("%v", this.DeviceIDs) + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *AllocateRequest) String() string {
+	if this == nil {
+		return "nil"
+	}
+	repeatedStringForContainerRequests := "[]*ContainerAllocateRequest{"
+	for _, f := range this.ContainerRequests {
+		repeatedStringForContainerRequests += strings.Replace(f.String(), "ContainerAllocateRequest", "ContainerAllocateRequest", 1) + ","
 	}
 	repeatedStringForContainerRequests += "}"
 	s := strings.Join([]string{`&AllocateRequest{`,
@@ -2719,7 +3260,7 @@ func (this *ContainerAllocateResponse) String() string {
 	}
 	repeatedStringForDevices += "}"
 	keysForEnvs := make([]string, 0, len(this.Envs))
-	for k := range this.Envs {
+	for k, _ := range this.Envs {
 		keysForEnvs = append(keysForEnvs, k)
 	}
 	github_com_gogo_protobuf_sortkeys.Strings(keysForEnvs)
@@ -2729,7 +3270,7 @@ func (this *ContainerAllocateResponse) String() string {
 	}
 	mapStringForEnvs += "}"
 	keysForAnnotations := make([]string, 0, len(this.Annotations))
-	for k := range this.Annotations {
+	for k, _ := range this.Annotations {
 		keysForAnnotations = append(keysForAnnotations, k)
 	}
 	github_com_gogo_protobuf_sortkeys.Strings(keysForAnnotations)
@@ -2899,10 +3440,7 @@ func (m *DevicePluginOptions) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3084,10 +3622,444 @@ func (m *RegisterRequest) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthApi
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Empty) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowApi
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Empty: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Empty: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		default:
+			iNdEx = preIndex
+			skippy, err := skipApi(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthApi
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ListAndWatchResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowApi
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ListAndWatchResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ListAndWatchResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Devices", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowApi
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthApi
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthApi
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Devices = append(m.Devices, &Device{})
+			if err := m.Devices[len(m.Devices)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipApi(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthApi
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *TopologyInfo) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowApi
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: TopologyInfo: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: TopologyInfo: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nodes", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowApi
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
 				return ErrInvalidLengthApi
 			}
-			if (iNdEx + skippy) < 0 {
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthApi
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Nodes = append(m.Nodes, &NUMANode{})
+			if err := m.Nodes[len(m.Nodes)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipApi(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthApi
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *NUMANode) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowApi
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: NUMANode: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: NUMANode: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ID", wireType)
+			}
+			m.ID = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowApi
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ID |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipApi(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthApi
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Device) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowApi
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Device: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Device: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ID", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowApi
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthApi
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthApi
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ID = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Health", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowApi
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthApi
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthApi
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Health = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Topology", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowApi
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthApi
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthApi
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Topology == nil {
+				m.Topology = &TopologyInfo{}
+			}
+			if err := m.Topology.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipApi(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3102,7 +4074,7 @@ func (m *RegisterRequest) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *Empty) Unmarshal(dAtA []byte) error {
+func (m *PreStartContainerRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -3125,22 +4097,51 @@ func (m *Empty) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: Empty: wiretype end group for non-group")
+			return fmt.Errorf("proto: PreStartContainerRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: Empty: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: PreStartContainerRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DevicesIDs", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowApi
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthApi
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthApi
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DevicesIDs = append(m.DevicesIDs, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipApi(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3155,7 +4156,7 @@ func (m *Empty) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *ListAndWatchResponse) Unmarshal(dAtA []byte) error {
+func (m *PreStartContainerResponse) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -3178,56 +4179,19 @@ func (m *ListAndWatchResponse) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: ListAndWatchResponse: wiretype end group for non-group")
+			return fmt.Errorf("proto: PreStartContainerResponse: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: ListAndWatchResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: PreStartContainerResponse: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
-		case 1:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Devices", wireType)
-			}
-			var msglen int
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowApi
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := dAtA[iNdEx]
-				iNdEx++
-				msglen |= int(b&0x7F) << shift
-				if b < 0x80 {
-					break
-				}
-			}
-			if msglen < 0 {
-				return ErrInvalidLengthApi
-			}
-			postIndex := iNdEx + msglen
-			if postIndex < 0 {
-				return ErrInvalidLengthApi
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
-			}
-			m.Devices = append(m.Devices, &Device{})
-			if err := m.Devices[len(m.Devices)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
-			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipApi(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3242,7 +4206,7 @@ func (m *ListAndWatchResponse) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *TopologyInfo) Unmarshal(dAtA []byte) error {
+func (m *PostStopContainerRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -3265,17 +4229,17 @@ func (m *TopologyInfo) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: TopologyInfo: wiretype end group for non-group")
+			return fmt.Errorf("proto: PostStopContainerRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: TopologyInfo: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: PostStopContainerRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Nodes", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field DevicesIDs", wireType)
 			}
-			var msglen int
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowApi
@@ -3285,25 +4249,23 @@ func (m *TopologyInfo) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
 				return ErrInvalidLengthApi
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + intStringLen
 			if postIndex < 0 {
 				return ErrInvalidLengthApi
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Nodes = append(m.Nodes, &NUMANode{})
-			if err := m.Nodes[len(m.Nodes)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
+			m.DevicesIDs = append(m.DevicesIDs, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
@@ -3311,10 +4273,7 @@ func (m *TopologyInfo) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3329,7 +4288,7 @@ func (m *TopologyInfo) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *NUMANode) Unmarshal(dAtA []byte) error {
+func (m *PreferredAllocationRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -3352,17 +4311,17 @@ func (m *NUMANode) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: NUMANode: wiretype end group for non-group")
+			return fmt.Errorf("proto: PreferredAllocationRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: NUMANode: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: PreferredAllocationRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field ID", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ContainerRequests", wireType)
 			}
-			m.ID = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowApi
@@ -3372,21 +4331,33 @@ func (m *NUMANode) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.ID |= int64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthApi
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthApi
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ContainerRequests = append(m.ContainerRequests, &ContainerPreferredAllocationRequest{})
+			if err := m.ContainerRequests[len(m.ContainerRequests)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipApi(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3401,7 +4372,7 @@ func (m *NUMANode) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *Device) Unmarshal(dAtA []byte) error {
+func (m *ContainerPreferredAllocationRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -3424,15 +4395,15 @@ func (m *Device) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: Device: wiretype end group for non-group")
+			return fmt.Errorf("proto: ContainerPreferredAllocationRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: Device: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: ContainerPreferredAllocationRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field ID", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field AvailableDeviceIDs", wireType)
 			}
 			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
@@ -3460,11 +4431,11 @@ func (m *Device) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.ID = string(dAtA[iNdEx:postIndex])
+			m.AvailableDeviceIDs = append(m.AvailableDeviceIDs, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Health", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field MustIncludeDeviceIDs", wireType)
 			}
 			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
@@ -3492,13 +4463,13 @@ func (m *Device) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Health = string(dAtA[iNdEx:postIndex])
+			m.MustIncludeDeviceIDs = append(m.MustIncludeDeviceIDs, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
 		case 3:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Topology", wireType)
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AllocationSize", wireType)
 			}
-			var msglen int
+			m.AllocationSize = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowApi
@@ -3508,38 +4479,18 @@ func (m *Device) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				m.AllocationSize |= int32(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
-				return ErrInvalidLengthApi
-			}
-			postIndex := iNdEx + msglen
-			if postIndex < 0 {
-				return ErrInvalidLengthApi
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
-			}
-			if m.Topology == nil {
-				m.Topology = &TopologyInfo{}
-			}
-			if err := m.Topology.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
-			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipApi(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3554,7 +4505,7 @@ func (m *Device) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *PreStartContainerRequest) Unmarshal(dAtA []byte) error {
+func (m *PreferredAllocationResponse) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -3577,17 +4528,17 @@ func (m *PreStartContainerRequest) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: PreStartContainerRequest: wiretype end group for non-group")
+			return fmt.Errorf("proto: PreferredAllocationResponse: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: PreStartContainerRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: PreferredAllocationResponse: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field DevicesIDs", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field ContainerResponses", wireType)
 			}
-			var stringLen uint64
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowApi
@@ -3597,87 +4548,33 @@ func (m *PreStartContainerRequest) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
+			if msglen < 0 {
 				return ErrInvalidLengthApi
 			}
-			postIndex := iNdEx + intStringLen
+			postIndex := iNdEx + msglen
 			if postIndex < 0 {
 				return ErrInvalidLengthApi
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.DevicesIDs = append(m.DevicesIDs, string(dAtA[iNdEx:postIndex]))
-			iNdEx = postIndex
-		default:
-			iNdEx = preIndex
-			skippy, err := skipApi(dAtA[iNdEx:])
-			if err != nil {
+			m.ContainerResponses = append(m.ContainerResponses, &ContainerPreferredAllocationResponse{})
+			if err := m.ContainerResponses[len(m.ContainerResponses)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) > l {
-				return io.ErrUnexpectedEOF
-			}
-			iNdEx += skippy
-		}
-	}
-
-	if iNdEx > l {
-		return io.ErrUnexpectedEOF
-	}
-	return nil
-}
-func (m *PreStartContainerResponse) Unmarshal(dAtA []byte) error {
-	l := len(dAtA)
-	iNdEx := 0
-	for iNdEx < l {
-		preIndex := iNdEx
-		var wire uint64
-		for shift := uint(0); ; shift += 7 {
-			if shift >= 64 {
-				return ErrIntOverflowApi
-			}
-			if iNdEx >= l {
-				return io.ErrUnexpectedEOF
-			}
-			b := dAtA[iNdEx]
-			iNdEx++
-			wire |= uint64(b&0x7F) << shift
-			if b < 0x80 {
-				break
-			}
-		}
-		fieldNum := int32(wire >> 3)
-		wireType := int(wire & 0x7)
-		if wireType == 4 {
-			return fmt.Errorf("proto: PreStartContainerResponse: wiretype end group for non-group")
-		}
-		if fieldNum <= 0 {
-			return fmt.Errorf("proto: PreStartContainerResponse: illegal tag %d (wire type %d)", fieldNum, wire)
-		}
-		switch fieldNum {
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipApi(dAtA[iNdEx:])
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3692,7 +4589,7 @@ func (m *PreStartContainerResponse) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *PostStopContainerRequest) Unmarshal(dAtA []byte) error {
+func (m *ContainerPreferredAllocationResponse) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -3715,15 +4612,15 @@ func (m *PostStopContainerRequest) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: PostStopContainerRequest: wiretype end group for non-group")
+			return fmt.Errorf("proto: ContainerPreferredAllocationResponse: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: PostStopContainerRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: ContainerPreferredAllocationResponse: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field DevicesIDs", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field DeviceIDs", wireType)
 			}
 			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
@@ -3751,7 +4648,7 @@ func (m *PostStopContainerRequest) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.DevicesIDs = append(m.DevicesIDs, string(dAtA[iNdEx:postIndex]))
+			m.DeviceIDs = append(m.DeviceIDs, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
@@ -3759,10 +4656,7 @@ func (m *PostStopContainerRequest) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3846,10 +4740,7 @@ func (m *AllocateRequest) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -3931,10 +4822,7 @@ func (m *ContainerAllocateRequest) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -4018,10 +4906,7 @@ func (m *AllocateResponse) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -4181,7 +5066,7 @@ func (m *ContainerAllocateResponse) Unmarshal(dAtA []byte) error {
 					if err != nil {
 						return err
 					}
-					if skippy < 0 {
+					if (skippy < 0) || (iNdEx+skippy) < 0 {
 						return ErrInvalidLengthApi
 					}
 					if (iNdEx + skippy) > postIndex {
@@ -4376,7 +5261,7 @@ func (m *ContainerAllocateResponse) Unmarshal(dAtA []byte) error {
 					if err != nil {
 						return err
 					}
-					if skippy < 0 {
+					if (skippy < 0) || (iNdEx+skippy) < 0 {
 						return ErrInvalidLengthApi
 					}
 					if (iNdEx + skippy) > postIndex {
@@ -4393,10 +5278,7 @@ func (m *ContainerAllocateResponse) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -4480,10 +5362,7 @@ func (m *DeallocateRequest) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -4565,10 +5444,7 @@ func (m *ContainerDeallocateRequest) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -4702,10 +5578,7 @@ func (m *Mount) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -4851,10 +5724,7 @@ func (m *DeviceSpec) Unmarshal(dAtA []byte) error {
 			if err != nil {
 				return err
 			}
-			if skippy < 0 {
-				return ErrInvalidLengthApi
-			}
-			if (iNdEx + skippy) < 0 {
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
 				return ErrInvalidLengthApi
 			}
 			if (iNdEx + skippy) > l {
@@ -0,0 +1,328 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The shells of the FPGAs of a container and the UUIDs of their logic
+// partition, one per device. XRT only loads xclbins built for that shell.
+const (
+	ENV_XRT_SHELLS      string = "FPGA_XRT_SHELLS"
+	ENV_XRT_LOGIC_UUIDS string = "FPGA_XRT_LOGIC_UUIDS"
+)
+
+// The same, as annotations of the container, for the container runtime and
+// anything else that can't look into the container
+const (
+	ANNOTATION_XRT_SHELLS      string = "xilinx.com/xrt-shells"
+	ANNOTATION_XRT_LOGIC_UUIDS string = "xilinx.com/xrt-logic-uuids"
+)
+
+// The PCI drivers of XRT, the management driver owns the card and the user
+// driver serves applications
+const (
+	XRT_MGMT_DRIVER string = "xclmgmt"
+	XRT_USER_DRIVER string = "xocl"
+)
+
+// What XRT exposes of an Alveo card
+type xrtCard struct {
+	// The management function, bound to xclmgmt, e.g. 0000:65:00.0
+	mgmtFunction string
+	// The user function, bound to xocl, e.g. 0000:65:00.1
+	userFunction string
+	// Their sysfs directories
+	mgmtPath string
+	userPath string
+	// The shell the card is flashed with, e.g.
+	// xilinx_u250_gen3x16_xdma_shell_3_1
+	vbnv string
+	// Identifies the logic partition of the shell, as hex digits
+	logicUUID string
+}
+
+func init() {
+	registerBackend("xrt", newXRTBackend)
+}
+
+// Finds Alveo cards driven by XRT. Containers only get the DRM render node of
+// the user function, the management function stays on the host. xclbins are
+// loaded by the applications through XRT, so bitstreams can't be configured
+// for these cards.
+type xrtBackend struct {
+	// Where the host sysfs is mounted, usually `/sys`
+	sysfsRoot string
+	// Where the host device nodes are, usually `/dev`
+	devRoot string
+}
+
+func newXRTBackend(options *BackendOptions) (Backend, error) {
+	return &xrtBackend{
+		sysfsRoot: options.SysfsRoot,
+		devRoot:   options.DevRoot,
+	}, nil
+}
+
+func (backend *xrtBackend) Name() string {
+	return "xrt"
+}
+
+// The name of the driver a PCI function is bound to, empty if none
+func pciDriver(functionPath string) string {
+	driver, err := os.Readlink(path.Join(functionPath, "driver"))
+	if err != nil {
+		return ""
+	}
+	return path.Base(driver)
+}
+
+// Read a sysfs attribute of an XRT subdevice of a PCI function, e.g.
+// rom.u.1/VBNV, empty if there is none
+func readXRTAttribute(functionPath string, subdevice string, attribute string) string {
+	matches, _ := filepath.Glob(path.Join(functionPath, subdevice+".*", attribute))
+	if len(matches) == 0 {
+		return ""
+	}
+	dat, err := ioutil.ReadFile(matches[0])
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(dat))
+}
+
+// Read the shell and logic UUID of a card. Both functions expose them, the
+// user function is tried first as the management one may be hidden from us.
+func (card *xrtCard) readShell() {
+	for _, functionPath := range []string{card.userPath, card.mgmtPath} {
+		if card.vbnv == "" {
+			card.vbnv = readXRTAttribute(functionPath, "rom", "VBNV")
+		}
+		if card.logicUUID == "" {
+			// Shells with a partitioned design list one UUID per line,
+			// the first is the logic partition. Older ones have a
+			// single UUID in their ROM.
+			dat, err := ioutil.ReadFile(path.Join(functionPath, "logic_uuids"))
+			if err == nil {
+				card.logicUUID = normalizeUUID(strings.SplitN(string(dat), "\n", 2)[0])
+			} else {
+				card.logicUUID = normalizeUUID(readXRTAttribute(functionPath, "rom", "uuid"))
+			}
+		}
+	}
+}
+
+// Search the PCI bus for Alveo cards whose management function is bound to
+// xclmgmt, and pair each with its user function, bound to xocl
+func (backend *xrtBackend) Discover() []*DiscoveredFPGA {
+	var found []*DiscoveredFPGA
+	busPath := path.Join(backend.sysfsRoot, "bus/pci/devices")
+	entries, err := ioutil.ReadDir(busPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Error": err,
+			"Path":  busPath,
+		}).Info("No PCIe bus found.")
+		return found
+	}
+	for _, entry := range entries {
+		mgmtPath := path.Join(busPath, entry.Name())
+		board := matchPCIeBoard(mgmtPath, knownPCIeBoards)
+		if board == nil {
+			continue
+		}
+		if driver := pciDriver(mgmtPath); driver != XRT_MGMT_DRIVER {
+			log.WithFields(log.Fields{
+				"Address": entry.Name(),
+				"Driver":  driver,
+			}).Info("Skipping Alveo card not bound to xclmgmt.")
+			continue
+		}
+		card := &xrtCard{
+			mgmtFunction: entry.Name(),
+			mgmtPath:     mgmtPath,
+		}
+		for _, function := range pcieSlotFunctions(backend.sysfsRoot, entry.Name()) {
+			if function != entry.Name() && pciDriver(path.Join(busPath, function)) == XRT_USER_DRIVER {
+				card.userFunction = function
+				card.userPath = path.Join(busPath, function)
+				break
+			}
+		}
+		if card.userFunction == "" {
+			log.WithFields(log.Fields{
+				"Address": entry.Name(),
+			}).Info("Skipping Alveo card without a user function bound to xocl.")
+			continue
+		}
+		card.readShell()
+		device := &FPGADevice{
+			pciAddress: entry.Name(),
+			xrt:        card,
+		}
+		// Only the render node is for applications, the DRM card node
+		// is for the display stack and has no use here
+		renderNodes, _ := ioutil.ReadDir(path.Join(card.userPath, "drm"))
+		for _, renderNode := range renderNodes {
+			if !strings.HasPrefix(renderNode.Name(), "renderD") {
+				continue
+			}
+			if _, err := os.Stat(path.Join(backend.devRoot, "dri", renderNode.Name())); err != nil {
+				continue
+			}
+			device.deviceNodes = append(device.deviceNodes, path.Join(hostDevRoot, "dri", renderNode.Name()))
+		}
+		// The card management controller (xmc) registers the sensors of
+		// the card under either function
+		for _, functionPath := range []string{card.mgmtPath, card.userPath} {
+			resolved, err := filepath.EvalSymlinks(functionPath)
+			if err != nil {
+				continue
+			}
+			device.hwmon = append(device.hwmon, findSysfsClassDevices(backend.sysfsRoot, "hwmon", resolved)...)
+		}
+		log.WithFields(log.Fields{
+			"Address":   card.mgmtFunction,
+			"User":      card.userFunction,
+			"Shell":     card.vbnv,
+			"LogicUUID": card.logicUUID,
+		}).Debug("Found XRT card")
+		found = append(found, &DiscoveredFPGA{
+			vendorName: board.vendorName,
+			boardName:  board.boardName,
+			identity:   pciIdentity(entry.Name()),
+			device:     device,
+		})
+	}
+	return found
+}
+
+func (backend *xrtBackend) Program(device *FPGADevice, region Region, bitstream string, deadline time.Time) error {
+	return fmt.Errorf("'%s' is an XRT card, its xclbins are loaded by applications, not programmed from '%s'", device.ID, bitstream)
+}
+
+// XRT cards keep the last xclbin and whatever is in their memory until the
+// next application loads its own, so the next container may find them
+func (backend *xrtBackend) Reset(device *FPGADevice, region Region, blankBitstream string) error {
+	log.WithFields(log.Fields{
+		"ID":     device.ID,
+		"Region": region.String(),
+	}).Warn("XRT cards are not wiped, the card is handed out with what the last container left on it")
+	return nil
+}
+
+// xclbins are loaded by the applications, so no bitstream can be configured
+func (backend *xrtBackend) CheckBoard(device *FPGADevice, board *BoardConfig) error {
+	if board.Bitstream != "" {
+		return fmt.Errorf("'%s' is an XRT card, its xclbins are loaded by applications, it can't have bitstream '%s'", device.pciAddress, board.Bitstream)
+	}
+	for _, tenant := range board.Tenants {
+		if tenant.Bitstream != "" {
+			return fmt.Errorf("'%s' is an XRT card, its xclbins are loaded by applications, tenant '%s' can't have bitstream '%s'", device.pciAddress, tenant.Name, tenant.Bitstream)
+		}
+	}
+	return nil
+}
+
+func (backend *xrtBackend) CheckBitstream(device *FPGADevice, bitstream string) error {
+	return fmt.Errorf("'%s' is an XRT card, its xclbins are loaded by applications, it can't have bitstream '%s'", device.pciAddress, bitstream)
+}
+
+func (backend *xrtBackend) Health() []HealthProbe {
+	return []HealthProbe{
+		&presenceProbe{sysfsRoot: backend.sysfsRoot},
+		&xrtErrorsProbe{},
+	}
+}
+
+// The entire card gets its render node, every device gets the shell
+func (backend *xrtBackend) AllocateSpec(device *FPGADevice, region Region) *ContainerSpec {
+	if device.xrt == nil {
+		return &ContainerSpec{}
+	}
+	spec := &ContainerSpec{
+		Envs: map[string]string{
+			ENV_XRT_SHELLS:      device.xrt.vbnv,
+			ENV_XRT_LOGIC_UUIDS: device.xrt.logicUUID,
+		},
+		Annotations: map[string]string{
+			ANNOTATION_XRT_SHELLS:      device.xrt.vbnv,
+			ANNOTATION_XRT_LOGIC_UUIDS: device.xrt.logicUUID,
+		},
+	}
+	if region == WHOLE_FPGA {
+		spec.DeviceNodes = device.deviceNodes
+	}
+	return spec
+}
+
+// Checks that the user function of an XRT card is ready, and that none of
+// the AXI firewalls between the shell and the user logic tripped
+type xrtErrorsProbe struct{}
+
+func (probe *xrtErrorsProbe) Name() string {
+	return "xrt"
+}
+
+func (probe *xrtErrorsProbe) Check(device *FPGADevice) error {
+	if device.xrt == nil {
+		return nil
+	}
+	if _, err := os.Stat(device.xrt.userPath); err != nil {
+		return fmt.Errorf("user function '%s' is gone: %v", device.xrt.userFunction, err)
+	}
+	// Older versions of xocl don't report whether they are ready
+	readyPath := path.Join(device.xrt.userPath, "ready")
+	if dat, err := ioutil.ReadFile(readyPath); err == nil {
+		ready, err := strconv.ParseUint(strings.TrimSpace(string(dat)), 0, 64)
+		if err != nil {
+			return fmt.Errorf("cannot parse '%s': %v", readyPath, err)
+		}
+		if ready == 0 {
+			return fmt.Errorf("user function '%s' is not ready", device.xrt.userFunction)
+		}
+	}
+	var statusFiles []string
+	for _, functionPath := range []string{device.xrt.mgmtPath, device.xrt.userPath} {
+		matches, _ := filepath.Glob(path.Join(functionPath, "firewall.*/detected_status"))
+		statusFiles = append(statusFiles, matches...)
+	}
+	for _, statusFile := range statusFiles {
+		dat, err := ioutil.ReadFile(statusFile)
+		if err != nil {
+			continue
+		}
+		status, err := strconv.ParseUint(strings.TrimSpace(string(dat)), 0, 64)
+		if err != nil {
+			return fmt.Errorf("cannot parse '%s': %v", statusFile, err)
+		}
+		if status != 0 {
+			return fmt.Errorf("'%s' reports 0x%x", statusFile, status)
+		}
+	}
+	return nil
+}
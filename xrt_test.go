@@ -0,0 +1,163 @@
+// Copyright (C) 2020 Mohammad Ewais
+// This file is part of FPGA-K8s-DevicePlugin <https://github.com/mewais/FPGA-K8s-DevicePlugin>.
+//
+// FPGA-k8s-DevicePlugin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// dogtag is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with dogtag.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	pluginapi "github.com/mewais/FPGA-K8s-DevicePlugin/v1beta1"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc/codes"
+)
+
+// Add an Alveo U200 whose management function is bound to xclmgmt and user
+// function to xocl
+func addXRTCard(sysfs *fakeTree) {
+	mgmt := sysfs.addPCIFunction("0000:65:00.0", "0x10ee", "0x5000")
+	user := sysfs.addPCIFunction("0000:65:00.1", "0x10ee", "0x5001")
+	sysfs.mkdir("bus/pci/drivers/" + XRT_MGMT_DRIVER)
+	sysfs.mkdir("bus/pci/drivers/" + XRT_USER_DRIVER)
+	sysfs.link(path.Join(mgmt, "driver"), "bus/pci/drivers/"+XRT_MGMT_DRIVER)
+	sysfs.link(path.Join(user, "driver"), "bus/pci/drivers/"+XRT_USER_DRIVER)
+}
+
+// XRT cards are skipped, and reloads refused, if a bitstream is configured
+// for them, rather than failing every container that uses them
+func TestXRTBitstreamRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		board BoardConfig
+		found bool
+	}{
+		{"no bitstream", BoardConfig{}, true},
+		{"tenants", BoardConfig{Tenants: []TenantConfig{{Name: "tenant", Count: 2}}}, true},
+		{"bitstream", BoardConfig{Bitstream: "accelerator.xclbin"}, false},
+		{"tenant bitstream", BoardConfig{Tenants: []TenantConfig{{Name: "tenant", Count: 2, Bitstream: "tenant-{region}.xclbin"}}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sysfs := newFakeTree(t)
+			addXRTCard(sysfs)
+			backend, err := newXRTBackend(&BackendOptions{SysfsRoot: sysfs.root, DevRoot: newFakeTree(t).root})
+			if err != nil {
+				t.Fatal(err)
+			}
+			board := test.board
+			board.Vendor = "xilinx.com"
+			board.Board = "alveo"
+			plugins, _ := getAllDevices([]Backend{backend}, &Config{Boards: []BoardConfig{board}}, nil)
+			if found := len(plugins) == 1 && len(plugins[0].devices) == 1; found != test.found {
+				t.Fatalf("found the card: %v, want %v", found, test.found)
+			}
+			if !test.found {
+				return
+			}
+			plugin := plugins[0]
+			reload := &Config{Boards: []BoardConfig{{Vendor: "xilinx.com", Board: "alveo", Bitstream: "accelerator.xclbin"}}}
+			if status := plugin.reloadTenants(reload); status.Result != RELOAD_REFUSED {
+				t.Errorf("reload with a bitstream was %s, want %s", status.Result, RELOAD_REFUSED)
+			}
+			if plugin.bitstream != "" {
+				t.Errorf("reload configured bitstream %q", plugin.bitstream)
+			}
+		})
+	}
+}
+
+// Released cards are handed out as they are, which is worth a warning
+func TestXRTResetWarns(t *testing.T) {
+	hook := test.NewGlobal()
+	t.Cleanup(func() {
+		log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+	})
+	device := &FPGADevice{Device: pluginapi.Device{ID: "xilinx.com/alveo-pci-0000-65-00.0"}}
+	if err := (&xrtBackend{}).Reset(device, WHOLE_FPGA, ""); err != nil {
+		t.Fatal(err)
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != log.WarnLevel || entry.Data["ID"] != device.ID {
+		t.Errorf("wiping an XRT card logged %v, want a warning", entry)
+	}
+}
+
+// XRT cards are only found by the xrt backend, whichever backend comes
+// first, and other cards by the pcie backend
+func TestXRTCardsSkippedByPCIe(t *testing.T) {
+	sysfs := newFakeTree(t)
+	addXRTCard(sysfs)
+	sysfs.addPCIFunction("0000:b3:00.0", "0x10ee", "0x5004")
+	options := &BackendOptions{SysfsRoot: sysfs.root, DevRoot: newFakeTree(t).root}
+	xrt, err := newXRTBackend(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcie, err := newPCIeBackend(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"xilinx.com/alveo-pci-0000-65-00.0":      "xrt",
+		"xilinx.com/alveo-u250-pci-0000-b3-00.0": "pcie",
+	}
+	for _, backends := range [][]Backend{{xrt, pcie}, {pcie, xrt}} {
+		plugins, _ := getAllDevices(backends, &Config{}, nil)
+		found := map[string]string{}
+		for _, plugin := range plugins {
+			for _, device := range plugin.devices {
+				found[device.ID] = device.backend.Name()
+			}
+		}
+		if !reflect.DeepEqual(found, want) {
+			t.Errorf("backends %s,%s found %v, want %v", backends[0].Name(), backends[1].Name(), found, want)
+		}
+	}
+}
+
+// Containers of pods choosing a bitstream for an XRT card don't start
+func TestXRTChosenBitstreamRejected(t *testing.T) {
+	sysfs := newFakeTree(t)
+	addXRTCard(sysfs)
+	backend, err := newXRTBackend(&BackendOptions{SysfsRoot: sysfs.root, DevRoot: newFakeTree(t).root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugins, _ := getAllDevices([]Backend{backend}, &Config{}, nil)
+	if len(plugins) != 1 || len(plugins[0].devices) != 1 {
+		t.Fatal("the card wasn't found")
+	}
+	plugin := plugins[0]
+	device := plugin.devices[0]
+	fake, socket := startFakePodResources(t, false)
+	fake.setDevices(map[string][]string{
+		plugin.fullName(): {device.ID},
+	})
+	plugin.chooser = NewBitstreamChooser(socket, startFakeAPIServer(t, "secret", map[string]map[string]string{
+		"default/pod-" + plugin.fullName(): {
+			ANNOTATION_BITSTREAM: "accelerator.xclbin",
+		},
+	}))
+	if err := allocate(plugin.server, device.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, preStart(plugin.server, device.ID), codes.FailedPrecondition, "is an XRT card")
+	if device.status != RESERVED {
+		t.Errorf("%s is %s after failing to start, want RESERVED", device.ID, device.status)
+	}
+}